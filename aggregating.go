@@ -0,0 +1,340 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AggregatingSinkOpts is used to configure an AggregatingSink
+type AggregatingSinkOpts struct {
+	// Interval is how often aggregated values are sent to the wrapped sink.
+	// Defaults to 10 seconds.
+	Interval time.Duration
+
+	// Buckets are the upper bounds of the histogram buckets used for
+	// samples. If empty, each sample series is sent as "count" and "sum"
+	// counters and "min", "max" and "mean" gauges. Otherwise it is sent as
+	// "count" and "sum" counters and a cumulative "bucket" counter per
+	// bound, labelled with "le".
+	Buckets []float64
+}
+
+// AggregatingSink wraps a MetricSink and aggregates metrics in memory, so
+// that the wrapped sink receives one value per series each interval rather
+// than one per call. Counters are summed, gauges keep the last value and
+// samples are reduced to statistics or histogram buckets. Series are
+// identified the same way as in InmemSink. Keys from EmitKey are passed
+// through as is.
+type AggregatingSink struct {
+	sink      MetricSink
+	interval  time.Duration
+	buckets   []float64
+	rateDenom float64
+
+	lock            sync.Mutex
+	gauges          map[string]*aggregatedGauge
+	precisionGauges map[string]*aggregatedPrecisionGauge
+	counters        map[string]*aggregatedCounter
+	samples         map[string]*aggregatedSample
+	sets            map[string]*aggregatedSet
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// aggregatedSeries holds a copy of the key and labels of a series
+type aggregatedSeries struct {
+	key    []string
+	labels []Label
+}
+
+type aggregatedGauge struct {
+	aggregatedSeries
+	value float32
+	// set is false if the gauge was only changed with AddGauge, in which
+	// case the value is the sum of the deltas
+	set bool
+}
+
+type aggregatedPrecisionGauge struct {
+	aggregatedSeries
+	value float64
+}
+
+type aggregatedCounter struct {
+	aggregatedSeries
+	sum float64
+}
+
+type aggregatedSample struct {
+	aggregatedSeries
+	AggregateSample
+	buckets []uint64
+}
+
+type aggregatedSet struct {
+	aggregatedSeries
+	values map[string]struct{}
+}
+
+// NewAggregatingSink creates an AggregatingSink that sends to sink, and
+// starts flushing it every interval.
+func NewAggregatingSink(sink MetricSink, opts AggregatingSinkOpts) *AggregatingSink {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	// The +Inf bucket is always sent
+	buckets := slices.DeleteFunc(slices.Clone(opts.Buckets), func(b float64) bool {
+		return math.IsInf(b, 1)
+	})
+	slices.Sort(buckets)
+
+	a := &AggregatingSink{
+		sink:      sink,
+		interval:  interval,
+		buckets:   buckets,
+		rateDenom: interval.Seconds(),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	a.reset()
+	go a.run()
+	return a
+}
+
+func (a *AggregatingSink) SetGauge(key []string, val float32) {
+	a.SetGaugeWithLabels(key, val, nil)
+}
+
+func (a *AggregatingSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	k, _ := seriesKey(key, labels)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	g, ok := a.gauges[k]
+	if !ok {
+		g = &aggregatedGauge{aggregatedSeries: newAggregatedSeries(key, labels)}
+		a.gauges[k] = g
+	}
+	g.value = val
+	g.set = true
+}
+
+func (a *AggregatingSink) SetPrecisionGauge(key []string, val float64) {
+	a.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+func (a *AggregatingSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	k, _ := seriesKey(key, labels)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	g, ok := a.precisionGauges[k]
+	if !ok {
+		g = &aggregatedPrecisionGauge{aggregatedSeries: newAggregatedSeries(key, labels)}
+		a.precisionGauges[k] = g
+	}
+	g.value = val
+}
+
+func (a *AggregatingSink) AddGauge(key []string, delta float32) {
+	a.AddGaugeWithLabels(key, delta, nil)
+}
+
+func (a *AggregatingSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	k, _ := seriesKey(key, labels)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	g, ok := a.gauges[k]
+	if !ok {
+		g = &aggregatedGauge{aggregatedSeries: newAggregatedSeries(key, labels)}
+		a.gauges[k] = g
+	}
+	g.value += delta
+}
+
+// EmitKey is passed through to the wrapped sink, since every key/value
+// pair must be emitted.
+func (a *AggregatingSink) EmitKey(key []string, val float32) {
+	a.sink.EmitKey(key, val)
+}
+
+func (a *AggregatingSink) IncrCounter(key []string, val float32) {
+	a.IncrCounterWithLabels(key, val, nil)
+}
+
+func (a *AggregatingSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	k, _ := seriesKey(key, labels)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	c, ok := a.counters[k]
+	if !ok {
+		c = &aggregatedCounter{aggregatedSeries: newAggregatedSeries(key, labels)}
+		a.counters[k] = c
+	}
+	c.sum += float64(val)
+}
+
+func (a *AggregatingSink) AddSample(key []string, val float32) {
+	a.AddSampleWithLabels(key, val, nil)
+}
+
+func (a *AggregatingSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	k, _ := seriesKey(key, labels)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	s, ok := a.samples[k]
+	if !ok {
+		s = &aggregatedSample{
+			aggregatedSeries: newAggregatedSeries(key, labels),
+			buckets:          make([]uint64, len(a.buckets)),
+		}
+		a.samples[k] = s
+	}
+	s.Ingest(float64(val), a.rateDenom)
+	for j, bound := range a.buckets {
+		if float64(val) <= bound {
+			s.buckets[j]++
+		}
+	}
+}
+
+func (a *AggregatingSink) AddToSet(key []string, val string) {
+	a.AddToSetWithLabels(key, val, nil)
+}
+
+// AddToSetWithLabels sends each distinct value once per interval.
+func (a *AggregatingSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	k, _ := seriesKey(key, labels)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	s, ok := a.sets[k]
+	if !ok {
+		s = &aggregatedSet{
+			aggregatedSeries: newAggregatedSeries(key, labels),
+			values:           make(map[string]struct{}),
+		}
+		a.sets[k] = s
+	}
+	s.values[val] = struct{}{}
+}
+
+// Flush sends the values aggregated since the previous flush to the wrapped
+// sink and starts a new interval.
+func (a *AggregatingSink) Flush() {
+	a.lock.Lock()
+	gauges, precisionGauges := a.gauges, a.precisionGauges
+	counters, samples, sets := a.counters, a.samples, a.sets
+	a.reset()
+	a.lock.Unlock()
+
+	for _, g := range gauges {
+		if g.set {
+			a.sink.SetGaugeWithLabels(g.key, g.value, g.labels)
+		} else if sink, ok := a.sink.(GaugeDeltaMetricSink); ok {
+			sink.AddGaugeWithLabels(g.key, g.value, g.labels)
+		}
+	}
+	if sink, ok := a.sink.(PrecisionGaugeMetricSink); ok {
+		for _, g := range precisionGauges {
+			sink.SetPrecisionGaugeWithLabels(g.key, g.value, g.labels)
+		}
+	}
+	for _, c := range counters {
+		a.sink.IncrCounterWithLabels(c.key, float32(c.sum), c.labels)
+	}
+	for _, s := range samples {
+		a.flushSample(s)
+	}
+	if sink, ok := a.sink.(SetMetricSink); ok {
+		for _, s := range sets {
+			for val := range s.values {
+				sink.AddToSetWithLabels(s.key, val, s.labels)
+			}
+		}
+	}
+}
+
+// Shutdown stops the flush loop, flushes the last interval and shuts down
+// the wrapped sink.
+func (a *AggregatingSink) Shutdown() {
+	a.stopOnce.Do(func() {
+		close(a.stopCh)
+	})
+	<-a.doneCh
+
+	if ss, ok := a.sink.(ShutdownSink); ok {
+		ss.Shutdown()
+	}
+}
+
+func (a *AggregatingSink) flushSample(s *aggregatedSample) {
+	a.sink.IncrCounterWithLabels(suffixKey(s.key, "count"), float32(s.Count), s.labels)
+	a.sink.IncrCounterWithLabels(suffixKey(s.key, "sum"), float32(s.Sum), s.labels)
+
+	if len(a.buckets) == 0 {
+		a.sink.SetGaugeWithLabels(suffixKey(s.key, "min"), float32(s.Min), s.labels)
+		a.sink.SetGaugeWithLabels(suffixKey(s.key, "max"), float32(s.Max), s.labels)
+		a.sink.SetGaugeWithLabels(suffixKey(s.key, "mean"), float32(s.Mean()), s.labels)
+		return
+	}
+
+	bucketKey := suffixKey(s.key, "bucket")
+	for j, bound := range a.buckets {
+		labels := append(slices.Clip(s.labels), Label{"le", strconv.FormatFloat(bound, 'g', -1, 64)})
+		a.sink.IncrCounterWithLabels(bucketKey, float32(s.buckets[j]), labels)
+	}
+	labels := append(slices.Clip(s.labels), Label{"le", "+Inf"})
+	a.sink.IncrCounterWithLabels(bucketKey, float32(s.Count), labels)
+}
+
+// run flushes every interval until Shutdown is called
+func (a *AggregatingSink) run() {
+	defer close(a.doneCh)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-a.stopCh:
+			a.Flush()
+			return
+		}
+	}
+}
+
+// reset starts a new interval, the caller must hold the lock
+func (a *AggregatingSink) reset() {
+	a.gauges = make(map[string]*aggregatedGauge)
+	a.precisionGauges = make(map[string]*aggregatedPrecisionGauge)
+	a.counters = make(map[string]*aggregatedCounter)
+	a.samples = make(map[string]*aggregatedSample)
+	a.sets = make(map[string]*aggregatedSet)
+}
+
+// newAggregatedSeries copies the key and labels, since callers may reuse them
+func newAggregatedSeries(key []string, labels []Label) aggregatedSeries {
+	return aggregatedSeries{
+		key:    slices.Clone(key),
+		labels: slices.Clone(labels),
+	}
+}
+
+// suffixKey returns a copy of key with suffix appended
+func suffixKey(key []string, suffix string) []string {
+	return append(slices.Clip(key), suffix)
+}
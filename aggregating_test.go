@@ -0,0 +1,141 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// values returns the values sent to the mock sink keyed by flattened key and labels
+func (m *MockSink) values() map[string]float32 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	out := make(map[string]float32)
+	vals := 0
+	for i, key := range m.keys {
+		k, _ := seriesKey(key, m.labels[i])
+		if strings.HasPrefix(key[0], "set") {
+			k += "=" + m.setVals[i-vals]
+			out[k]++
+			continue
+		}
+		out[k] = m.vals[vals]
+		vals++
+	}
+	return out
+}
+
+func TestAggregatingSink(t *testing.T) {
+	m := &MockSink{}
+	a := NewAggregatingSink(m, AggregatingSinkOpts{Interval: time.Hour})
+	defer a.Shutdown()
+
+	labels := []Label{{"a", "b"}}
+	for range 100 {
+		a.IncrCounter([]string{"counter"}, 1)
+		a.IncrCounterWithLabels([]string{"counter"}, 2, labels)
+	}
+	a.SetGauge([]string{"gauge"}, 1)
+	a.SetGauge([]string{"gauge"}, 3)
+	a.AddGauge([]string{"gauge"}, 1)
+	a.AddGauge([]string{"delta"}, 2)
+	a.AddGauge([]string{"delta"}, -5)
+	for _, v := range []float32{1, 2, 6} {
+		a.AddSampleWithLabels([]string{"sample"}, v, labels)
+	}
+	a.AddToSet([]string{"set"}, "x")
+	a.AddToSet([]string{"set"}, "x")
+	a.AddToSet([]string{"set"}, "y")
+
+	if len(m.getKeys()) != 0 {
+		t.Fatalf("values sent before flush: %v", m.getKeys())
+	}
+	a.Flush()
+
+	expect := map[string]float32{
+		"counter":          100,
+		"counter;a=b":      200,
+		"gauge":            4,
+		"delta":            -3,
+		"sample.count;a=b": 3,
+		"sample.sum;a=b":   9,
+		"sample.min;a=b":   1,
+		"sample.max;a=b":   6,
+		"sample.mean;a=b":  3,
+		"set=x":            1,
+		"set=y":            1,
+	}
+	if got := m.values(); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v, got %v", expect, got)
+	}
+
+	// Nothing is sent for an empty interval
+	m.keys = nil
+	a.Flush()
+	if len(m.getKeys()) != 0 {
+		t.Fatalf("values sent for empty interval: %v", m.getKeys())
+	}
+}
+
+func TestAggregatingSink_Buckets(t *testing.T) {
+	m := &MockSink{}
+	a := NewAggregatingSink(m, AggregatingSinkOpts{Interval: time.Hour, Buckets: []float64{10, 1}})
+	defer a.Shutdown()
+
+	for _, v := range []float32{0.5, 1, 5, 50} {
+		a.AddSample([]string{"sample"}, v)
+	}
+	a.Flush()
+
+	expect := map[string]float32{
+		"sample.count":          4,
+		"sample.sum":            56.5,
+		"sample.bucket;le=1":    2,
+		"sample.bucket;le=10":   3,
+		"sample.bucket;le=+Inf": 4,
+	}
+	if got := m.values(); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestAggregatingSink_Interval(t *testing.T) {
+	m := &MockSink{}
+	a := NewAggregatingSink(m, AggregatingSinkOpts{Interval: 10 * time.Millisecond})
+	defer a.Shutdown()
+
+	a.IncrCounter([]string{"counter"}, 1)
+	a.EmitKey([]string{"key"}, 2)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for len(m.getKeys()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("counter was not flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	expect := map[string]float32{"key": 2, "counter": 1}
+	if got := m.values(); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestAggregatingSink_Shutdown(t *testing.T) {
+	m := &MockSink{}
+	a := NewAggregatingSink(m, AggregatingSinkOpts{Interval: time.Hour})
+
+	a.IncrCounter([]string{"counter"}, 1)
+	a.Shutdown()
+
+	if got := m.values(); got["counter"] != 1 {
+		t.Fatalf("counter was not flushed on shutdown: %v", got)
+	}
+	if !m.shutdown {
+		t.Fatalf("wrapped sink was not shut down")
+	}
+}
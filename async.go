@@ -0,0 +1,344 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what an AsyncSink does when its queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the metric being added. This is the default.
+	OverflowDropNewest OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest queued metric to make room.
+	OverflowDropOldest
+
+	// OverflowBlock blocks the caller until there is room in the queue, or
+	// until BlockTimeout has elapsed, in which case the metric is dropped.
+	OverflowBlock
+)
+
+// AsyncSinkOpts is used to configure an AsyncSink
+type AsyncSinkOpts struct {
+	// QueueSize is the maximum number of queued metrics. Defaults to 4096.
+	QueueSize int
+
+	// BatchSize is the maximum number of metrics taken off the queue and
+	// dispatched to the wrapped sink at a time. Defaults to 256.
+	BatchSize int
+
+	// Overflow is the policy applied when the queue is full.
+	Overflow OverflowPolicy
+
+	// BlockTimeout bounds how long OverflowBlock blocks the caller.
+	// Defaults to 100 milliseconds.
+	BlockTimeout time.Duration
+
+	// ShutdownTimeout bounds how long Shutdown waits for the queued metrics
+	// to be dispatched. Defaults to 5 seconds.
+	ShutdownTimeout time.Duration
+}
+
+// AsyncSinkStats holds the counters of an AsyncSink
+type AsyncSinkStats struct {
+	// Dispatched is the number of metrics sent to the wrapped sink
+	Dispatched uint64
+
+	// Batches is the number of batches the metrics were dispatched in
+	Batches uint64
+
+	// Dropped is the number of metrics dropped because the queue was full,
+	// because the sink was shut down, or because they were still queued
+	// when Shutdown timed out
+	Dropped uint64
+}
+
+// AsyncSink wraps a MetricSink so that metrics are queued and sent to it on
+// a separate goroutine. This keeps slow or blocking sinks off the caller's
+// goroutine.
+type AsyncSink struct {
+	sink            MetricSink
+	queue           chan asyncMetric
+	batchSize       int
+	overflow        OverflowPolicy
+	blockTimeout    time.Duration
+	shutdownTimeout time.Duration
+
+	dispatched atomic.Uint64
+	batches    atomic.Uint64
+	dropped    atomic.Uint64
+
+	// shutdownLock guards queue so that no metric is added once Shutdown
+	// has closed it
+	shutdownLock sync.RWMutex
+	shutdown     bool
+	doneCh       chan struct{}
+
+	// abandoned is set once Shutdown has timed out, the dispatcher then
+	// drops the metrics left in the queue
+	abandoned atomic.Bool
+}
+
+type asyncMetricType int
+
+const (
+	asyncGauge asyncMetricType = iota
+	asyncPrecisionGauge
+	asyncGaugeDelta
+	asyncKey
+	asyncCounter
+	asyncSample
+	asyncSet
+)
+
+// asyncMetric is a queued call to the wrapped sink
+type asyncMetric struct {
+	typ    asyncMetricType
+	key    []string
+	val    float64
+	setVal string
+	labels []Label
+}
+
+// NewAsyncSink creates an AsyncSink sending to sink, and starts the
+// goroutine dispatching to it.
+func NewAsyncSink(sink MetricSink, opts AsyncSinkOpts) *AsyncSink {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4096
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = 100 * time.Millisecond
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = shutdownTimeout
+	}
+	a := &AsyncSink{
+		sink:            sink,
+		queue:           make(chan asyncMetric, opts.QueueSize),
+		batchSize:       opts.BatchSize,
+		overflow:        opts.Overflow,
+		blockTimeout:    opts.BlockTimeout,
+		shutdownTimeout: opts.ShutdownTimeout,
+		doneCh:          make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Stats returns the number of dispatched and dropped metrics, and the
+// number of batches dispatched
+func (a *AsyncSink) Stats() AsyncSinkStats {
+	return AsyncSinkStats{
+		Dispatched: a.dispatched.Load(),
+		Batches:    a.batches.Load(),
+		Dropped:    a.dropped.Load(),
+	}
+}
+
+func (a *AsyncSink) SetGauge(key []string, val float32) {
+	a.SetGaugeWithLabels(key, val, nil)
+}
+
+func (a *AsyncSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	a.push(asyncGauge, key, float64(val), "", labels)
+}
+
+func (a *AsyncSink) SetPrecisionGauge(key []string, val float64) {
+	a.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+func (a *AsyncSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	if _, ok := a.sink.(PrecisionGaugeMetricSink); ok {
+		a.push(asyncPrecisionGauge, key, val, "", labels)
+	}
+}
+
+func (a *AsyncSink) AddGauge(key []string, delta float32) {
+	a.AddGaugeWithLabels(key, delta, nil)
+}
+
+func (a *AsyncSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	if _, ok := a.sink.(GaugeDeltaMetricSink); ok {
+		a.push(asyncGaugeDelta, key, float64(delta), "", labels)
+	}
+}
+
+func (a *AsyncSink) EmitKey(key []string, val float32) {
+	a.push(asyncKey, key, float64(val), "", nil)
+}
+
+func (a *AsyncSink) IncrCounter(key []string, val float32) {
+	a.IncrCounterWithLabels(key, val, nil)
+}
+
+func (a *AsyncSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	a.push(asyncCounter, key, float64(val), "", labels)
+}
+
+func (a *AsyncSink) AddSample(key []string, val float32) {
+	a.AddSampleWithLabels(key, val, nil)
+}
+
+func (a *AsyncSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	a.push(asyncSample, key, float64(val), "", labels)
+}
+
+func (a *AsyncSink) AddToSet(key []string, val string) {
+	a.AddToSetWithLabels(key, val, nil)
+}
+
+func (a *AsyncSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	if _, ok := a.sink.(SetMetricSink); ok {
+		a.push(asyncSet, key, 0, val, labels)
+	}
+}
+
+// Shutdown stops accepting metrics, blocks until the queued metrics have
+// been dispatched, then shuts down the wrapped sink. If the metrics aren't
+// dispatched within the shutdown timeout, the metrics left are dropped, and
+// the wrapped sink, which is still busy, isn't shut down.
+func (a *AsyncSink) Shutdown() {
+	a.shutdownLock.Lock()
+	if a.shutdown {
+		a.shutdownLock.Unlock()
+		return
+	}
+	a.shutdown = true
+	close(a.queue)
+	a.shutdownLock.Unlock()
+
+	timer := time.NewTimer(a.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-a.doneCh:
+	case <-timer.C:
+		log.Printf("[WARN] Timed out dispatching metrics during shutdown")
+		a.abandoned.Store(true)
+		for range a.queue {
+			a.dropped.Add(1)
+		}
+		return
+	}
+	if ss, ok := a.sink.(ShutdownSink); ok {
+		ss.Shutdown()
+	}
+}
+
+// push queues a metric, applying the overflow policy if the queue is full.
+// The key and labels are copied since callers may reuse them.
+func (a *AsyncSink) push(typ asyncMetricType, key []string, val float64, setVal string, labels []Label) {
+	m := asyncMetric{
+		typ:    typ,
+		key:    slices.Clone(key),
+		val:    val,
+		setVal: setVal,
+		labels: slices.Clone(labels),
+	}
+
+	a.shutdownLock.RLock()
+	defer a.shutdownLock.RUnlock()
+	if a.shutdown {
+		a.dropped.Add(1)
+		return
+	}
+
+	select {
+	case a.queue <- m:
+		return
+	default:
+	}
+
+	switch a.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case <-a.queue:
+				a.dropped.Add(1)
+			default:
+			}
+			select {
+			case a.queue <- m:
+				return
+			default:
+			}
+		}
+	case OverflowBlock:
+		timer := time.NewTimer(a.blockTimeout)
+		defer timer.Stop()
+		select {
+		case a.queue <- m:
+			return
+		case <-timer.C:
+		}
+	}
+	a.dropped.Add(1)
+}
+
+// run dispatches queued metrics in batches until the queue is closed. A
+// batch is whatever is queued, up to the batch size, when the previous
+// batch is done, so that bursts are taken off the queue at once.
+func (a *AsyncSink) run() {
+	defer close(a.doneCh)
+
+	batch := make([]asyncMetric, 0, a.batchSize)
+	for m := range a.queue {
+		batch = append(batch[:0], m)
+	BATCH:
+		for len(batch) < a.batchSize {
+			select {
+			case m, ok := <-a.queue:
+				if !ok {
+					break BATCH
+				}
+				batch = append(batch, m)
+			default:
+				break BATCH
+			}
+		}
+		a.dispatchBatch(batch)
+	}
+}
+
+// dispatchBatch sends a batch to the wrapped sink, or drops it if Shutdown
+// has given up on the dispatcher
+func (a *AsyncSink) dispatchBatch(batch []asyncMetric) {
+	a.batches.Add(1)
+	for i, m := range batch {
+		if a.abandoned.Load() {
+			a.dropped.Add(uint64(len(batch) - i))
+			return
+		}
+		a.dispatch(m)
+		a.dispatched.Add(1)
+	}
+}
+
+func (a *AsyncSink) dispatch(m asyncMetric) {
+	switch m.typ {
+	case asyncGauge:
+		a.sink.SetGaugeWithLabels(m.key, float32(m.val), m.labels)
+	case asyncPrecisionGauge:
+		a.sink.(PrecisionGaugeMetricSink).SetPrecisionGaugeWithLabels(m.key, m.val, m.labels)
+	case asyncGaugeDelta:
+		a.sink.(GaugeDeltaMetricSink).AddGaugeWithLabels(m.key, float32(m.val), m.labels)
+	case asyncKey:
+		a.sink.EmitKey(m.key, float32(m.val))
+	case asyncCounter:
+		a.sink.IncrCounterWithLabels(m.key, float32(m.val), m.labels)
+	case asyncSample:
+		a.sink.AddSampleWithLabels(m.key, float32(m.val), m.labels)
+	case asyncSet:
+		a.sink.(SetMetricSink).AddToSetWithLabels(m.key, m.setVal, m.labels)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// gatedSink blocks counter increments until the gate is closed
+type gatedSink struct {
+	*MockSink
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func newGatedSink() *gatedSink {
+	return &gatedSink{
+		MockSink: &MockSink{},
+		entered:  make(chan struct{}, 100),
+		gate:     make(chan struct{}),
+	}
+}
+
+func (g *gatedSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	g.entered <- struct{}{}
+	<-g.gate
+	g.MockSink.IncrCounterWithLabels(key, val, labels)
+}
+
+// fillAsyncSink sends a first counter and waits for it to block the
+// dispatcher, then sends the given values
+func fillAsyncSink(t *testing.T, a *AsyncSink, g *gatedSink, vals ...float32) {
+	t.Helper()
+	a.IncrCounter([]string{"c"}, 0)
+	select {
+	case <-g.entered:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("dispatcher did not pick up metric")
+	}
+	for _, v := range vals {
+		a.IncrCounter([]string{"c"}, v)
+	}
+}
+
+func TestAsyncSink(t *testing.T) {
+	m := &MockSink{}
+	a := NewAsyncSink(m, AsyncSinkOpts{})
+
+	key := []string{"counter"}
+	labels := []Label{{"a", "b"}}
+	for i := range 10 {
+		a.IncrCounterWithLabels(key, float32(i), labels)
+	}
+	// Reusing the key must not affect queued metrics
+	key[0] = "changed"
+	a.SetGauge([]string{"gauge"}, 1)
+	a.SetPrecisionGauge([]string{"gauge"}, 2)
+	a.EmitKey([]string{"key"}, 3)
+	a.AddSample([]string{"sample"}, 4)
+	a.AddGauge([]string{"gauge"}, 5)
+	a.AddToSet([]string{"set"}, "x")
+	a.Shutdown()
+
+	if !m.shutdown {
+		t.Fatalf("wrapped sink was not shut down")
+	}
+	if len(m.keys) != 16 {
+		t.Fatalf("bad keys: %v", m.keys)
+	}
+	for i := range 10 {
+		if m.keys[i][0] != "counter" || m.vals[i] != float32(i) || !reflect.DeepEqual(m.labels[i], labels) {
+			t.Fatalf("bad metric %d: %v %v %v", i, m.keys[i], m.vals[i], m.labels[i])
+		}
+	}
+	if !reflect.DeepEqual(m.vals[10:], []float32{1, 3, 4, 5}) || m.precisionVals[0] != 2 || m.setVals[0] != "x" {
+		t.Fatalf("bad vals: %v %v %v", m.vals, m.precisionVals, m.setVals)
+	}
+	if stats := a.Stats(); stats.Dispatched != 16 || stats.Dropped != 0 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+
+	// Metrics are dropped after shutdown, without panicking
+	a.IncrCounter([]string{"counter"}, 1)
+	a.Shutdown()
+	if stats := a.Stats(); stats.Dropped != 1 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+}
+
+func TestAsyncSink_Overflow(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		policy OverflowPolicy
+		expect []float32
+	}{
+		{"drop newest", OverflowDropNewest, []float32{0, 1, 2}},
+		{"drop oldest", OverflowDropOldest, []float32{0, 2, 3}},
+		{"block with timeout", OverflowBlock, []float32{0, 1, 2}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			g := newGatedSink()
+			a := NewAsyncSink(g, AsyncSinkOpts{
+				QueueSize:    2,
+				Overflow:     tc.policy,
+				BlockTimeout: 20 * time.Millisecond,
+			})
+
+			start := time.Now()
+			fillAsyncSink(t, a, g, 1, 2, 3)
+			if tc.policy == OverflowBlock && time.Since(start) < 20*time.Millisecond {
+				t.Fatalf("push did not block")
+			}
+
+			close(g.gate)
+			a.Shutdown()
+			if !reflect.DeepEqual(g.vals, tc.expect) {
+				t.Fatalf("expected %v, got %v", tc.expect, g.vals)
+			}
+			if stats := a.Stats(); stats.Dropped != 1 || stats.Dispatched != 3 {
+				t.Fatalf("bad stats: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestAsyncSink_BlockUntilRoom(t *testing.T) {
+	g := newGatedSink()
+	a := NewAsyncSink(g, AsyncSinkOpts{
+		QueueSize:    1,
+		Overflow:     OverflowBlock,
+		BlockTimeout: 5 * time.Second,
+	})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(g.gate)
+	}()
+	fillAsyncSink(t, a, g, 1, 2, 3)
+	a.Shutdown()
+
+	if !reflect.DeepEqual(g.vals, []float32{0, 1, 2, 3}) {
+		t.Fatalf("bad vals: %v", g.vals)
+	}
+	if stats := a.Stats(); stats.Dropped != 0 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+}
+
+func TestAsyncSink_ShutdownTimeout(t *testing.T) {
+	g := newGatedSink()
+	defer close(g.gate)
+	a := NewAsyncSink(g, AsyncSinkOpts{ShutdownTimeout: 20 * time.Millisecond})
+
+	fillAsyncSink(t, a, g, 1, 2)
+	start := time.Now()
+	a.Shutdown()
+	if time.Since(start) > time.Second {
+		t.Fatalf("shutdown was not bounded")
+	}
+	if g.shutdown {
+		t.Fatalf("busy sink was shut down")
+	}
+	if stats := a.Stats(); stats.Dropped != 2 || stats.Dispatched != 0 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+}
+
+func TestAsyncSink_Batches(t *testing.T) {
+	g := newGatedSink()
+	a := NewAsyncSink(g, AsyncSinkOpts{BatchSize: 4})
+
+	// The metrics queued while the dispatcher is busy are taken in batches
+	fillAsyncSink(t, a, g, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	close(g.gate)
+	a.Shutdown()
+
+	if len(g.vals) != 10 {
+		t.Fatalf("bad vals: %v", g.vals)
+	}
+	if stats := a.Stats(); stats.Dispatched != 10 || stats.Batches != 4 {
+		t.Fatalf("bad stats: %+v", stats)
+	}
+}
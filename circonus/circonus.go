@@ -15,7 +15,8 @@ import (
 // CirconusSink provides an interface to forward metrics to Circonus with
 // automatic check creation and metric management
 type CirconusSink struct {
-	metrics *cgm.CirconusMetrics
+	metrics   *cgm.CirconusMetrics
+	formatter metrics.KeyFormatter
 }
 
 // Config options for CirconusSink
@@ -49,6 +50,13 @@ func NewCirconusSink(cc *Config) (*CirconusSink, error) {
 	}, nil
 }
 
+// SetKeyFormatter sets how keys are turned into metric names, by default
+// the parts are joined with '`'. Spaces are still replaced. It must be
+// called before the sink is used.
+func (s *CirconusSink) SetKeyFormatter(formatter metrics.KeyFormatter) {
+	s.formatter = formatter
+}
+
 // Start submitting metrics to Circonus (flush every SubmitInterval)
 func (s *CirconusSink) Start() {
 	s.metrics.Start()
@@ -123,7 +131,12 @@ func (s *CirconusSink) Shutdown() {
 
 // Flattens key to Circonus metric name
 func (s *CirconusSink) flattenKey(parts []string) string {
-	joined := strings.Join(parts, "`")
+	var joined string
+	if s.formatter != nil {
+		joined = s.formatter.FormatKey(parts)
+	} else {
+		joined = strings.Join(parts, "`")
+	}
 	return strings.Map(func(r rune) rune {
 		switch r {
 		case ' ':
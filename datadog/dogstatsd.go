@@ -6,6 +6,9 @@ package datadog
 import (
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
 	"github.com/hashicorp/go-metrics"
@@ -17,6 +20,30 @@ type DogStatsdSink struct {
 	client            *statsd.Client
 	hostName          string
 	propagateHostname bool
+	encoder           *metrics.LineEncoder
+	formatter         metrics.KeyFormatter
+	sampleType        metrics.SampleType
+
+	// deltaGauges holds the last value sent for the gauges changed with
+	// AddGauge, so that it can send absolute values, which is all DogStatsD
+	// supports. The other gauges aren't tracked, and the entries expire
+	// after deltaGaugeExpiration without updates.
+	deltaGauges    sync.Map // gaugeID -> *deltaGauge
+	hasDeltaGauges atomic.Bool
+	swept          atomic.Int64
+}
+
+// deltaGaugeExpiration is how long the value of a gauge changed with
+// AddGauge is kept without updates
+const deltaGaugeExpiration = 10 * time.Minute
+
+// deltaGauge is the last value sent for a gauge changed with AddGauge. The
+// lock is held while sending, so that the last value sent is the last one
+// computed.
+type deltaGauge struct {
+	lock      sync.Mutex
+	value     float64
+	updatedAt time.Time
 }
 
 // NewDogStatsdSink is used to create a new DogStatsdSink with sane defaults
@@ -29,6 +56,7 @@ func NewDogStatsdSink(addr string, hostName string) (*DogStatsdSink, error) {
 		client:            client,
 		hostName:          hostName,
 		propagateHostname: false,
+		encoder:           defaultEncoder,
 	}
 	return sink, nil
 }
@@ -47,20 +75,33 @@ func (s *DogStatsdSink) EnableHostNamePropagation() {
 	s.propagateHostname = true
 }
 
-func (s *DogStatsdSink) flattenKey(parts []string) string {
-	joined := strings.Join(parts, ".")
-	return strings.Map(sanitize, joined)
+// defaultEncoder replaces characters reserved by the DogStatsD format
+var defaultEncoder = metrics.NewLineEncoder(metrics.DogStatsdFormat, metrics.EscapeReplace, nil)
+
+// SetEncoder overrides how keys and tags are escaped, by default unsafe
+// characters are replaced. It must be called before the sink is used.
+func (s *DogStatsdSink) SetEncoder(encoder *metrics.LineEncoder) {
+	s.encoder = encoder
 }
 
-func sanitize(r rune) rune {
-	switch r {
-	case ':':
-		fallthrough
-	case ' ':
-		return '_'
-	default:
-		return r
+// SetKeyFormatter sets how keys are turned into metric names, by default
+// the parts are joined with '.'. It must be called before the sink is used.
+func (s *DogStatsdSink) SetKeyFormatter(formatter metrics.KeyFormatter) {
+	s.formatter = formatter
+}
+
+// SetSampleType sets the DogStatsD metric type used for samples, by default
+// samples are sent as timers. It must be called before the sink is used.
+func (s *DogStatsdSink) SetSampleType(sampleType metrics.SampleType) {
+	s.sampleType = sampleType
+}
+
+// flattenKey joins and escapes the key, returns false if the metric must be dropped
+func (s *DogStatsdSink) flattenKey(parts []string) (string, bool) {
+	if s.formatter != nil {
+		return s.encoder.EncodeKey(s.formatter.FormatKey(parts))
 	}
+	return s.encoder.EncodeKey(strings.Join(parts, "."))
 }
 
 func (s *DogStatsdSink) parseKey(key []string) ([]string, []metrics.Label) {
@@ -113,29 +154,134 @@ func (s *DogStatsdSink) AddSample(key []string, val float32) {
 // The following ...WithLabels methods correspond to Datadog's Tag extension to Statsd.
 // http://docs.datadoghq.com/guides/dogstatsd/#tags
 func (s *DogStatsdSink) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
-	flatKey, tags := s.getFlatkeyAndCombinedLabels(key, labels)
-	rate := 1.0
-	_ = s.client.Gauge(flatKey, float64(val), tags, rate)
+	flatKey, tags, ok := s.getFlatkeyAndCombinedLabels(key, labels)
+	if !ok {
+		return
+	}
+	s.setGauge(flatKey, float64(val), tags)
 }
 
 // The following ...WithLabels methods correspond to Datadog's Tag extension to Statsd.
 // http://docs.datadoghq.com/guides/dogstatsd/#tags
 func (s *DogStatsdSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []metrics.Label) {
-	flatKey, tags := s.getFlatkeyAndCombinedLabels(key, labels)
+	flatKey, tags, ok := s.getFlatkeyAndCombinedLabels(key, labels)
+	if !ok {
+		return
+	}
+	s.setGauge(flatKey, val, tags)
+}
+
+// setGauge sends the value of a gauge, and records it if the gauge has been
+// changed with AddGauge
+func (s *DogStatsdSink) setGauge(flatKey string, val float64, tags []string) {
 	rate := 1.0
+	if s.hasDeltaGauges.Load() {
+		if g, ok := s.deltaGauges.Load(gaugeID(flatKey, tags)); ok {
+			g := g.(*deltaGauge)
+			g.lock.Lock()
+			defer g.lock.Unlock()
+			g.value = val
+			g.updatedAt = time.Now()
+		}
+	}
 	_ = s.client.Gauge(flatKey, val, tags, rate)
 }
 
 func (s *DogStatsdSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
-	flatKey, tags := s.getFlatkeyAndCombinedLabels(key, labels)
+	flatKey, tags, ok := s.getFlatkeyAndCombinedLabels(key, labels)
+	if !ok {
+		return
+	}
 	rate := 1.0
 	_ = s.client.Count(flatKey, int64(val), tags, rate)
 }
 
 func (s *DogStatsdSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
-	flatKey, tags := s.getFlatkeyAndCombinedLabels(key, labels)
+	flatKey, tags, ok := s.getFlatkeyAndCombinedLabels(key, labels)
+	if !ok {
+		return
+	}
+	rate := 1.0
+	switch s.sampleType {
+	case metrics.SampleHistogram:
+		_ = s.client.Histogram(flatKey, float64(val), tags, rate)
+	case metrics.SampleDistribution:
+		_ = s.client.Distribution(flatKey, float64(val), tags, rate)
+	default:
+		_ = s.client.TimeInMilliseconds(flatKey, float64(val), tags, rate)
+	}
+}
+
+func (s *DogStatsdSink) AddGauge(key []string, delta float32) {
+	s.AddGaugeWithLabels(key, delta, nil)
+}
+
+// AddGaugeWithLabels adds delta to the last value this sink sent for the
+// gauge, and sends the result. DogStatsD has no relative gauge updates.
+// The values are only recorded once AddGauge has been used for a gauge, so
+// the first delta is added to zero.
+func (s *DogStatsdSink) AddGaugeWithLabels(key []string, delta float32, labels []metrics.Label) {
+	flatKey, tags, ok := s.getFlatkeyAndCombinedLabels(key, labels)
+	if !ok {
+		return
+	}
+	id := gaugeID(flatKey, tags)
+	now := time.Now()
+	s.sweep(now)
+
+	g, ok := s.deltaGauges.Load(id)
+	if !ok {
+		g, _ = s.deltaGauges.LoadOrStore(id, &deltaGauge{})
+		s.hasDeltaGauges.Store(true)
+	}
+	dg := g.(*deltaGauge)
+	dg.lock.Lock()
+	defer dg.lock.Unlock()
+	dg.value += float64(delta)
+	dg.updatedAt = now
+
 	rate := 1.0
-	_ = s.client.TimeInMilliseconds(flatKey, float64(val), tags, rate)
+	_ = s.client.Gauge(flatKey, dg.value, tags, rate)
+}
+
+// sweep removes the gauges not updated for deltaGaugeExpiration, at most
+// once per expiration
+func (s *DogStatsdSink) sweep(now time.Time) {
+	swept := s.swept.Load()
+	if now.UnixNano()-swept < int64(deltaGaugeExpiration) || !s.swept.CompareAndSwap(swept, now.UnixNano()) {
+		return
+	}
+	s.deltaGauges.Range(func(k, v any) bool {
+		g := v.(*deltaGauge)
+		g.lock.Lock()
+		if now.Sub(g.updatedAt) > deltaGaugeExpiration {
+			s.deltaGauges.Delete(k)
+		}
+		g.lock.Unlock()
+		return true
+	})
+}
+
+// gaugeID identifies a gauge series by its key and tags
+func gaugeID(flatKey string, tags []string) string {
+	return flatKey + "|#" + strings.Join(tags, ",")
+}
+
+func (s *DogStatsdSink) AddToSet(key []string, val string) {
+	s.AddToSetWithLabels(key, val, nil)
+}
+
+func (s *DogStatsdSink) AddToSetWithLabels(key []string, val string, labels []metrics.Label) {
+	flatKey, tags, ok := s.getFlatkeyAndCombinedLabels(key, labels)
+	if !ok {
+		return
+	}
+	val, ok = s.encoder.EncodeLabelValue(val)
+	if !ok {
+		return
+	}
+	rate := 1.0
+	_ = s.client.Set(flatKey, val, tags, rate)
 }
 
 // Shutdown disables further metric collection, blocks to flush data, and tears down the sink.
@@ -143,21 +289,32 @@ func (s *DogStatsdSink) Shutdown() {
 	_ = s.client.Close()
 }
 
-func (s *DogStatsdSink) getFlatkeyAndCombinedLabels(key []string, labels []metrics.Label) (string, []string) {
+// getFlatkeyAndCombinedLabels returns the escaped key and tags for a metric,
+// or false if the encoder rejected them and the metric must be dropped
+func (s *DogStatsdSink) getFlatkeyAndCombinedLabels(key []string, labels []metrics.Label) (string, []string, bool) {
 	key, parsedLabels := s.parseKey(key)
-	flatKey := s.flattenKey(key)
+	flatKey, ok := s.flattenKey(key)
+	if !ok {
+		return "", nil, false
+	}
 	labels = append(labels, parsedLabels...)
 
 	var tags []string
 	for _, label := range labels {
-		label.Name = strings.Map(sanitize, label.Name)
-		label.Value = strings.Map(sanitize, label.Value)
-		if label.Value != "" {
-			tags = append(tags, fmt.Sprintf("%s:%s", label.Name, label.Value))
+		name, ok := s.encoder.EncodeLabelName(label.Name)
+		if !ok {
+			return "", nil, false
+		}
+		value, ok := s.encoder.EncodeLabelValue(label.Value)
+		if !ok {
+			return "", nil, false
+		}
+		if value != "" {
+			tags = append(tags, fmt.Sprintf("%s:%s", name, value))
 		} else {
-			tags = append(tags, label.Name)
+			tags = append(tags, name)
 		}
 	}
 
-	return flatKey, tags
+	return flatKey, tags, true
 }
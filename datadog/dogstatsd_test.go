@@ -6,7 +6,9 @@ package datadog
 import (
 	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-metrics"
 )
@@ -66,7 +68,7 @@ var MetricSinkTests = []struct {
 //nolint:unparam
 func mockNewDogStatsdSink(addr string, labels []metrics.Label, tagWithHostname bool) *DogStatsdSink {
 	dog, _ := NewDogStatsdSink(addr, MockGetHostname())
-	_, tags := dog.getFlatkeyAndCombinedLabels(nil, labels)
+	_, tags, _ := dog.getFlatkeyAndCombinedLabels(nil, labels)
 	dog.SetTags(tags)
 	if tagWithHostname {
 		dog.EnableHostNamePropagation()
@@ -113,7 +115,8 @@ func TestParseKey(t *testing.T) {
 func TestFlattenKey(t *testing.T) {
 	dog := mockNewDogStatsdSink(DogStatsdAddr, EmptyTags, HostnameDisabled)
 	for _, tt := range FlattenKeyTests {
-		if !reflect.DeepEqual(dog.flattenKey(tt.KeyToFlatten), tt.Expected) {
+		flat, _ := dog.flattenKey(tt.KeyToFlatten)
+		if !reflect.DeepEqual(flat, tt.Expected) {
 			t.Fatalf("Flattening %v failed", tt.KeyToFlatten)
 		}
 	}
@@ -155,6 +158,59 @@ func TestTaggableMetrics(t *testing.T) {
 	assertServerMatchesExpected(t, server, buf, "sample.thing:4|c|#global,tagkey:tagvalue,host:test_hostname\n")
 }
 
+func TestExtendedMetrics(t *testing.T) {
+	server, buf := setupTestServerAndBuffer(t)
+	defer func() { _ = server.Close() }()
+
+	dog := mockNewDogStatsdSink(DogStatsdAddr, EmptyTags, HostnameDisabled)
+
+	dog.AddToSetWithLabels([]string{"set", "users"}, "user|1", []metrics.Label{{Name: "tagkey", Value: "tagvalue"}})
+	assertServerMatchesExpected(t, server, buf, "set.users:user_1|s|#tagkey:tagvalue\n")
+
+	dog.AddGauge([]string{"queue", "depth"}, float32(5))
+	assertServerMatchesExpected(t, server, buf, "queue.depth:5|g\n")
+	dog.SetGauge([]string{"queue", "depth"}, float32(10))
+	assertServerMatchesExpected(t, server, buf, "queue.depth:10|g\n")
+	dog.AddGauge([]string{"queue", "depth"}, float32(-3))
+	assertServerMatchesExpected(t, server, buf, "queue.depth:7|g\n")
+	dog.AddGaugeWithLabels([]string{"queue", "depth"}, float32(2), []metrics.Label{{Name: "tagkey", Value: "tagvalue"}})
+	assertServerMatchesExpected(t, server, buf, "queue.depth:2|g|#tagkey:tagvalue\n")
+
+	dog.SetSampleType(metrics.SampleHistogram)
+	dog.AddSample([]string{"sample", "thing"}, float32(4))
+	assertServerMatchesExpected(t, server, buf, "sample.thing:4|h\n")
+
+	dog.SetSampleType(metrics.SampleDistribution)
+	dog.AddSample([]string{"sample", "thing"}, float32(4))
+	assertServerMatchesExpected(t, server, buf, "sample.thing:4|d\n")
+}
+
+func TestDeltaGauges(t *testing.T) {
+	server, buf := setupTestServerAndBuffer(t)
+	defer func() { _ = server.Close() }()
+
+	dog := mockNewDogStatsdSink(DogStatsdAddr, EmptyTags, HostnameDisabled)
+
+	// Gauges only set aren't tracked
+	dog.SetGauge([]string{"pool", "size"}, float32(4))
+	assertServerMatchesExpected(t, server, buf, "pool.size:4|g\n")
+	if dog.hasDeltaGauges.Load() {
+		t.Fatalf("gauge tracked without AddGauge")
+	}
+
+	dog.AddGauge([]string{"queue", "depth"}, float32(2))
+	assertServerMatchesExpected(t, server, buf, "queue.depth:2|g\n")
+	if _, ok := dog.deltaGauges.Load(gaugeID("queue.depth", nil)); !ok {
+		t.Fatalf("gauge not tracked")
+	}
+
+	// The gauges expire without updates
+	dog.sweep(time.Now().Add(2 * deltaGaugeExpiration))
+	if _, ok := dog.deltaGauges.Load(gaugeID("queue.depth", nil)); ok {
+		t.Fatalf("gauge not expired")
+	}
+}
+
 func assertServerMatchesExpected(t *testing.T, server *net.UDPConn, buf []byte, expected string) {
 	t.Helper()
 	n, _ := server.Read(buf)
@@ -167,4 +223,26 @@ func assertServerMatchesExpected(t *testing.T, server *net.UDPConn, buf []byte,
 func TestMetricSinkInterface(t *testing.T) {
 	var dd *DogStatsdSink
 	_ = metrics.MetricSink(dd)
+	_ = metrics.GaugeDeltaMetricSink(dd)
+	_ = metrics.SetMetricSink(dd)
+}
+
+func FuzzDogStatsd_SingleLine(f *testing.F) {
+	f.Add("count", "me", "tagkey", "tagvalue")
+	f.Add("a:b", "c|d", "e,f", "#g\nh")
+	f.Add("a@b", " ", "\r", "\x00\xff")
+	dog := &DogStatsdSink{hostName: TestHostname, encoder: defaultEncoder}
+	f.Fuzz(func(t *testing.T, k1, k2, name, value string) {
+		flatKey, tags, ok := dog.getFlatkeyAndCombinedLabels([]string{k1, k2}, []metrics.Label{{Name: name, Value: value}})
+		if !ok {
+			t.Fatalf("metric was dropped")
+		}
+		line := flatKey + ":1|c|#" + strings.Join(tags, ",") + "\n"
+		if strings.Count(line, "\n") != 1 || strings.Count(line, "|") != 2 || strings.Count(line, "|#") != 1 {
+			t.Fatalf("corrupt line: %q", line)
+		}
+		if len(tags) != 1 || strings.Count(tags[0], ":") > 1 || strings.Contains(tags[0], ",") {
+			t.Fatalf("corrupt tags: %q", tags)
+		}
+	})
 }
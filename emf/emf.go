@@ -0,0 +1,378 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+// CloudWatch Embedded Metric Format Sink
+
+package emf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+)
+
+const (
+	// maxMetrics is the maximum number of metrics in a document
+	maxMetrics = 100
+
+	// maxValues is the maximum number of values of a metric in a document
+	maxValues = 100
+
+	// maxDimensions is the maximum number of dimensions in a dimension set
+	maxDimensions = 30
+)
+
+var (
+	// DefaultEMFOpts is the default set of options used when creating an
+	// EMFSink.
+	DefaultEMFOpts = EMFOpts{
+		Namespace: "go-metrics",
+		Interval:  time.Minute,
+	}
+)
+
+// EMFOpts is used to configure the EMF Sink
+type EMFOpts struct {
+	// Writer is where the documents are written, one per line, os.Stdout
+	// if nil. In Lambda and ECS, the standard output is shipped to
+	// CloudWatch Logs, which extracts the metrics.
+	Writer io.Writer
+
+	// Namespace is the CloudWatch namespace of the metrics
+	Namespace string
+
+	// Interval is how often the metrics are aggregated and written
+	Interval time.Duration
+
+	// DimensionSets are the sets of label names the metrics are dimensioned
+	// by. A set only applies to the series having all its labels, and an
+	// empty set aggregates the series regardless of their labels. If nil,
+	// every series is dimensioned by all its labels, up to 30. The labels
+	// that aren't dimensions are written as properties, which can be
+	// searched in CloudWatch Logs Insights.
+	DimensionSets [][]string
+
+	// Units are the CloudWatch units of the metrics by name, such as
+	// "Milliseconds" or "Count"
+	Units map[string]string
+
+	// HighResolution stores the metrics with a 1 second resolution rather
+	// than 1 minute
+	HighResolution bool
+
+	// KeyFormatter names the metrics, by default the parts of the key are
+	// joined with '.'
+	KeyFormatter metrics.KeyFormatter
+}
+
+// EMFSink aggregates metrics, and writes them on an interval as CloudWatch
+// Embedded Metric Format documents:
+//
+//   - Gauges and keys: the last value
+//   - Counters: the sum of the interval
+//   - Samples: their distinct values and how many times each was added, so
+//     that CloudWatch computes the statistics and percentiles. Samples with
+//     more than 100 distinct values in an interval are written as their
+//     minimum, maximum, sum and count only.
+//
+// Labels become dimensions, see EMFOpts.DimensionSets. As the dimension
+// values and the metrics share the members of a document, a label named
+// like its metric is dropped.
+type EMFSink struct {
+	writer         io.Writer
+	namespace      string
+	dimensionSets  [][]string
+	units          map[string]string
+	highResolution bool
+	formatter      metrics.KeyFormatter
+	aggregator     *metrics.IntervalAggregator
+}
+
+// NewEMFSink creates a new EMFSink writing to the standard output, using
+// the default options.
+func NewEMFSink() (*EMFSink, error) {
+	return NewEMFSinkFrom(DefaultEMFOpts)
+}
+
+// NewEMFSinkFrom creates a new EMFSink using the passed options.
+func NewEMFSinkFrom(opts EMFOpts) (*EMFSink, error) {
+	for _, set := range opts.DimensionSets {
+		if len(set) > maxDimensions {
+			return nil, fmt.Errorf("dimension set %v has more than %d dimensions", set, maxDimensions)
+		}
+	}
+
+	writer := opts.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = DefaultEMFOpts.Namespace
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultEMFOpts.Interval
+	}
+
+	s := &EMFSink{
+		writer:         writer,
+		namespace:      namespace,
+		dimensionSets:  opts.DimensionSets,
+		units:          opts.Units,
+		highResolution: opts.HighResolution,
+		formatter:      opts.KeyFormatter,
+	}
+	s.aggregator = metrics.NewIntervalAggregator(metrics.IntervalAggregatorOpts{
+		Interval:  interval,
+		MaxValues: maxValues,
+		Flush:     s.write,
+	})
+	return s, nil
+}
+
+// SetGauge sets value for a gauge metric
+func (s *EMFSink) SetGauge(key []string, val float32) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), nil)
+}
+
+// SetGaugeWithLabels sets value for a gauge metric with the given labels
+func (s *EMFSink) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), labels)
+}
+
+// SetPrecisionGauge sets value for a gauge metric with float64 precision
+func (s *EMFSink) SetPrecisionGauge(key []string, val float64) {
+	s.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+// SetPrecisionGaugeWithLabels sets value for a gauge metric with the given
+// labels and float64 precision
+func (s *EMFSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []metrics.Label) {
+	s.add(metrics.SeriesGauge, key, val, labels)
+}
+
+// EmitKey is written as a gauge
+func (s *EMFSink) EmitKey(key []string, val float32) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), nil)
+}
+
+// IncrCounter increments a counter metric
+func (s *EMFSink) IncrCounter(key []string, val float32) {
+	s.IncrCounterWithLabels(key, val, nil)
+}
+
+// IncrCounterWithLabels increments a counter metric with the given labels
+func (s *EMFSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.add(metrics.SeriesCounter, key, float64(val), labels)
+}
+
+// AddSample adds a sample to a metric
+func (s *EMFSink) AddSample(key []string, val float32) {
+	s.AddSampleWithLabels(key, val, nil)
+}
+
+// AddSampleWithLabels adds a sample to a metric with the given labels
+func (s *EMFSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.add(metrics.SeriesSample, key, float64(val), labels)
+}
+
+// add adds a value to the series of the given kind, key and labels. JSON
+// can't hold NaN and infinite values, so the aggregator drops them. The
+// labels and the metric are members of the same document, so the labels
+// named like the metric are dropped, as is the "_aws" name reserved for
+// the metadata.
+func (s *EMFSink) add(kind metrics.SeriesKind, key []string, val float64, labels []metrics.Label) {
+	name := s.flattenKey(key)
+	kept := make([]metrics.Label, 0, len(labels))
+	for _, label := range labels {
+		if label.Name != "_aws" && label.Name != name {
+			kept = append(kept, label)
+		}
+	}
+	s.aggregator.Add(kind, name, kept, val)
+}
+
+// Flush writes the metrics aggregated since the previous flush now
+func (s *EMFSink) Flush() {
+	s.aggregator.Flush()
+}
+
+// Shutdown stops the sink, and blocks while writing the metrics one last
+// time.
+func (s *EMFSink) Shutdown() {
+	s.aggregator.Shutdown()
+}
+
+// write writes the documents of the series aggregated over an interval
+func (s *EMFSink) write(series []*metrics.IntervalSeries, now time.Time) {
+	for _, doc := range s.documents(series, now) {
+		line, err := json.Marshal(doc)
+		if err != nil {
+			log.Printf("[ERR] Error encoding EMF document! Err: %s", err)
+			continue
+		}
+		if _, err := s.writer.Write(append(line, '\n')); err != nil {
+			log.Printf("[ERR] Error writing EMF document! Err: %s", err)
+		}
+	}
+}
+
+// documents builds the documents of the aggregated series. The series with
+// the same labels share documents, as the values of the dimensions are
+// properties of the documents.
+func (s *EMFSink) documents(series []*metrics.IntervalSeries, now time.Time) []map[string]any {
+	groups := make(map[string][]*metrics.IntervalSeries)
+	for _, ser := range series {
+		id := labelsID(ser.Labels)
+		groups[id] = append(groups[id], ser)
+	}
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var docs []map[string]any
+	for _, id := range ids {
+		group := groups[id]
+		labels := group[0].Labels
+		dimensions := s.dimensions(labels)
+
+		var doc map[string]any
+		var dir *directive
+		newDoc := func() {
+			dir = &directive{Namespace: s.namespace, Dimensions: dimensions}
+			doc = map[string]any{
+				"_aws": metadata{
+					Timestamp:         now.UnixMilli(),
+					CloudWatchMetrics: []*directive{dir},
+				},
+			}
+			for _, label := range labels {
+				doc[label.Name] = label.Value
+			}
+			docs = append(docs, doc)
+		}
+		add := func(name string, value any) {
+			if _, ok := doc[name]; doc == nil || ok || len(dir.Metrics) == maxMetrics {
+				newDoc()
+			}
+			dir.Metrics = append(dir.Metrics, metricDefinition{
+				Name:              name,
+				Unit:              s.units[name],
+				StorageResolution: s.storageResolution(),
+			})
+			doc[name] = value
+		}
+
+		for _, ser := range group {
+			if ser.Kind != metrics.SeriesSample {
+				add(ser.Name, ser.Value)
+				continue
+			}
+			if ser.Values != nil {
+				add(ser.Name, valueCounts{Values: ser.Values, Counts: ser.Counts})
+			} else {
+				add(ser.Name, statisticSet{Max: ser.Max, Min: ser.Min, Sum: ser.Sum, Count: ser.Count})
+			}
+		}
+	}
+	return docs
+}
+
+// dimensions returns the dimension sets of a series with the given labels
+func (s *EMFSink) dimensions(labels []metrics.Label) [][]string {
+	if s.dimensionSets == nil {
+		set := make([]string, 0, min(len(labels), maxDimensions))
+		for _, label := range labels[:min(len(labels), maxDimensions)] {
+			set = append(set, label.Name)
+		}
+		return [][]string{set}
+	}
+
+	names := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		names[label.Name] = true
+	}
+	sets := [][]string{}
+	for _, set := range s.dimensionSets {
+		applies := true
+		for _, name := range set {
+			applies = applies && names[name]
+		}
+		if applies {
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+func (s *EMFSink) storageResolution() int {
+	if s.highResolution {
+		return 1
+	}
+	return 0
+}
+
+// flattenKey names the metric with the sink's KeyFormatter, if any
+func (s *EMFSink) flattenKey(parts []string) string {
+	if s.formatter != nil {
+		return s.formatter.FormatKey(parts)
+	}
+	return strings.Join(parts, ".")
+}
+
+// metadata is the "_aws" member of a document
+type metadata struct {
+	Timestamp         int64        `json:"Timestamp"`
+	CloudWatchMetrics []*directive `json:"CloudWatchMetrics"`
+}
+
+// directive tells CloudWatch which members of a document are metrics, and
+// which are their dimensions
+type directive struct {
+	Namespace  string             `json:"Namespace"`
+	Dimensions [][]string         `json:"Dimensions"`
+	Metrics    []metricDefinition `json:"Metrics"`
+}
+
+// valueCounts is a sample as its distinct values and how many times each
+// was added
+type valueCounts struct {
+	Values []float64 `json:"Values"`
+	Counts []int     `json:"Counts"`
+}
+
+// statisticSet is a sample with too many distinct values to be written
+// as values
+type statisticSet struct {
+	Max   float64 `json:"Max"`
+	Min   float64 `json:"Min"`
+	Sum   float64 `json:"Sum"`
+	Count int     `json:"Count"`
+}
+
+type metricDefinition struct {
+	Name              string `json:"Name"`
+	Unit              string `json:"Unit,omitempty"`
+	StorageResolution int    `json:"StorageResolution,omitempty"`
+}
+
+// labelsID identifies the labels of a series. Every string is prefixed by
+// its length, so that values holding the separators can't make two sets of
+// labels collide.
+func labelsID(labels []metrics.Label) string {
+	var b strings.Builder
+	for _, label := range labels {
+		fmt.Fprintf(&b, ";%d:%s=%d:%s", len(label.Name), label.Name, len(label.Value), label.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,228 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package emf
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+)
+
+// document is a decoded EMF document
+type document struct {
+	AWS struct {
+		Timestamp         int64
+		CloudWatchMetrics []directive
+	} `json:"_aws"`
+	Members map[string]any `json:"-"`
+}
+
+func newTestSink(t *testing.T, opts EMFOpts) (*EMFSink, *bytes.Buffer) {
+	var buf bytes.Buffer
+	opts.Writer = &buf
+	opts.Interval = time.Hour
+	s, err := NewEMFSinkFrom(opts)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	t.Cleanup(s.Shutdown)
+	return s, &buf
+}
+
+func decode(t *testing.T, buf *bytes.Buffer) []document {
+	t.Helper()
+	var docs []document
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var doc document
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := json.Unmarshal([]byte(line), &doc.Members); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if d := time.Since(time.UnixMilli(doc.AWS.Timestamp)); d < 0 || d > time.Minute {
+			t.Fatalf("bad timestamp: %d", doc.AWS.Timestamp)
+		}
+		docs = append(docs, doc)
+	}
+	buf.Reset()
+	return docs
+}
+
+func TestEMFSink(t *testing.T) {
+	s, buf := newTestSink(t, EMFOpts{
+		Namespace:      "app",
+		Units:          map[string]string{"http.latency": "Milliseconds"},
+		HighResolution: true,
+	})
+
+	labels := []metrics.Label{{Name: "method", Value: "GET"}, {Name: "code", Value: "200"}}
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1, labels)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 2, labels)
+	s.AddSampleWithLabels([]string{"http", "latency"}, 5, labels)
+	s.AddSampleWithLabels([]string{"http", "latency"}, 7, labels)
+	s.AddSampleWithLabels([]string{"http", "latency"}, 5, labels)
+	s.SetGauge([]string{"pool", "size"}, 4)
+	s.SetGauge([]string{"pool", "size"}, 5)
+	s.Flush()
+
+	docs := decode(t, buf)
+	if len(docs) != 2 {
+		t.Fatalf("bad documents: %v", docs)
+	}
+
+	// The series without labels come first
+	expect := []directive{{
+		Namespace:  "app",
+		Dimensions: [][]string{{}},
+		Metrics:    []metricDefinition{{Name: "pool.size", StorageResolution: 1}},
+	}}
+	if !reflect.DeepEqual(docs[0].AWS.CloudWatchMetrics, expect) || docs[0].Members["pool.size"] != 5.0 {
+		t.Fatalf("bad document: %v", docs[0])
+	}
+
+	expect = []directive{{
+		Namespace:  "app",
+		Dimensions: [][]string{{"code", "method"}},
+		Metrics: []metricDefinition{
+			{Name: "http.latency", Unit: "Milliseconds", StorageResolution: 1},
+			{Name: "http.requests", StorageResolution: 1},
+		},
+	}}
+	members := map[string]any{
+		"code":          "200",
+		"method":        "GET",
+		"http.latency":  map[string]any{"Values": []any{5.0, 7.0}, "Counts": []any{2.0, 1.0}},
+		"http.requests": 3.0,
+	}
+	delete(docs[1].Members, "_aws")
+	if !reflect.DeepEqual(docs[1].AWS.CloudWatchMetrics, expect) || !reflect.DeepEqual(docs[1].Members, members) {
+		t.Fatalf("bad document: %v", docs[1])
+	}
+
+	// Metrics are aggregated per interval
+	s.Flush()
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected documents: %s", buf)
+	}
+}
+
+func TestEMFSink_DimensionSets(t *testing.T) {
+	s, buf := newTestSink(t, EMFOpts{
+		DimensionSets: [][]string{{"service"}, {"service", "method"}, {"region"}, {}},
+	})
+	s.IncrCounterWithLabels([]string{"requests"}, 1, []metrics.Label{
+		{Name: "service", Value: "api"},
+		{Name: "method", Value: "GET"},
+		{Name: "request_id", Value: "abc"},
+	})
+	s.Flush()
+
+	docs := decode(t, buf)
+	if len(docs) != 1 {
+		t.Fatalf("bad documents: %v", docs)
+	}
+	expect := [][]string{{"service"}, {"service", "method"}, {}}
+	if got := docs[0].AWS.CloudWatchMetrics[0].Dimensions; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad dimensions: %v", got)
+	}
+	// Labels that aren't dimensions are kept as properties
+	if docs[0].Members["request_id"] != "abc" {
+		t.Fatalf("missing property: %v", docs[0].Members)
+	}
+}
+
+func TestEMFSink_LabelNamedLikeMetric(t *testing.T) {
+	s, buf := newTestSink(t, EMFOpts{})
+	s.SetGaugeWithLabels([]string{"queue"}, 3, []metrics.Label{
+		{Name: "queue", Value: "jobs"},
+		{Name: "region", Value: "eu"},
+	})
+	s.Flush()
+
+	docs := decode(t, buf)
+	if len(docs) != 1 {
+		t.Fatalf("bad documents: %v", docs)
+	}
+	// The metric keeps its value, the colliding label isn't a dimension
+	if docs[0].Members["queue"] != 3.0 || docs[0].Members["region"] != "eu" {
+		t.Fatalf("bad members: %v", docs[0].Members)
+	}
+	if got := docs[0].AWS.CloudWatchMetrics[0].Dimensions; !reflect.DeepEqual(got, [][]string{{"region"}}) {
+		t.Fatalf("bad dimensions: %v", got)
+	}
+}
+
+func TestEMFSink_LabelsCollision(t *testing.T) {
+	s, buf := newTestSink(t, EMFOpts{})
+	s.SetGaugeWithLabels([]string{"queue"}, 1, []metrics.Label{{Name: "x", Value: "1;y=2"}})
+	s.SetGaugeWithLabels([]string{"pool"}, 2, []metrics.Label{
+		{Name: "x", Value: "1"},
+		{Name: "y", Value: "2"},
+	})
+	s.Flush()
+
+	// Values holding the separators don't merge the documents
+	docs := decode(t, buf)
+	if len(docs) != 2 {
+		t.Fatalf("bad documents: %v", docs)
+	}
+	for _, doc := range docs {
+		if _, ok := doc.Members["y"]; ok == (doc.Members["queue"] != nil) {
+			t.Fatalf("bad members: %v", doc.Members)
+		}
+	}
+}
+
+func TestEMFSink_Limits(t *testing.T) {
+	s, buf := newTestSink(t, EMFOpts{})
+	for i := 0; i < 150; i++ {
+		s.AddSample([]string{"latency"}, float32(i))
+	}
+	for i := 0; i < maxMetrics+1; i++ {
+		s.SetGauge([]string{"gauge", strconv.Itoa(i)}, 1)
+	}
+	// A gauge and a counter with the same name can't share a document
+	s.IncrCounter([]string{"gauge", "0"}, 1)
+	s.Flush()
+
+	docs := decode(t, buf)
+	var metrics int
+	var latency any
+	for _, doc := range docs {
+		dir := doc.AWS.CloudWatchMetrics[0]
+		if len(dir.Metrics) > maxMetrics {
+			t.Fatalf("too many metrics: %d", len(dir.Metrics))
+		}
+		metrics += len(dir.Metrics)
+		if v, ok := doc.Members["latency"]; ok {
+			latency = v
+		}
+	}
+	if metrics != maxMetrics+3 || len(docs) != 3 {
+		t.Fatalf("bad documents: %d metrics in %d documents", metrics, len(docs))
+	}
+
+	// Samples with too many distinct values are written as statistics
+	expect := map[string]any{"Max": 149.0, "Min": 0.0, "Sum": 11175.0, "Count": 150.0}
+	if !reflect.DeepEqual(latency, expect) {
+		t.Fatalf("bad latency: %v", latency)
+	}
+}
+
+func TestNewEMFSinkFrom_Errors(t *testing.T) {
+	set := make([]string, maxDimensions+1)
+	for i := range set {
+		set[i] = strconv.Itoa(i)
+	}
+	if _, err := NewEMFSinkFrom(EMFOpts{DimensionSets: [][]string{set}}); err == nil {
+		t.Fatalf("expected error for too many dimensions")
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EscapePolicy decides what a LineEncoder does with keys and labels that
+// contain characters which are not safe for its wire format.
+type EscapePolicy int
+
+const (
+	// EscapeReplace replaces every unsafe character with an underscore.
+	EscapeReplace EscapePolicy = iota
+
+	// EscapeDrop silently drops any metric with an unsafe key or label.
+	EscapeDrop
+
+	// EscapeError drops any metric with an unsafe key or label and reports
+	// it to the encoder's error handler.
+	EscapeError
+)
+
+// WireFormat lists the characters a line based protocol reserves in metric
+// keys, label names and label values. Whitespace, control characters and
+// invalid UTF-8 are always unsafe, regardless of the format.
+type WireFormat struct {
+	Name               string
+	KeyReserved        string
+	LabelNameReserved  string
+	LabelValueReserved string
+}
+
+var (
+	// StatsdFormat is the statsd/statsite line format used by StatsdSink
+	// and StatsiteSink: "key:value|type".
+	StatsdFormat = WireFormat{
+		Name:               "statsd",
+		KeyReserved:        ":|@",
+		LabelNameReserved:  ":|@",
+		LabelValueReserved: ":|@",
+	}
+
+	// DogStatsdFormat is the DogStatsD extension to the statsd format, where
+	// tags follow as "|#name:value,name:value".
+	DogStatsdFormat = WireFormat{
+		Name:               "dogstatsd",
+		KeyReserved:        ":|@",
+		LabelNameReserved:  ":|,#",
+		LabelValueReserved: ":|,#",
+	}
+)
+
+// LineEncoder validates and escapes metric keys and labels so that a single
+// metric can never produce more than one line in a line based wire format.
+type LineEncoder struct {
+	format       WireFormat
+	policy       EscapePolicy
+	errorHandler func(error)
+}
+
+// NewLineEncoder creates a LineEncoder for the given wire format. The
+// errorHandler is only called when policy is EscapeError, and may be nil.
+func NewLineEncoder(format WireFormat, policy EscapePolicy, errorHandler func(error)) *LineEncoder {
+	return &LineEncoder{
+		format:       format,
+		policy:       policy,
+		errorHandler: errorHandler,
+	}
+}
+
+// Format returns the wire format of the encoder.
+func (e *LineEncoder) Format() WireFormat {
+	return e.format
+}
+
+// EncodeKey returns the escaped flattened key. It returns false if the
+// metric must be dropped.
+func (e *LineEncoder) EncodeKey(key string) (string, bool) {
+	return e.encode("key", key, e.format.KeyReserved)
+}
+
+// EncodeLabelName returns the escaped label name. It returns false if the
+// metric must be dropped.
+func (e *LineEncoder) EncodeLabelName(name string) (string, bool) {
+	return e.encode("label name", name, e.format.LabelNameReserved)
+}
+
+// EncodeLabelValue returns the escaped label value. It returns false if the
+// metric must be dropped.
+func (e *LineEncoder) EncodeLabelValue(value string) (string, bool) {
+	return e.encode("label value", value, e.format.LabelValueReserved)
+}
+
+func (e *LineEncoder) encode(kind, s, reserved string) (string, bool) {
+	if isWireSafe(s, reserved) {
+		return s, true
+	}
+
+	switch e.policy {
+	case EscapeDrop:
+		return "", false
+	case EscapeError:
+		if e.errorHandler != nil {
+			e.errorHandler(fmt.Errorf("metric %s %q contains characters not allowed in the %s format",
+				kind, s, e.format.Name))
+		}
+		return "", false
+	}
+
+	return strings.Map(func(r rune) rune {
+		if isWireUnsafe(r, reserved) {
+			return '_'
+		}
+		return r
+	}, s), true
+}
+
+// isWireSafe reports whether s can be written as is
+func isWireSafe(s, reserved string) bool {
+	for _, r := range s {
+		if isWireUnsafe(r, reserved) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWireUnsafe reports whether r must not appear in a key or label. Decoding
+// invalid UTF-8 yields utf8.RuneError, so invalid input is caught here too.
+func isWireUnsafe(r rune, reserved string) bool {
+	return r == utf8.RuneError || unicode.IsSpace(r) || unicode.IsControl(r) ||
+		strings.ContainsRune(reserved, r)
+}
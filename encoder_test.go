@@ -0,0 +1,72 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"testing"
+)
+
+func TestLineEncoder_Replace(t *testing.T) {
+	enc := NewLineEncoder(StatsdFormat, EscapeReplace, nil)
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"a.b.c", "a.b.c"},
+		{"slow thingy", "slow_thingy"},
+		{"a:b|c@d", "a_b_c_d"},
+		{"line\nbreak\r", "line_break_"},
+		{"tab\there", "tab_here"},
+		{"bad\xffutf8", "bad_utf8"},
+		{"ünïcode", "ünïcode"},
+	} {
+		out, ok := enc.EncodeKey(tc.in)
+		if !ok {
+			t.Fatalf("%q was dropped", tc.in)
+		}
+		if out != tc.out {
+			t.Fatalf("expected %q, got %q", tc.out, out)
+		}
+	}
+
+	dog := NewLineEncoder(DogStatsdFormat, EscapeReplace, nil)
+	if out, _ := dog.EncodeLabelValue("a,b#c|d"); out != "a_b_c_d" {
+		t.Fatalf("bad value %q", out)
+	}
+	if out, _ := dog.EncodeKey("a,b#c"); out != "a,b#c" {
+		t.Fatalf("bad key %q", out)
+	}
+}
+
+func TestLineEncoder_Drop(t *testing.T) {
+	enc := NewLineEncoder(StatsdFormat, EscapeDrop, nil)
+	if out, ok := enc.EncodeKey("a.b"); !ok || out != "a.b" {
+		t.Fatalf("safe key was changed: %q %v", out, ok)
+	}
+	if _, ok := enc.EncodeKey("a|b"); ok {
+		t.Fatalf("unsafe key was not dropped")
+	}
+	if _, ok := enc.EncodeLabelValue("a\nb"); ok {
+		t.Fatalf("unsafe label value was not dropped")
+	}
+}
+
+func TestLineEncoder_Error(t *testing.T) {
+	var errs []error
+	enc := NewLineEncoder(DogStatsdFormat, EscapeError, func(err error) {
+		errs = append(errs, err)
+	})
+	if _, ok := enc.EncodeLabelName("a.b"); !ok {
+		t.Fatalf("safe name was dropped")
+	}
+	if _, ok := enc.EncodeLabelName("a,b"); ok {
+		t.Fatalf("unsafe name was not dropped")
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	expect := `metric label name "a,b" contains characters not allowed in the dogstatsd format`
+	if errs[0].Error() != expect {
+		t.Fatalf("bad error %q", errs[0])
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ExpvarSinkOpts is used to configure an ExpvarSink
+type ExpvarSinkOpts struct {
+	// Name is the expvar the metrics are published as, "metrics" if empty
+	Name string
+
+	// Interval is how long the metrics are aggregated for, 10 seconds if
+	// zero
+	Interval time.Duration
+
+	// KeyFormatter names the metrics, by default the parts of the key are
+	// joined with '.'
+	KeyFormatter KeyFormatter
+}
+
+// ExpvarSink provides a MetricSink that publishes the metrics with the
+// expvar package, so that they are served with the other variables under
+// /debug/vars. The metrics are aggregated by an InmemSink, and the published
+// variable is the most recent finished interval, or the current one if no
+// interval has finished yet, like InmemSink.DisplayMetrics.
+//
+// The variable is a JSON object with the "interval" start time and the
+// "gauges", "points", "counters" and "samples" of that interval, each keyed
+// by the metric name and labels. Gauges have a "value", counters and samples
+// have their "count", "rate", "sum", "min", "max", "mean" and "stddev".
+type ExpvarSink struct {
+	*InmemSink
+}
+
+// expvarSeries is a series of the published variable
+type expvarSeries struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Value any `json:"value,omitempty"`
+
+	Count  int `json:"count,omitempty"`
+	Rate   any `json:"rate,omitempty"`
+	Sum    any `json:"sum,omitempty"`
+	Min    any `json:"min,omitempty"`
+	Max    any `json:"max,omitempty"`
+	Mean   any `json:"mean,omitempty"`
+	Stddev any `json:"stddev,omitempty"`
+}
+
+// expvarSummary is the published variable
+type expvarSummary struct {
+	Interval time.Time               `json:"interval"`
+	Gauges   map[string]expvarSeries `json:"gauges"`
+	Points   map[string][]float32    `json:"points"`
+	Counters map[string]expvarSeries `json:"counters"`
+	Samples  map[string]expvarSeries `json:"samples"`
+}
+
+// NewExpvarSink creates an ExpvarSink, and publishes it. As expvar can't
+// remove a variable, the sink is published for the life of the process,
+// and creating two sinks with the same name is an error.
+func NewExpvarSink(opts ExpvarSinkOpts) (*ExpvarSink, error) {
+	if opts.Name == "" {
+		opts.Name = "metrics"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if expvar.Get(opts.Name) != nil {
+		return nil, fmt.Errorf("expvar %q is already published", opts.Name)
+	}
+
+	// The previous interval is the one published
+	s := &ExpvarSink{InmemSink: NewInmemSink(opts.Interval, 2*opts.Interval)}
+	s.SetKeyFormatter(opts.KeyFormatter)
+	expvar.Publish(opts.Name, s)
+	return s, nil
+}
+
+// String returns the published metrics as JSON, implementing expvar.Var
+func (s *ExpvarSink) String() string {
+	data := s.Data()
+	interval := data[len(data)-1]
+	if len(data) > 1 {
+		interval = data[len(data)-2]
+	}
+
+	interval.RLock()
+	summary := expvarSummary{
+		Interval: interval.Interval.UTC(),
+		Gauges:   make(map[string]expvarSeries, len(interval.Gauges)+len(interval.PrecisionGauges)),
+		Points:   make(map[string][]float32, len(interval.Points)),
+		Counters: make(map[string]expvarSeries, len(interval.Counters)),
+		Samples:  make(map[string]expvarSeries, len(interval.Samples)),
+	}
+	for k, g := range interval.Gauges {
+		summary.Gauges[k] = expvarSeries{Name: g.Name, Labels: labelMap(g.Labels), Value: expvarFloat(float64(g.Value))}
+	}
+	for k, g := range interval.PrecisionGauges {
+		summary.Gauges[k] = expvarSeries{Name: g.Name, Labels: labelMap(g.Labels), Value: expvarFloat(g.Value)}
+	}
+	for k, points := range interval.Points {
+		summary.Points[k] = append([]float32(nil), points...)
+	}
+	for k, c := range interval.Counters {
+		summary.Counters[k] = newExpvarAggregate(c)
+	}
+	for k, sample := range interval.Samples {
+		summary.Samples[k] = newExpvarAggregate(sample)
+	}
+	interval.RUnlock()
+
+	buf, err := json.Marshal(summary)
+	if err != nil {
+		// Only the points may not be encoded
+		summary.Points = nil
+		buf, _ = json.Marshal(summary)
+	}
+	return string(buf)
+}
+
+// newExpvarAggregate returns the series of a counter or sample
+func newExpvarAggregate(v SampledValue) expvarSeries {
+	return expvarSeries{
+		Name:   v.Name,
+		Labels: labelMap(v.Labels),
+		Count:  v.Count,
+		Rate:   expvarFloat(v.Rate),
+		Sum:    expvarFloat(v.Sum),
+		Min:    expvarFloat(v.Min),
+		Max:    expvarFloat(v.Max),
+		Mean:   expvarFloat(v.AggregateSample.Mean()),
+		Stddev: expvarFloat(v.AggregateSample.Stddev()),
+	}
+}
+
+// expvarFloat returns v, or its name if JSON can't encode it
+func expvarFloat(v float64) any {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprint(v)
+	}
+	return v
+}
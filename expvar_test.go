@@ -0,0 +1,116 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpvarSink(t *testing.T) {
+	start := time.Now()
+	s, err := NewExpvarSink(ExpvarSinkOpts{Name: "TestExpvarSink", Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	labels := []Label{{"method", "GET"}}
+	s.SetGauge([]string{"pool", "size"}, 4)
+	s.SetGauge([]string{"pool", "size"}, 5)
+	s.SetPrecisionGaugeWithLabels([]string{"ratio"}, math.NaN(), labels)
+	s.EmitKey([]string{"event"}, 2)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1, labels)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 2, labels)
+	s.AddSample([]string{"http", "latency"}, 1)
+	s.AddSample([]string{"http", "latency"}, 3)
+
+	// The sink is served with the other variables
+	resp := httptest.NewRecorder()
+	expvar.Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(vars["TestExpvarSink"], &got); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The test may run across an hour boundary
+	interval, err := time.Parse(time.RFC3339, got["interval"].(string))
+	if err != nil || !interval.Equal(start.Truncate(time.Hour)) && !interval.Equal(time.Now().Truncate(time.Hour)) {
+		t.Fatalf("bad interval: %v", got["interval"])
+	}
+	delete(got, "interval")
+
+	// The current interval is published until one has finished
+	expect := map[string]any{
+		"gauges": map[string]any{
+			"pool.size":        map[string]any{"name": "pool.size", "value": 5.0},
+			"ratio;method=GET": map[string]any{"name": "ratio", "labels": map[string]any{"method": "GET"}, "value": "NaN"},
+		},
+		"points": map[string]any{"event": []any{2.0}},
+		"counters": map[string]any{
+			"http.requests;method=GET": map[string]any{
+				"name": "http.requests", "labels": map[string]any{"method": "GET"},
+				"count": 2.0, "rate": 3.0 / 3600, "sum": 3.0, "min": 1.0, "max": 2.0, "mean": 1.5, "stddev": math.Sqrt(0.5),
+			},
+		},
+		"samples": map[string]any{
+			"http.latency": map[string]any{
+				"name":  "http.latency",
+				"count": 2.0, "rate": 4.0 / 3600, "sum": 4.0, "min": 1.0, "max": 3.0, "mean": 2.0, "stddev": math.Sqrt(2),
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad vars: %v", got)
+	}
+}
+
+func TestExpvarSink_Interval(t *testing.T) {
+	s, err := NewExpvarSink(ExpvarSinkOpts{Name: "TestExpvarSink_Interval", Interval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	decode := func() map[string]any {
+		var got map[string]any
+		if err := json.Unmarshal([]byte(s.String()), &got); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return got
+	}
+
+	s.IncrCounter([]string{"requests"}, 1)
+	first := decode()["interval"]
+
+	// The finished interval is published once the next one has started
+	time.Sleep(20 * time.Millisecond)
+	got := decode()
+	if got["interval"] != first || len(got["counters"].(map[string]any)) != 1 {
+		t.Fatalf("bad vars: %v", got)
+	}
+
+	// The metrics are reset every interval
+	time.Sleep(20 * time.Millisecond)
+	got = decode()
+	if got["interval"] == first || len(got["counters"].(map[string]any)) != 0 {
+		t.Fatalf("bad vars: %v", got)
+	}
+}
+
+func TestNewExpvarSink_Duplicate(t *testing.T) {
+	if _, err := NewExpvarSink(ExpvarSinkOpts{Name: "TestNewExpvarSink_Duplicate"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := NewExpvarSink(ExpvarSinkOpts{Name: "TestNewExpvarSink_Duplicate"}); err == nil {
+		t.Fatalf("expected error for duplicate name")
+	}
+}
@@ -0,0 +1,602 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fileRotationLayout is the time layout of the rotated file names
+	fileRotationLayout = "20060102T150405.000000000"
+)
+
+// FileSyncPolicy is when the FileSink syncs the file to the disk
+type FileSyncPolicy int
+
+const (
+	// FileSyncNever leaves it to the operating system
+	FileSyncNever FileSyncPolicy = iota
+
+	// FileSyncAlways syncs after every write, which is slow but loses
+	// nothing on a crash
+	FileSyncAlways
+
+	// FileSyncPeriodic syncs every SyncInterval
+	FileSyncPeriodic
+)
+
+// FileSinkOpts is used to configure the FileSink
+type FileSinkOpts struct {
+	// Path is the file the metrics are appended to
+	Path string
+
+	// Interval is how often the metrics are aggregated and written, as one
+	// object per series. If zero, every metric is written as it is
+	// emitted.
+	Interval time.Duration
+
+	// MaxSize rotates the file once writing would make it larger than
+	// MaxSize bytes, if set
+	MaxSize int64
+
+	// RotateEvery rotates the file once it has been open for that long,
+	// if set
+	RotateEvery time.Duration
+
+	// MaxBackups is the number of rotated files kept, if set. The oldest
+	// ones are removed.
+	MaxBackups int
+
+	// Compress gzips the rotated files
+	Compress bool
+
+	// Sync is when the file is synced to the disk. SyncInterval is the
+	// period of FileSyncPeriodic, 1 second if zero.
+	Sync         FileSyncPolicy
+	SyncInterval time.Duration
+
+	// KeyFormatter names the metrics, by default the parts of the key are
+	// joined with '.'
+	KeyFormatter KeyFormatter
+}
+
+// NewFileSinkFromURL creates a FileSink from a URL. It is used (and tested)
+// from NewMetricSinkFromURL.
+func NewFileSinkFromURL(u *url.URL) (MetricSink, error) {
+	params := u.Query()
+	opts := FileSinkOpts{Path: u.Host + u.Path}
+	if u.Opaque != "" {
+		opts.Path = u.Opaque
+	}
+
+	durations := map[string]*time.Duration{
+		"interval":      &opts.Interval,
+		"rotate_every":  &opts.RotateEvery,
+		"sync_interval": &opts.SyncInterval,
+	}
+	for name, d := range durations {
+		if value := params.Get(name); value != "" {
+			var err error
+			if *d, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("bad '%s' param: %s", name, err)
+			}
+		}
+	}
+	if size := params.Get("max_size"); size != "" {
+		var err error
+		if opts.MaxSize, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return nil, fmt.Errorf("bad 'max_size' param: %s", err)
+		}
+	}
+	if backups := params.Get("max_backups"); backups != "" {
+		var err error
+		if opts.MaxBackups, err = strconv.Atoi(backups); err != nil {
+			return nil, fmt.Errorf("bad 'max_backups' param: %s", err)
+		}
+	}
+	if compress := params.Get("compress"); compress != "" {
+		var err error
+		if opts.Compress, err = strconv.ParseBool(compress); err != nil {
+			return nil, fmt.Errorf("bad 'compress' param: %s", err)
+		}
+	}
+	switch policy := params.Get("sync"); policy {
+	case "", "never":
+	case "always":
+		opts.Sync = FileSyncAlways
+	case "periodic":
+		opts.Sync = FileSyncPeriodic
+	default:
+		return nil, fmt.Errorf("bad 'sync' param: unknown policy: %q", policy)
+	}
+	if name := params.Get("key_format"); name != "" {
+		var err error
+		if opts.KeyFormatter, err = ParseKeyFormatter(name); err != nil {
+			return nil, fmt.Errorf("bad 'key_format' param: %s", err)
+		}
+	}
+	return NewFileSink(opts)
+}
+
+// filePoint is a metric queued for the writer
+type filePoint struct {
+	time   time.Time
+	kind   SeriesKind
+	name   string
+	labels []Label
+	value  float64
+}
+
+// fileRecord is a line of the file. The value of a gauge is its last
+// value, of a counter its sum. Samples have statistics instead.
+type fileRecord struct {
+	Time   time.Time         `json:"time"`
+	Type   string            `json:"type"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  *float64          `json:"value,omitempty"`
+	Count  *int              `json:"count,omitempty"`
+	Sum    *float64          `json:"sum,omitempty"`
+	Min    *float64          `json:"min,omitempty"`
+	Max    *float64          `json:"max,omitempty"`
+	Mean   *float64          `json:"mean,omitempty"`
+}
+
+// FileSink provides a MetricSink that appends the metrics to a file as JSON
+// lines, to keep a local history where no metrics backend can run. Each
+// line is an object with the "time", "type", "name" and "labels" of a
+// metric. Gauges and counters have a "value", samples have it too if
+// written as they are emitted, or "count", "sum", "min", "max" and "mean"
+// if aggregated.
+//
+// The file can be rotated by size or age. Rotated files are renamed with
+// the time of the rotation inserted before the extension, such as
+// metrics.20260102T150405.000000000.jsonl, and optionally gzipped.
+type FileSink struct {
+	opts FileSinkOpts
+
+	// aggregator aggregates the metrics if an interval is set, otherwise
+	// they are queued for the writer goroutine
+	aggregator  *IntervalAggregator
+	metricQueue chan filePoint
+
+	// The file is only used by the writer goroutine, or by the aggregator
+	// flushes
+	file     *os.File
+	buffered *bufio.Writer
+	size     int64
+	opened   time.Time
+	synced   time.Time
+
+	// shutdownLock guards metricQueue so that no metric is pushed once
+	// Shutdown has closed it. doneCh is closed by the writer once the
+	// queue has been drained and the file closed.
+	shutdownLock sync.RWMutex
+	shutdown     bool
+	doneCh       chan struct{}
+
+	// The rotated files are compressed and removed on separate goroutines,
+	// which backupsLock serializes, so that writing isn't held up.
+	// Shutdown waits for them with backupsWg.
+	backupsLock sync.Mutex
+	backupsWg   sync.WaitGroup
+}
+
+// NewFileSink is used to create a new FileSink. The file is created if
+// needed, and appended to otherwise.
+func NewFileSink(opts FileSinkOpts) (*FileSink, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("no file path")
+	}
+	switch opts.Sync {
+	case FileSyncNever, FileSyncAlways, FileSyncPeriodic:
+	default:
+		return nil, fmt.Errorf("unknown sync policy: %d", opts.Sync)
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+
+	s := &FileSink{
+		opts:        opts,
+		metricQueue: make(chan filePoint, 4096),
+		doneCh:      make(chan struct{}),
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	if opts.Interval > 0 {
+		s.aggregator = NewIntervalAggregator(IntervalAggregatorOpts{
+			Interval: opts.Interval,
+			Flush:    s.writeSeries,
+			Close:    s.close,
+		})
+		return s, nil
+	}
+	go s.writeMetrics()
+	return s, nil
+}
+
+// Shutdown stops accepting new metrics, then blocks until the queued metrics
+// have been written and the file closed, or until shutdownTimeout has
+// elapsed.
+func (s *FileSink) Shutdown() {
+	if s.aggregator != nil {
+		s.aggregator.Shutdown()
+		s.waitBackups()
+		return
+	}
+
+	s.shutdownLock.Lock()
+	if s.shutdown {
+		s.shutdownLock.Unlock()
+		return
+	}
+	s.shutdown = true
+	close(s.metricQueue)
+	s.shutdownLock.Unlock()
+
+	select {
+	case <-s.doneCh:
+		s.waitBackups()
+	case <-time.After(shutdownTimeout):
+		log.Printf("[WARN] Timed out flushing metrics to %s during shutdown", s.opts.Path)
+	}
+}
+
+// waitBackups waits for the rotated files to be compressed and removed, or
+// until shutdownTimeout has elapsed
+func (s *FileSink) waitBackups() {
+	done := make(chan struct{})
+	go func() {
+		s.backupsWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		log.Printf("[WARN] Timed out compressing the rotated files of %s during shutdown", s.opts.Path)
+	}
+}
+
+func (s *FileSink) SetGauge(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *FileSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesGauge, key, float64(val), labels)
+}
+
+func (s *FileSink) SetPrecisionGauge(key []string, val float64) {
+	s.pushMetric(SeriesGauge, key, val, nil)
+}
+
+func (s *FileSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	s.pushMetric(SeriesGauge, key, val, labels)
+}
+
+func (s *FileSink) EmitKey(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *FileSink) IncrCounter(key []string, val float32) {
+	s.pushMetric(SeriesCounter, key, float64(val), nil)
+}
+
+func (s *FileSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesCounter, key, float64(val), labels)
+}
+
+func (s *FileSink) AddSample(key []string, val float32) {
+	s.pushMetric(SeriesSample, key, float64(val), nil)
+}
+
+func (s *FileSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesSample, key, float64(val), labels)
+}
+
+// Does a non-blocking push to the metrics queue, or adds the metric to the
+// aggregator. Metrics are dropped once the sink has been shut down. JSON
+// can't hold NaN and infinite values, so they are dropped too.
+func (s *FileSink) pushMetric(kind SeriesKind, key []string, val float64, labels []Label) {
+	name := formatKey(s.opts.KeyFormatter, key)
+	if s.aggregator != nil {
+		s.aggregator.Add(kind, name, labels, val)
+		return
+	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return
+	}
+	p := filePoint{
+		time:   time.Now(),
+		kind:   kind,
+		name:   name,
+		labels: append([]Label(nil), labels...),
+		value:  val,
+	}
+
+	s.shutdownLock.RLock()
+	defer s.shutdownLock.RUnlock()
+	if s.shutdown {
+		return
+	}
+	select {
+	case s.metricQueue <- p:
+	default:
+	}
+}
+
+// Writes the queued metrics as they are emitted
+func (s *FileSink) writeMetrics() {
+	defer close(s.doneCh)
+	defer s.close()
+
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+
+	var syncCh <-chan time.Time
+	if s.opts.Sync == FileSyncPeriodic {
+		syncTicker := time.NewTicker(s.opts.SyncInterval)
+		defer syncTicker.Stop()
+		syncCh = syncTicker.C
+	}
+
+	for {
+		select {
+		case p, ok := <-s.metricQueue:
+			if !ok {
+				// The queue has been closed and drained
+				return
+			}
+			value := p.value
+			s.write(fileRecord{Time: p.time, Type: p.kind.String(), Name: p.name, Labels: labelMap(p.labels), Value: &value})
+		case <-flushTicker.C:
+			if err := s.buffered.Flush(); err != nil {
+				log.Printf("[ERR] Error writing to %s! Err: %s", s.opts.Path, err)
+			}
+		case <-syncCh:
+			s.sync()
+		}
+	}
+}
+
+// writeSeries writes the series aggregated over an interval, one line per
+// series
+func (s *FileSink) writeSeries(series []*IntervalSeries, now time.Time) {
+	for _, ser := range series {
+		r := fileRecord{Time: now, Type: ser.Kind.String(), Name: ser.Name, Labels: labelMap(ser.Labels)}
+		switch ser.Kind {
+		case SeriesGauge, SeriesCounter:
+			r.Value = &ser.Value
+		case SeriesSample:
+			mean := ser.Mean()
+			r.Count, r.Sum, r.Min, r.Max, r.Mean = &ser.Count, &ser.Sum, &ser.Min, &ser.Max, &mean
+		}
+		s.write(r)
+	}
+
+	if s.opts.Sync == FileSyncPeriodic && time.Since(s.synced) >= s.opts.SyncInterval {
+		s.sync()
+	} else if s.file != nil {
+		if err := s.buffered.Flush(); err != nil {
+			log.Printf("[ERR] Error writing to %s! Err: %s", s.opts.Path, err)
+		}
+	}
+}
+
+// write appends a line to the file, rotating it first if needed
+func (s *FileSink) write(r fileRecord) {
+	line, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("[ERR] Error encoding metric for %s! Err: %s", s.opts.Path, err)
+		return
+	}
+	line = append(line, '\n')
+
+	if s.shouldRotate(int64(len(line))) {
+		if err := s.rotate(); err != nil {
+			log.Printf("[ERR] Error rotating %s! Err: %s", s.opts.Path, err)
+		}
+	}
+	if s.file == nil {
+		return
+	}
+	n, err := s.buffered.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		log.Printf("[ERR] Error writing to %s! Err: %s", s.opts.Path, err)
+		return
+	}
+	if s.opts.Sync == FileSyncAlways {
+		s.sync()
+	}
+}
+
+func (s *FileSink) shouldRotate(n int64) bool {
+	if s.file == nil {
+		// Opening the file failed, retry with a new one
+		return true
+	}
+	if s.opts.MaxSize > 0 && s.size > 0 && s.size+n > s.opts.MaxSize {
+		return true
+	}
+	return s.opts.RotateEvery > 0 && time.Since(s.opened) >= s.opts.RotateEvery
+}
+
+// open opens the file for appending
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	s.file = file
+	s.buffered = bufio.NewWriter(file)
+	s.size = info.Size()
+	s.opened = time.Now()
+	return nil
+}
+
+// close flushes and closes the file
+func (s *FileSink) close() {
+	if s.file == nil {
+		return
+	}
+	if err := s.buffered.Flush(); err != nil {
+		log.Printf("[ERR] Error writing to %s! Err: %s", s.opts.Path, err)
+	}
+	if s.opts.Sync != FileSyncNever {
+		_ = s.file.Sync()
+	}
+	if err := s.file.Close(); err != nil {
+		log.Printf("[ERR] Error closing %s! Err: %s", s.opts.Path, err)
+	}
+	s.file = nil
+}
+
+// sync flushes the buffer and syncs the file to the disk
+func (s *FileSink) sync() {
+	if s.file == nil {
+		return
+	}
+	if err := s.buffered.Flush(); err != nil {
+		log.Printf("[ERR] Error writing to %s! Err: %s", s.opts.Path, err)
+		return
+	}
+	if err := s.file.Sync(); err != nil {
+		log.Printf("[ERR] Error syncing %s! Err: %s", s.opts.Path, err)
+	}
+	s.synced = time.Now()
+}
+
+// rotate renames the file and opens a new file. The rotated file is then
+// compressed, and the oldest rotated files removed, as configured, on a
+// separate goroutine.
+func (s *FileSink) rotate() error {
+	if s.file != nil {
+		s.close()
+		ext := filepath.Ext(s.opts.Path)
+		rotated := strings.TrimSuffix(s.opts.Path, ext) + "." + time.Now().UTC().Format(fileRotationLayout) + ext
+		if err := os.Rename(s.opts.Path, rotated); err != nil {
+			return err
+		}
+		s.backupsWg.Add(1)
+		go s.processBackup(rotated)
+	}
+	return s.open()
+}
+
+// processBackup compresses a rotated file and removes the oldest rotated
+// files, as configured
+func (s *FileSink) processBackup(rotated string) {
+	defer s.backupsWg.Done()
+	s.backupsLock.Lock()
+	defer s.backupsLock.Unlock()
+
+	if s.opts.Compress {
+		if err := gzipFile(rotated); err != nil {
+			log.Printf("[ERR] Error compressing %s! Err: %s", rotated, err)
+		}
+	}
+	s.removeBackups()
+}
+
+// removeBackups removes the oldest rotated files beyond MaxBackups
+func (s *FileSink) removeBackups() {
+	if s.opts.MaxBackups <= 0 {
+		return
+	}
+	backups, err := s.backups()
+	if err != nil {
+		log.Printf("[ERR] Error listing the rotated files of %s! Err: %s", s.opts.Path, err)
+		return
+	}
+	for len(backups) > s.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			log.Printf("[ERR] Error removing %s! Err: %s", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// backups returns the rotated files, oldest first
+func (s *FileSink) backups() ([]string, error) {
+	dir, name := filepath.Split(s.opts.Path)
+	prefix := strings.TrimSuffix(name, filepath.Ext(name)) + "."
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		// Only the files named after a rotation time are backups
+		stamp, _, _ := strings.Cut(strings.TrimPrefix(entry.Name(), prefix), ".")
+		if _, err := time.Parse("20060102T150405", stamp); err == nil {
+			backups = append(backups, filepath.Join(dir, entry.Name()))
+		}
+	}
+	// The time stamps sort chronologically
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// gzipFile compresses path to path.gz, and removes path
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func labelMap(labels []Label) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(labels))
+	for _, label := range labels {
+		m[label.Name] = label.Value
+	}
+	return m
+}
@@ -0,0 +1,286 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFileRecords decodes the JSON lines of a file, without their time
+func readFileRecords(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		r = zr
+	}
+
+	var records []map[string]any
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, record["time"].(string)); err != nil {
+			t.Fatalf("bad time: %v", err)
+		}
+		delete(record, "time")
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return records
+}
+
+func TestFileSink_Events(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	s, err := NewFileSink(FileSinkOpts{Path: path, Sync: FileSyncAlways})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.SetGaugeWithLabels([]string{"pool", "size"}, 4, []Label{{"pool", "db"}})
+	s.IncrCounter([]string{"http", "requests"}, 1)
+	s.IncrCounter([]string{"http", "requests"}, 2)
+	s.AddSample([]string{"http", "latency"}, 5)
+	s.Shutdown()
+
+	expect := []map[string]any{
+		{"type": "gauge", "name": "pool.size", "value": 4.0, "labels": map[string]any{"pool": "db"}},
+		{"type": "counter", "name": "http.requests", "value": 1.0},
+		{"type": "counter", "name": "http.requests", "value": 2.0},
+		{"type": "sample", "name": "http.latency", "value": 5.0},
+	}
+	if records := readFileRecords(t, path); !reflect.DeepEqual(records, expect) {
+		t.Fatalf("bad records: %v", records)
+	}
+
+	// Metrics are dropped once the sink is shut down
+	s.IncrCounter([]string{"http", "requests"}, 1)
+}
+
+func TestFileSink_Interval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	s, err := NewFileSink(FileSinkOpts{Path: path, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.SetGauge([]string{"pool", "size"}, 4)
+	s.SetGauge([]string{"pool", "size"}, 5)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1, []Label{{"method", "GET"}})
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 2, []Label{{"method", "GET"}})
+	s.AddSample([]string{"http", "latency"}, 1)
+	s.AddSample([]string{"http", "latency"}, 3)
+	s.Shutdown()
+
+	expect := []map[string]any{
+		{"type": "sample", "name": "http.latency", "count": 2.0, "sum": 4.0, "min": 1.0, "max": 3.0, "mean": 2.0},
+		{"type": "counter", "name": "http.requests", "value": 3.0, "labels": map[string]any{"method": "GET"}},
+		{"type": "gauge", "name": "pool.size", "value": 5.0},
+	}
+	if records := readFileRecords(t, path); !reflect.DeepEqual(records, expect) {
+		t.Fatalf("bad records: %v", records)
+	}
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.jsonl")
+
+	// The file is appended to
+	if err := os.WriteFile(path, []byte(`{"time":"2026-01-02T15:04:05Z","type":"gauge","name":"old","value":1}`+"\n"), 0o644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	s, err := NewFileSink(FileSinkOpts{
+		Path:       path,
+		MaxSize:    100,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		s.IncrCounter([]string{"requests"}, float32(i))
+	}
+	s.Shutdown()
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("bad backups: %v", backups)
+	}
+
+	// Every line is in its own file, the oldest ones have been removed
+	var values []float64
+	for _, backup := range append(backups, path) {
+		if backup != path && !strings.HasSuffix(backup, ".jsonl.gz") {
+			t.Fatalf("bad backup name: %s", backup)
+		}
+		records := readFileRecords(t, backup)
+		if len(records) != 1 {
+			t.Fatalf("bad records in %s: %v", backup, records)
+		}
+		values = append(values, records[0]["value"].(float64))
+	}
+	if !reflect.DeepEqual(values, []float64{2, 3, 4}) {
+		t.Fatalf("bad values: %v", values)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(matches)
+	if len(matches) != 3 {
+		t.Fatalf("bad files: %v", matches)
+	}
+}
+
+func TestFileSink_RotateEvery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics")
+	s, err := NewFileSink(FileSinkOpts{Path: path, RotateEvery: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.IncrCounter([]string{"requests"}, 1)
+	s.IncrCounter([]string{"requests"}, 2)
+	s.Shutdown()
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// The first rotation is of the empty file
+	if len(backups) != 2 {
+		t.Fatalf("bad backups: %v", backups)
+	}
+	if records := readFileRecords(t, path); len(records) != 1 || records[0]["value"] != 2.0 {
+		t.Fatalf("bad records: %v", records)
+	}
+}
+
+func TestFileSink_BackupsGlobPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "[metrics]*")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	path := filepath.Join(dir, "metrics?.jsonl")
+	s, err := NewFileSink(FileSinkOpts{Path: path, MaxSize: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		s.IncrCounter([]string{"requests"}, float32(i))
+	}
+	s.Shutdown()
+
+	// Glob metacharacters in the path don't hide the rotated files
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(backups) != 1 || filepath.Dir(backups[0]) != dir {
+		t.Fatalf("bad backups: %v", backups)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("bad files: %v", entries)
+	}
+}
+
+func TestNewFileSinkFromURL(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	for _, tc := range []struct {
+		desc      string
+		input     string
+		expect    FileSinkOpts
+		expectErr string
+	}{
+		{
+			desc:   "path only",
+			input:  "file://" + dir + "/metrics.jsonl",
+			expect: FileSinkOpts{Path: dir + "/metrics.jsonl", SyncInterval: time.Second},
+		},
+		{
+			desc: "all params",
+			input: "file://" + dir + "/metrics.jsonl?interval=10s&max_size=1024&rotate_every=1h" +
+				"&max_backups=3&compress=true&sync=periodic&sync_interval=5s",
+			expect: FileSinkOpts{
+				Path:         dir + "/metrics.jsonl",
+				Interval:     10 * time.Second,
+				MaxSize:      1024,
+				RotateEvery:  time.Hour,
+				MaxBackups:   3,
+				Compress:     true,
+				Sync:         FileSyncPeriodic,
+				SyncInterval: 5 * time.Second,
+			},
+		},
+		{
+			desc:      "bad max_size",
+			input:     "file://" + dir + "/metrics.jsonl?max_size=big",
+			expectErr: "bad 'max_size' param",
+		},
+		{
+			desc:      "bad sync",
+			input:     "file://" + dir + "/metrics.jsonl?sync=sometimes",
+			expectErr: "bad 'sync' param",
+		},
+		{
+			desc:      "no path",
+			input:     "file://",
+			expectErr: "no file path",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			u, err := url.Parse(tc.input)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			ms, err := NewFileSinkFromURL(u)
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expected err: %v to contain: %q", err, tc.expectErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			s := ms.(*FileSink)
+			s.Shutdown()
+			if !reflect.DeepEqual(s.opts, tc.expect) {
+				t.Fatalf("bad opts: %#v", s.opts)
+			}
+		})
+	}
+}
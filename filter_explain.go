@@ -0,0 +1,314 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxDryRunKeys bounds the number of distinct keys recorded by a filter
+// dry run
+const maxDryRunKeys = 1000
+
+// FilterRule is the kind of filter rule that decided whether a metric is
+// allowed
+type FilterRule int
+
+const (
+	// FilterRuleDefault means that no prefix matched, and FilterDefault
+	// applied.
+	FilterRuleDefault FilterRule = iota
+
+	// FilterRuleAllowedPrefix means that the longest matching prefix is one
+	// of AllowedPrefixes.
+	FilterRuleAllowedPrefix
+
+	// FilterRuleBlockedPrefix means that the longest matching prefix is one
+	// of BlockedPrefixes.
+	FilterRuleBlockedPrefix
+
+	// FilterRuleLabelFilter means that a LabelFilter blocked the metric.
+	FilterRuleLabelFilter
+)
+
+func (r FilterRule) String() string {
+	switch r {
+	case FilterRuleDefault:
+		return "default"
+	case FilterRuleAllowedPrefix:
+		return "allowed prefix"
+	case FilterRuleBlockedPrefix:
+		return "blocked prefix"
+	case FilterRuleLabelFilter:
+		return "label filter"
+	default:
+		return "unknown"
+	}
+}
+
+// FilterExplanation describes how the filters handle a metric
+type FilterExplanation struct {
+	// Allowed is whether the metric is sent to the sink
+	Allowed bool
+
+	// Rule is the kind of rule that decided
+	Rule FilterRule
+
+	// Prefix is the longest matching prefix, if any. It is set even if a
+	// label filter blocked the metric afterwards.
+	Prefix string
+
+	// LabelFilter is the label filter that blocked the metric, if Rule is
+	// FilterRuleLabelFilter
+	LabelFilter *LabelFilter
+
+	// Labels are the labels sent to the sink
+	Labels []Label
+
+	// DroppedLabels are the names of the labels removed by AllowedLabels
+	// and BlockedLabels
+	DroppedLabels []string
+}
+
+// FilterRuleHits is the number of metrics decided by a filter rule since
+// the rule was set
+type FilterRuleHits struct {
+	Rule        FilterRule
+	Prefix      string       // For prefix rules
+	LabelFilter *LabelFilter // For label filters
+	Hits        uint64
+}
+
+// FilterDryRunReport is what a proposed set of filter rules would have
+// changed, for the metrics seen since the dry run started
+type FilterDryRunReport struct {
+	// Evaluated is the number of metrics checked against the proposed rules
+	Evaluated uint64
+
+	// WouldBlock is the number of allowed metrics the rules would block
+	WouldBlock uint64
+
+	// WouldAllow is the number of blocked metrics the rules would allow
+	WouldAllow uint64
+
+	// BlockedKeys counts the metrics the rules would block, by key. At
+	// most 1000 distinct keys are recorded.
+	BlockedKeys map[string]uint64
+
+	// DroppedLabels counts the labels the rules would remove from metrics
+	// that are allowed either way, by label name.
+	DroppedLabels map[string]uint64
+}
+
+// prefixRule is the value of a prefix in the filter tree
+type prefixRule struct {
+	allow bool
+	hits  atomic.Uint64
+}
+
+// filterMatch is the result of matching a metric against the filters
+type filterMatch struct {
+	allowed     bool
+	prefix      []byte
+	prefixRule  *prefixRule
+	labelFilter *labelFilter
+}
+
+// hit increments the counter of the rule that decided
+func (f *filterMatch) hit(defaultHits *atomic.Uint64) {
+	switch {
+	case f.labelFilter != nil:
+		f.labelFilter.hits.Add(1)
+	case f.prefixRule != nil:
+		f.prefixRule.hits.Add(1)
+	default:
+		defaultHits.Add(1)
+	}
+}
+
+func (f *filterMatch) rule() FilterRule {
+	switch {
+	case f.labelFilter != nil:
+		return FilterRuleLabelFilter
+	case f.prefixRule != nil && f.prefixRule.allow:
+		return FilterRuleAllowedPrefix
+	case f.prefixRule != nil:
+		return FilterRuleBlockedPrefix
+	default:
+		return FilterRuleDefault
+	}
+}
+
+// matchFilter matches the metric against the prefix and label filters
+// the caller should lock m.filterLock while calling this method
+func (m *Metrics) matchFilter(key []string, labels []Label) filterMatch {
+	match := filterMatch{allowed: m.FilterDefault}
+	noPrefixFilter := m.filter == nil || m.filter.Len() == 0
+	if noPrefixFilter && m.labelFilter == nil {
+		return match
+	}
+
+	flatKey := []byte(strings.Join(key, "."))
+	if !noPrefixFilter {
+		if prefix, v, ok := m.filter.Root().LongestPrefix(flatKey); ok {
+			match.prefix = prefix
+			match.prefixRule = v.(*prefixRule)
+			match.allowed = match.prefixRule.allow
+		}
+	}
+	if match.allowed && m.labelFilter != nil {
+		match.labelFilter = m.blockingLabelFilter(flatKey, labels)
+		match.allowed = match.labelFilter == nil
+	}
+	return match
+}
+
+// ExplainFilter returns how the filters handle a metric, without counting
+// it in the rule hits. The key is matched as is, so it must include the
+// service name and type prefix if they are enabled.
+func (m *Metrics) ExplainFilter(key []string, labels []Label) FilterExplanation {
+	m.filterLock.RLock()
+	defer m.filterLock.RUnlock()
+
+	match := m.matchFilter(key, labels)
+	explanation := FilterExplanation{
+		Allowed: match.allowed,
+		Rule:    match.rule(),
+		Labels:  m.sinkLabels(labels),
+	}
+	if match.prefixRule != nil {
+		explanation.Prefix = string(match.prefix)
+	}
+	if match.labelFilter != nil {
+		conf := match.labelFilter.conf
+		explanation.LabelFilter = &conf
+	}
+	for _, label := range labels {
+		if !m.labelIsAllowed(&label) {
+			explanation.DroppedLabels = append(explanation.DroppedLabels, label.Name)
+		}
+	}
+	return explanation
+}
+
+// FilterHits returns the number of metrics decided by each filter rule,
+// starting with FilterDefault, then the prefix rules in lexical order and
+// the label filters in order. The counters restart when the rules are
+// updated. Metrics are only counted if CountFilterHits is set, since every
+// metric then updates a shared counter.
+func (m *Metrics) FilterHits() []FilterRuleHits {
+	m.filterLock.RLock()
+	defer m.filterLock.RUnlock()
+
+	hits := []FilterRuleHits{{Rule: FilterRuleDefault, Hits: m.defaultHits.Load()}}
+	if m.filter != nil {
+		m.filter.Root().Walk(func(prefix []byte, v any) bool {
+			rule := v.(*prefixRule)
+			h := FilterRuleHits{Rule: FilterRuleBlockedPrefix, Prefix: string(prefix), Hits: rule.hits.Load()}
+			if rule.allow {
+				h.Rule = FilterRuleAllowedPrefix
+			}
+			hits = append(hits, h)
+			return false
+		})
+	}
+	for _, f := range m.labelFilters {
+		conf := f.conf
+		hits = append(hits, FilterRuleHits{Rule: FilterRuleLabelFilter, LabelFilter: &conf, Hits: f.hits.Load()})
+	}
+	return hits
+}
+
+// filterDryRun evaluates proposed filter rules next to the current ones
+type filterDryRun struct {
+	// proposed holds the proposed rules, its sink is never used
+	proposed *Metrics
+
+	lock   sync.Mutex
+	report FilterDryRunReport
+}
+
+// StartFilterDryRun evaluates the given rules, with the same arguments as
+// UpdateFilterAndLabels, against every metric from now on without applying
+// them. It replaces any previous dry run. The report is returned by
+// FilterDryRunReport.
+func (m *Metrics) StartFilterDryRun(allow, block, allowedLabels, blockedLabels []string) {
+	m.filterLock.RLock()
+	proposed := &Metrics{Config: m.Config}
+	m.filterLock.RUnlock()
+	proposed.CountFilterHits = false
+
+	proposed.UpdateFilterAndLabels(allow, block, allowedLabels, blockedLabels)
+	proposed.UpdateLabelFilters(proposed.LabelFilters)
+	m.dryRun.Store(&filterDryRun{
+		proposed: proposed,
+		report: FilterDryRunReport{
+			BlockedKeys:   make(map[string]uint64),
+			DroppedLabels: make(map[string]uint64),
+		},
+	})
+}
+
+// StopFilterDryRun stops the current dry run and returns its report
+func (m *Metrics) StopFilterDryRun() (FilterDryRunReport, bool) {
+	dryRun := m.dryRun.Swap(nil)
+	if dryRun == nil {
+		return FilterDryRunReport{}, false
+	}
+	return dryRun.snapshot(), true
+}
+
+// FilterDryRunReport returns the report of the current dry run, or false
+// if there is none
+func (m *Metrics) FilterDryRunReport() (FilterDryRunReport, bool) {
+	dryRun := m.dryRun.Load()
+	if dryRun == nil {
+		return FilterDryRunReport{}, false
+	}
+	return dryRun.snapshot(), true
+}
+
+// record evaluates a metric against the proposed rules. allowed and sent
+// are the result of the current rules.
+func (d *filterDryRun) record(key []string, labels []Label, allowed bool, sent []Label) {
+	proposedAllowed, proposedSent := d.proposed.allowMetric(key, labels)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.report.Evaluated++
+	switch {
+	case allowed && !proposedAllowed:
+		d.report.WouldBlock++
+		flatKey := strings.Join(key, ".")
+		if _, ok := d.report.BlockedKeys[flatKey]; ok || len(d.report.BlockedKeys) < maxDryRunKeys {
+			d.report.BlockedKeys[flatKey]++
+		}
+	case !allowed && proposedAllowed:
+		d.report.WouldAllow++
+	case allowed:
+	SENT:
+		for _, label := range sent {
+			for _, kept := range proposedSent {
+				if kept.Name == label.Name {
+					continue SENT
+				}
+			}
+			d.report.DroppedLabels[label.Name]++
+		}
+	}
+}
+
+func (d *filterDryRun) snapshot() FilterDryRunReport {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	report := d.report
+	report.BlockedKeys = maps.Clone(d.report.BlockedKeys)
+	report.DroppedLabels = maps.Clone(d.report.DroppedLabels)
+	return report
+}
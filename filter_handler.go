@@ -0,0 +1,204 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxFilterConfigSize bounds the size of a filter config sent to the
+// FilterHandler
+const maxFilterConfigSize = 1 << 20
+
+// FilterConfig is the filter configuration of a Metrics, as read and written
+// by the FilterHandler
+type FilterConfig struct {
+	FilterDefault   bool
+	AllowedPrefixes []string
+	BlockedPrefixes []string
+	AllowedLabels   []string
+	BlockedLabels   []string
+	LabelFilters    []LabelFilter
+}
+
+// Validate returns an error if a prefix or label name is empty, or if it is
+// both allowed and blocked, or if a label filter has no label name.
+func (c *FilterConfig) Validate() error {
+	var errs []error
+	check := func(kind string, allowed, blocked []string) {
+		allow := make(map[string]struct{}, len(allowed))
+		for _, v := range allowed {
+			if v == "" {
+				errs = append(errs, fmt.Errorf("empty allowed %s", kind))
+			}
+			allow[v] = struct{}{}
+		}
+		for _, v := range blocked {
+			if v == "" {
+				errs = append(errs, fmt.Errorf("empty blocked %s", kind))
+			} else if _, ok := allow[v]; ok {
+				errs = append(errs, fmt.Errorf("%s %q is both allowed and blocked", kind, v))
+			}
+		}
+	}
+	check("prefix", c.AllowedPrefixes, c.BlockedPrefixes)
+	check("label", c.AllowedLabels, c.BlockedLabels)
+	for _, f := range c.LabelFilters {
+		if f.Name == "" {
+			errs = append(errs, fmt.Errorf("empty label filter name"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FilterConfig returns the current filter configuration, and its version
+// which is incremented by every update.
+func (m *Metrics) FilterConfig() (FilterConfig, uint64) {
+	m.filterLock.RLock()
+	defer m.filterLock.RUnlock()
+
+	// The slices are copied, so that changing them doesn't change the
+	// filter without the lock
+	conf := FilterConfig{
+		FilterDefault:   m.FilterDefault,
+		AllowedPrefixes: slices.Clone(m.AllowedPrefixes),
+		BlockedPrefixes: slices.Clone(m.BlockedPrefixes),
+		AllowedLabels:   slices.Clone(m.AllowedLabels),
+		BlockedLabels:   slices.Clone(m.BlockedLabels),
+		LabelFilters:    slices.Clone(m.LabelFilters),
+	}
+	for i := range conf.LabelFilters {
+		conf.LabelFilters[i].Values = slices.Clone(conf.LabelFilters[i].Values)
+	}
+	return conf, m.filterVersion
+}
+
+// UpdateFilterConfig overwrites the filter configuration if its version is
+// still version, and returns the new version. It fails if the config is
+// not valid, or with ErrFilterVersionMismatch if it was updated since.
+func (m *Metrics) UpdateFilterConfig(conf FilterConfig, version uint64) (uint64, error) {
+	return m.updateFilterConfig(conf, &version)
+}
+
+// updateFilterConfig is UpdateFilterConfig, without the version check if
+// version is nil
+func (m *Metrics) updateFilterConfig(conf FilterConfig, version *uint64) (uint64, error) {
+	if err := conf.Validate(); err != nil {
+		return 0, err
+	}
+
+	m.filterLock.Lock()
+	defer m.filterLock.Unlock()
+
+	if version != nil && *version != m.filterVersion {
+		return 0, ErrFilterVersionMismatch
+	}
+	m.FilterDefault = conf.FilterDefault
+	m.updateFilterAndLabels(conf.AllowedPrefixes, conf.BlockedPrefixes, conf.AllowedLabels, conf.BlockedLabels)
+	m.updateLabelFilters(conf.LabelFilters)
+	return m.filterVersion, nil
+}
+
+// ErrFilterVersionMismatch is returned by UpdateFilterConfig when the filter
+// configuration was updated concurrently
+var ErrFilterVersionMismatch = errors.New("filter config version mismatch")
+
+// FilterHandler is an http.Handler to read and update the filter
+// configuration of a Metrics at runtime, for example to block a noisy
+// metric without a restart.
+//
+// GET returns the FilterConfig as JSON, with its version as the ETag. PUT
+// replaces it with the FilterConfig in the request body. PUT requests must
+// have an If-Match header with the ETag of the config they are based on, or
+// "*" to overwrite it unconditionally, and fail with 412 Precondition Failed
+// if the config was updated since.
+//
+// The handler doesn't do any authentication, it should only be exposed to
+// operators.
+type FilterHandler struct {
+	metrics *Metrics
+}
+
+// NewFilterHandler returns a FilterHandler for m
+func NewFilterHandler(m *Metrics) *FilterHandler {
+	return &FilterHandler{metrics: m}
+}
+
+func (h *FilterHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		conf, version := h.metrics.FilterConfig()
+		h.writeConfig(resp, conf, version)
+
+	case http.MethodPut:
+		// If-Match: * overwrites whatever version is current
+		var version *uint64
+		switch match := req.Header.Get("If-Match"); match {
+		case "":
+			http.Error(resp, "missing If-Match header", http.StatusPreconditionRequired)
+			return
+		case "*":
+		default:
+			v, ok := parseETag(match)
+			if !ok {
+				http.Error(resp, "bad If-Match header", http.StatusBadRequest)
+				return
+			}
+			version = &v
+		}
+
+		var conf FilterConfig
+		dec := json.NewDecoder(http.MaxBytesReader(resp, req.Body, maxFilterConfigSize))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&conf); err != nil {
+			http.Error(resp, fmt.Sprintf("bad filter config: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		newVersion, err := h.metrics.updateFilterConfig(conf, version)
+		if errors.Is(err, ErrFilterVersionMismatch) {
+			http.Error(resp, "filter config was updated concurrently", http.StatusPreconditionFailed)
+			return
+		} else if err != nil {
+			http.Error(resp, fmt.Sprintf("bad filter config: %s", err), http.StatusBadRequest)
+			return
+		}
+		h.writeConfig(resp, conf, newVersion)
+
+	default:
+		resp.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *FilterHandler) writeConfig(resp http.ResponseWriter, conf FilterConfig, version uint64) {
+	// Encode first, so that an error can still be reported
+	buf, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("failed to encode filter config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("ETag", strconv.Quote(strconv.FormatUint(version, 10)))
+	if _, err := resp.Write(append(buf, '\n')); err != nil {
+		log.Printf("[ERR] Error writing filter config! Err: %s", err)
+	}
+}
+
+// parseETag returns the version in an ETag
+func parseETag(etag string) (uint64, bool) {
+	etag = strings.TrimSpace(etag)
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseUint(etag[1:len(etag)-1], 10, 64)
+	return version, err == nil
+}
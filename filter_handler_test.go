@@ -0,0 +1,167 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterConfig_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		conf FilterConfig
+		err  string
+	}{
+		{FilterConfig{AllowedPrefixes: []string{"a"}, BlockedPrefixes: []string{"a.b"}}, ""},
+		{FilterConfig{AllowedPrefixes: []string{""}}, "empty allowed prefix"},
+		{FilterConfig{BlockedLabels: []string{""}}, "empty blocked label"},
+		{FilterConfig{AllowedPrefixes: []string{"a"}, BlockedPrefixes: []string{"a"}}, `prefix "a" is both allowed and blocked`},
+		{FilterConfig{AllowedLabels: []string{"x"}, BlockedLabels: []string{"x"}}, `label "x" is both allowed and blocked`},
+		{FilterConfig{LabelFilters: []LabelFilter{{Values: []string{"x"}}}}, "empty label filter name"},
+	} {
+		err := tc.conf.Validate()
+		if tc.err == "" && err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Fatalf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestMetrics_UpdateFilterConfig(t *testing.T) {
+	m, met := mockMetric()
+	conf, version := met.FilterConfig()
+	if !conf.FilterDefault {
+		t.Fatalf("bad config: %+v", conf)
+	}
+
+	conf = FilterConfig{BlockedPrefixes: []string{"noisy"}, FilterDefault: true}
+	newVersion, err := met.UpdateFilterConfig(conf, version)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if newVersion == version {
+		t.Fatalf("version was not incremented")
+	}
+	if _, err := met.UpdateFilterConfig(conf, version); err != ErrFilterVersionMismatch {
+		t.Fatalf("expected version mismatch, got %v", err)
+	}
+
+	// The returned config is a copy
+	conf, _ = met.FilterConfig()
+	conf.BlockedPrefixes[0] = "quiet"
+
+	met.IncrCounter([]string{"noisy", "key"}, 1)
+	met.IncrCounter([]string{"quiet", "key"}, 1)
+	if len(m.keys) != 1 || m.keys[0][0] != "quiet" {
+		t.Fatalf("bad keys: %v", m.keys)
+	}
+}
+
+func TestMetrics_UpdateFilterConfig_LabelFilters(t *testing.T) {
+	m, met := mockMetric()
+	_, version := met.FilterConfig()
+
+	// Label filters are part of the config and its version
+	met.UpdateLabelFilters([]LabelFilter{{Name: "env", Values: []string{"test"}}})
+	conf, newVersion := met.FilterConfig()
+	if newVersion == version {
+		t.Fatalf("version was not incremented")
+	}
+	if !reflect.DeepEqual(conf.LabelFilters, []LabelFilter{{Name: "env", Values: []string{"test"}}}) {
+		t.Fatalf("bad config: %+v", conf)
+	}
+
+	// The returned config is a copy
+	conf.LabelFilters[0].Values[0] = "prod"
+	conf.LabelFilters = []LabelFilter{{Name: "env", Values: []string{"dev"}}}
+	if _, err := met.UpdateFilterConfig(conf, newVersion); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	met.IncrCounterWithLabels([]string{"a"}, 1, []Label{{"env", "test"}})
+	met.IncrCounterWithLabels([]string{"b"}, 1, []Label{{"env", "dev"}})
+	if len(m.keys) != 1 || m.keys[0][0] != "a" {
+		t.Fatalf("bad keys: %v", m.keys)
+	}
+}
+
+func TestFilterHandler(t *testing.T) {
+	_, met := mockMetric()
+	h := NewFilterHandler(met)
+
+	do := func(method, body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/metrics/filter", strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do("GET", "", "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("bad status: %d", resp.Code)
+	}
+	etag := resp.Header().Get("ETag")
+	var conf FilterConfig
+	if err := json.Unmarshal(resp.Body.Bytes(), &conf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !conf.FilterDefault {
+		t.Fatalf("bad config: %+v", conf)
+	}
+
+	update := `{"FilterDefault": true, "BlockedPrefixes": ["noisy"]}`
+	for _, tc := range []struct {
+		name    string
+		method  string
+		body    string
+		ifMatch string
+		code    int
+	}{
+		{"missing if-match", "PUT", update, "", http.StatusPreconditionRequired},
+		{"bad if-match", "PUT", update, "v1", http.StatusBadRequest},
+		{"stale", "PUT", update, `"12345"`, http.StatusPreconditionFailed},
+		{"unknown field", "PUT", `{"Blocked": ["noisy"]}`, etag, http.StatusBadRequest},
+		{"invalid", "PUT", `{"AllowedPrefixes": ["a"], "BlockedPrefixes": ["a"]}`, etag, http.StatusBadRequest},
+		{"method", "DELETE", "", "", http.StatusMethodNotAllowed},
+	} {
+		if resp := do(tc.method, tc.body, tc.ifMatch); resp.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.code, resp.Code, resp.Body)
+		}
+	}
+	if current, _ := met.FilterConfig(); !reflect.DeepEqual(current, conf) {
+		t.Fatalf("config was modified: %+v", current)
+	}
+
+	resp = do("PUT", update, etag)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("bad status: %d: %s", resp.Code, resp.Body)
+	}
+	if resp.Header().Get("ETag") == etag {
+		t.Fatalf("etag was not updated")
+	}
+	expect := FilterConfig{FilterDefault: true, BlockedPrefixes: []string{"noisy"}}
+	if current, _ := met.FilterConfig(); !reflect.DeepEqual(current, expect) {
+		t.Fatalf("bad config: %+v", current)
+	}
+
+	// The previous etag is now stale, unless overridden
+	if resp := do("PUT", `{}`, etag); resp.Code != http.StatusPreconditionFailed {
+		t.Fatalf("bad status: %d", resp.Code)
+	}
+	if resp := do("PUT", `{}`, "*"); resp.Code != http.StatusOK {
+		t.Fatalf("bad status: %d", resp.Code)
+	}
+	if current, _ := met.FilterConfig(); current.FilterDefault || current.BlockedPrefixes != nil {
+		t.Fatalf("bad config: %+v", current)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// graphitePickleBatch is the maximum number of datapoints in a pickle
+	// message, the default MAX_DATAPOINTS_PER_MESSAGE of Carbon
+	graphitePickleBatch = 500
+
+	// graphiteWriteTimeout bounds every connection and write to Carbon
+	graphiteWriteTimeout = 10 * time.Second
+)
+
+// GraphiteProtocol is the Carbon protocol used by the GraphiteSink
+type GraphiteProtocol int
+
+const (
+	// GraphitePlaintext sends "path value timestamp" lines, usually to
+	// port 2003
+	GraphitePlaintext GraphiteProtocol = iota
+
+	// GraphitePickle sends pickled lists of datapoints, usually to port
+	// 2004
+	GraphitePickle
+)
+
+// GraphiteSinkOpts is used to configure the GraphiteSink
+type GraphiteSinkOpts struct {
+	// Addr is the host:port of the Carbon receiver
+	Addr string
+
+	// Protocol is the Carbon protocol to use
+	Protocol GraphiteProtocol
+
+	// Tagged sends the labels as the tags of a Graphite 1.1 tagged series,
+	// "path;name=value". Otherwise the label values are appended to the
+	// path, in the order of the label names.
+	Tagged bool
+
+	// FlushInterval is how often the metrics are aggregated and sent, 10
+	// seconds if zero. It should match the resolution of the Carbon
+	// storage schema, as Carbon only keeps the last value of each interval.
+	FlushInterval time.Duration
+
+	// KeyFormatter names the series, GraphiteKeyFormatter if nil
+	KeyFormatter KeyFormatter
+}
+
+// NewGraphiteSinkFromURL creates a GraphiteSink from a URL. It is used (and
+// tested) from NewMetricSinkFromURL.
+func NewGraphiteSinkFromURL(u *url.URL) (MetricSink, error) {
+	params := u.Query()
+	opts := GraphiteSinkOpts{Addr: u.Host}
+
+	switch protocol := params.Get("protocol"); protocol {
+	case "", "plaintext":
+	case "pickle":
+		opts.Protocol = GraphitePickle
+	default:
+		return nil, fmt.Errorf("bad 'protocol' param: unknown protocol: %q", protocol)
+	}
+	if tagged := params.Get("tagged"); tagged != "" {
+		var err error
+		if opts.Tagged, err = strconv.ParseBool(tagged); err != nil {
+			return nil, fmt.Errorf("bad 'tagged' param: %s", err)
+		}
+	}
+	if interval := params.Get("flush_interval"); interval != "" {
+		var err error
+		if opts.FlushInterval, err = time.ParseDuration(interval); err != nil {
+			return nil, fmt.Errorf("bad 'flush_interval' param: %s", err)
+		}
+	}
+	if name := params.Get("key_format"); name != "" {
+		var err error
+		if opts.KeyFormatter, err = ParseKeyFormatter(name); err != nil {
+			return nil, fmt.Errorf("bad 'key_format' param: %s", err)
+		}
+	}
+	return NewGraphiteSink(opts)
+}
+
+// graphiteDatapoint is a value sent to Carbon
+type graphiteDatapoint struct {
+	series    string
+	value     float64
+	timestamp int64
+}
+
+// GraphiteSink provides a MetricSink that sends to Carbon, the storage
+// backend of Graphite, over TCP. Carbon stores one value per series and
+// interval rather than events, so metrics are aggregated over the flush
+// interval and sent as:
+//
+//   - Gauges and keys: the last value, at the path
+//   - Counters: the sum of the interval, at the path
+//   - Samples: the count, sum, min, max and mean of the interval, at the
+//     path suffixed with ".count", ".sum", ".min", ".max" and ".mean"
+//
+// Points that can't be sent are dropped, and the connection is opened
+// again for the next flush.
+type GraphiteSink struct {
+	opts       GraphiteSinkOpts
+	aggregator *IntervalAggregator
+
+	// conn is the connection to Carbon, only used by the flushes
+	conn net.Conn
+}
+
+// NewGraphiteSink is used to create a new GraphiteSink
+func NewGraphiteSink(opts GraphiteSinkOpts) (*GraphiteSink, error) {
+	switch opts.Protocol {
+	case GraphitePlaintext, GraphitePickle:
+	default:
+		return nil, fmt.Errorf("unknown Graphite protocol: %d", opts.Protocol)
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	if opts.KeyFormatter == nil {
+		opts.KeyFormatter = GraphiteKeyFormatter
+	}
+
+	s := &GraphiteSink{opts: opts}
+	s.aggregator = NewIntervalAggregator(IntervalAggregatorOpts{
+		Interval: opts.FlushInterval,
+		Flush:    s.write,
+		Close:    s.close,
+	})
+	return s, nil
+}
+
+// Shutdown stops accepting new metrics, then blocks until the aggregated
+// metrics have been sent to Carbon, or until shutdownTimeout has elapsed.
+func (s *GraphiteSink) Shutdown() {
+	s.aggregator.Shutdown()
+}
+
+func (s *GraphiteSink) SetGauge(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *GraphiteSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesGauge, key, float64(val), labels)
+}
+
+func (s *GraphiteSink) SetPrecisionGauge(key []string, val float64) {
+	s.pushMetric(SeriesGauge, key, val, nil)
+}
+
+func (s *GraphiteSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	s.pushMetric(SeriesGauge, key, val, labels)
+}
+
+func (s *GraphiteSink) EmitKey(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *GraphiteSink) IncrCounter(key []string, val float32) {
+	s.pushMetric(SeriesCounter, key, float64(val), nil)
+}
+
+func (s *GraphiteSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesCounter, key, float64(val), labels)
+}
+
+func (s *GraphiteSink) AddSample(key []string, val float32) {
+	s.pushMetric(SeriesSample, key, float64(val), nil)
+}
+
+func (s *GraphiteSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesSample, key, float64(val), labels)
+}
+
+// graphiteSeries returns the path and the sanitized tags of a series. Tags
+// with an empty name or value are dropped as Carbon rejects them. Without
+// tags, the label values are appended to the path in the order of their
+// names.
+func (s *GraphiteSink) graphiteSeries(key []string, labels []Label) (string, []Label) {
+	if !s.opts.Tagged {
+		parts := slices.Clone(key)
+		for _, label := range sortLabels(slices.Clone(labels), LabelLastWins) {
+			if label.Value != "" {
+				parts = append(parts, label.Value)
+			}
+		}
+		return s.opts.KeyFormatter.FormatKey(parts), nil
+	}
+
+	tags := make([]Label, 0, len(labels))
+	for _, label := range labels {
+		if label.Name == "" || label.Value == "" {
+			continue
+		}
+		tags = append(tags, Label{
+			Name:  joinSanitized([]string{label.Name}, "", isGraphiteRune),
+			Value: graphiteTagValue(label.Value),
+		})
+	}
+	return s.opts.KeyFormatter.FormatKey(key), tags
+}
+
+// graphiteTagValue replaces the characters Carbon doesn't accept in a tag
+// value: ';', whitespace which ends the path in the plaintext protocol, and
+// a leading '~'.
+func graphiteTagValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return '_'
+		}
+		return r
+	}, value)
+	if strings.HasPrefix(value, "~") {
+		value = "_" + value[1:]
+	}
+	return value
+}
+
+// pushMetric adds a metric to the aggregator, which drops the NaN and
+// infinite values Carbon doesn't store
+func (s *GraphiteSink) pushMetric(kind SeriesKind, key []string, val float64, labels []Label) {
+	path, tags := s.graphiteSeries(key, labels)
+	s.aggregator.Add(kind, path, tags, val)
+}
+
+// write sends the series aggregated over an interval
+func (s *GraphiteSink) write(series []*IntervalSeries, now time.Time) {
+	var err error
+	if s.conn, err = s.send(s.conn, s.datapoints(series, now)); err != nil {
+		log.Printf("[ERR] Error writing to Graphite! Err: %s", err)
+	}
+}
+
+// close closes the connection once the last series have been sent
+func (s *GraphiteSink) close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+}
+
+// datapoints returns the datapoints of the aggregated series
+func (s *GraphiteSink) datapoints(series []*IntervalSeries, now time.Time) []graphiteDatapoint {
+	timestamp := now.Unix()
+
+	points := make([]graphiteDatapoint, 0, len(series))
+	add := func(ser *IntervalSeries, suffix string, value float64) {
+		path := ser.Name + suffix
+		for _, tag := range ser.Labels {
+			path += ";" + tag.Name + "=" + tag.Value
+		}
+		points = append(points, graphiteDatapoint{
+			series:    path,
+			value:     value,
+			timestamp: timestamp,
+		})
+	}
+	for _, ser := range series {
+		switch ser.Kind {
+		case SeriesGauge, SeriesCounter:
+			add(ser, "", ser.Value)
+		case SeriesSample:
+			add(ser, ".count", float64(ser.Count))
+			add(ser, ".sum", ser.Sum)
+			add(ser, ".min", ser.Min)
+			add(ser, ".max", ser.Max)
+			add(ser, ".mean", ser.Mean())
+		}
+	}
+	return points
+}
+
+// send sends the datapoints with the configured protocol. It returns the
+// connection to use for the next write.
+func (s *GraphiteSink) send(conn net.Conn, points []graphiteDatapoint) (net.Conn, error) {
+	if conn == nil {
+		var err error
+		if conn, err = net.DialTimeout("tcp", s.opts.Addr, graphiteWriteTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf []byte
+	if s.opts.Protocol == GraphitePickle {
+		for batch := range slices.Chunk(points, graphitePickleBatch) {
+			buf = appendGraphitePickle(buf, batch)
+		}
+	} else {
+		for _, p := range points {
+			buf = appendGraphitePlaintext(buf, p)
+		}
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(graphiteWriteTimeout))
+	if _, err := conn.Write(buf); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// appendGraphitePlaintext appends a line of the plaintext protocol
+func appendGraphitePlaintext(buf []byte, p graphiteDatapoint) []byte {
+	buf = append(buf, p.series...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendFloat(buf, p.value, 'f', -1, 64)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, p.timestamp, 10)
+	return append(buf, '\n')
+}
+
+// appendGraphitePickle appends a message of the pickle protocol: the length
+// of the payload as a 4 byte big endian integer, then the payload, a list
+// of (series, (timestamp, value)) tuples pickled with protocol 2.
+func appendGraphitePickle(buf []byte, points []graphiteDatapoint) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+
+	buf = append(buf, 0x80, 2)  // PROTO 2
+	buf = append(buf, ']', '(') // EMPTY_LIST, MARK
+	for _, p := range points {
+		// Carbon fails to unpickle the whole message if a string isn't
+		// valid UTF-8
+		series := strings.ToValidUTF8(p.series, "_")
+		buf = append(buf, 'X') // BINUNICODE
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(series)))
+		buf = append(buf, series...)
+		if p.timestamp >= math.MinInt32 && p.timestamp <= math.MaxInt32 {
+			buf = append(buf, 'J') // BININT
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(p.timestamp)))
+		} else {
+			buf = append(buf, 'G') // BINFLOAT
+			buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(float64(p.timestamp)))
+		}
+		buf = append(buf, 'G') // BINFLOAT
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(p.value))
+		buf = append(buf, 0x86, 0x86) // TUPLE2 (timestamp, value), TUPLE2 (series, datapoint)
+	}
+	buf = append(buf, 'e', '.') // APPENDS, STOP
+
+	binary.BigEndian.PutUint32(buf[start:], uint32(len(buf)-start-4))
+	return buf
+}
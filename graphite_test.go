@@ -0,0 +1,242 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tcpReceiver accepts a single connection and returns what was sent
+// on it once it is closed
+func tcpReceiver(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	return l.Addr().String(), received
+}
+
+// graphiteLines returns the plaintext lines without their timestamp, and
+// checks that the timestamps are close to now
+func graphiteLines(t *testing.T, data []byte) []string {
+	t.Helper()
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		i := strings.LastIndexByte(line, ' ')
+		ts, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			t.Fatalf("bad timestamp in %q: %v", line, err)
+		}
+		if d := time.Since(time.Unix(ts, 0)); d < -time.Second || d > time.Minute {
+			t.Fatalf("bad timestamp in %q", line)
+		}
+		lines = append(lines, line[:i])
+	}
+	return lines
+}
+
+func TestGraphiteSink_Plaintext(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tagged bool
+		expect []string
+	}{
+		{
+			name: "paths",
+			expect: []string{
+				"a_b_c 1",
+				"http.latency.count 3",
+				"http.latency.sum 5",
+				"http.latency.min 0.5",
+				"http.latency.max 3",
+				"http.latency.mean 1.6666666666666667",
+				"http.requests.eu_west.GET 3",
+				"pool.size 5",
+			},
+		},
+		{
+			name:   "tagged",
+			tagged: true,
+			expect: []string{
+				"a_b_c 1",
+				"http.latency.count 3",
+				"http.latency.sum 5",
+				"http.latency.min 0.5",
+				"http.latency.max 3",
+				"http.latency.mean 1.6666666666666667",
+				"http.requests;dc=eu_west;method=GET 3",
+				"pool.size 5",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, received := tcpReceiver(t)
+			s, err := NewGraphiteSink(GraphiteSinkOpts{Addr: addr, Tagged: tc.tagged, FlushInterval: time.Hour})
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+
+			labels := []Label{{"method", "GET"}, {"dc", "eu west"}, {"empty", ""}}
+			s.SetGauge([]string{"pool", "size"}, 4)
+			s.SetGauge([]string{"pool", "size"}, 5)
+			s.IncrCounterWithLabels([]string{"http", "requests"}, 1, labels)
+			s.IncrCounterWithLabels([]string{"http", "requests"}, 2, labels)
+			s.AddSample([]string{"http", "latency"}, 1.5)
+			s.AddSample([]string{"http", "latency"}, 3)
+			s.AddSample([]string{"http", "latency"}, 0.5)
+			s.EmitKey([]string{"a b.c"}, 1)
+			s.Shutdown()
+
+			select {
+			case data := <-received:
+				if got := graphiteLines(t, data); !reflect.DeepEqual(got, tc.expect) {
+					t.Fatalf("bad lines: %q", got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("nothing was sent")
+			}
+		})
+	}
+}
+
+func TestGraphiteSink_Pickle(t *testing.T) {
+	addr, received := tcpReceiver(t)
+	s, err := NewGraphiteSink(GraphiteSinkOpts{Addr: addr, Protocol: GraphitePickle, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < graphitePickleBatch+1; i++ {
+		s.SetGauge([]string{"gauge", strconv.Itoa(i)}, float32(i))
+	}
+	s.Shutdown()
+
+	var data []byte
+	select {
+	case data = <-received:
+	case <-time.After(time.Second):
+		t.Fatalf("nothing was sent")
+	}
+
+	// The datapoints are split in two messages
+	var messages int
+	for len(data) > 0 {
+		if len(data) < 4 {
+			t.Fatalf("truncated header")
+		}
+		n := int(binary.BigEndian.Uint32(data))
+		if len(data) < 4+n {
+			t.Fatalf("truncated message")
+		}
+		payload := data[4 : 4+n]
+		if !bytes.HasPrefix(payload, []byte{0x80, 2, ']', '('}) || !bytes.HasSuffix(payload, []byte("e.")) {
+			t.Fatalf("bad payload: %q", payload)
+		}
+		data = data[4+n:]
+		messages++
+	}
+	if messages != 2 {
+		t.Fatalf("expected 2 messages, got %d", messages)
+	}
+}
+
+func TestAppendGraphitePickle(t *testing.T) {
+	got := appendGraphitePickle(nil, []graphiteDatapoint{{series: "a;b=c", value: 1.5, timestamp: 1700000000}})
+	expect := []byte{
+		0, 0, 0, 32,
+		0x80, 2, ']', '(',
+		'X', 5, 0, 0, 0, 'a', ';', 'b', '=', 'c',
+		'J', 0x00, 0xf1, 0x53, 0x65,
+		'G', 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x86, 0x86,
+		'e', '.',
+	}
+	if !bytes.Equal(got, expect) {
+		t.Fatalf("bad pickle: % x", got)
+	}
+}
+
+func TestAppendGraphitePickle_InvalidUTF8(t *testing.T) {
+	got := appendGraphitePickle(nil, []graphiteDatapoint{{series: "a\xffb", value: 1, timestamp: 1}})
+	expect := []byte{'X', 3, 0, 0, 0, 'a', '_', 'b', 'J'}
+	if !bytes.Contains(got, expect) {
+		t.Fatalf("bad pickle: % x", got)
+	}
+}
+
+func TestNewGraphiteSinkFromURL(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		input     string
+		expect    GraphiteSinkOpts
+		expectErr string
+	}{
+		{
+			desc:   "defaults",
+			input:  "graphite://localhost:2003",
+			expect: GraphiteSinkOpts{Addr: "localhost:2003", FlushInterval: 10 * time.Second},
+		},
+		{
+			desc:   "pickle and tags",
+			input:  "graphite://localhost:2004?protocol=pickle&tagged=true&flush_interval=1m",
+			expect: GraphiteSinkOpts{Addr: "localhost:2004", Protocol: GraphitePickle, Tagged: true, FlushInterval: time.Minute},
+		},
+		{
+			desc:      "bad protocol",
+			input:     "graphite://localhost:2003?protocol=udp",
+			expectErr: "bad 'protocol' param",
+		},
+		{
+			desc:      "bad tagged",
+			input:     "graphite://localhost:2003?tagged=maybe",
+			expectErr: "bad 'tagged' param",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			u, err := url.Parse(tc.input)
+			if err != nil {
+				t.Fatalf("error parsing URL: %s", err)
+			}
+			ms, err := NewGraphiteSinkFromURL(u)
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expected err: %q, to contain: %q", err, tc.expectErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			s := ms.(*GraphiteSink)
+			defer s.Shutdown()
+			// The default formatter can't be compared
+			s.opts.KeyFormatter = nil
+			if !reflect.DeepEqual(s.opts, tc.expect) {
+				t.Fatalf("bad opts: %+v", s.opts)
+			}
+		})
+	}
+}
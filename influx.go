@@ -0,0 +1,409 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// influxMaxPacketLen is the maximum size of a packet sent to the
+	// InfluxDB UDP listener
+	influxMaxPacketLen = 1400
+
+	// influxHTTPTimeout bounds every write to the InfluxDB HTTP API
+	influxHTTPTimeout = 10 * time.Second
+)
+
+var (
+	// influxMeasurementEscaper escapes the measurements of the line protocol.
+	// Line breaks can't be escaped, they become escaped spaces. Backslashes
+	// are escaped so that a trailing one doesn't escape the separator.
+	influxMeasurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+
+	// influxTagEscaper escapes the tag keys, tag values and field keys of
+	// the line protocol, like influxMeasurementEscaper
+	influxTagEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+)
+
+// InfluxTransport is how the InfluxSink sends metrics to InfluxDB
+type InfluxTransport int
+
+const (
+	// InfluxHTTP writes to the HTTP API
+	InfluxHTTP InfluxTransport = iota
+
+	// InfluxHTTPS writes to the HTTP API over TLS
+	InfluxHTTPS
+
+	// InfluxUDP sends to the UDP listener
+	InfluxUDP
+)
+
+// InfluxSinkOpts is used to configure the InfluxSink
+type InfluxSinkOpts struct {
+	// Addr is the host:port of the InfluxDB server
+	Addr string
+
+	// Transport is how the metrics are sent
+	Transport InfluxTransport
+
+	// Version is the version of the HTTP API: 1 for /write, 2 for
+	// /api/v2/write. It is 2 if zero.
+	Version int
+
+	// Database, RetentionPolicy, Username and Password are used with the
+	// version 1 API
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+
+	// Org, Bucket and Token are used with the version 2 API
+	Org    string
+	Bucket string
+	Token  string
+
+	// Precision is the precision of the timestamps, one of time.Nanosecond
+	// (the default), time.Microsecond, time.Millisecond or time.Second
+	Precision time.Duration
+
+	// FlushInterval is how often the metrics are aggregated and written,
+	// 10 seconds if zero
+	FlushInterval time.Duration
+
+	// KeyFormatter names the measurements, by default the parts of the key
+	// are joined with '.'
+	KeyFormatter KeyFormatter
+}
+
+// NewInfluxSinkFromURL creates an InfluxSink from a URL. It is used (and
+// tested) from NewMetricSinkFromURL.
+func NewInfluxSinkFromURL(u *url.URL) (MetricSink, error) {
+	params := u.Query()
+	opts := InfluxSinkOpts{
+		Addr:            u.Host,
+		Database:        params.Get("db"),
+		RetentionPolicy: params.Get("rp"),
+		Org:             params.Get("org"),
+		Bucket:          params.Get("bucket"),
+		Token:           params.Get("token"),
+	}
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+
+	switch transport := params.Get("transport"); transport {
+	case "", "http":
+	case "https":
+		opts.Transport = InfluxHTTPS
+	case "udp":
+		opts.Transport = InfluxUDP
+	default:
+		return nil, fmt.Errorf("bad 'transport' param: unknown transport: %q", transport)
+	}
+	if version := params.Get("version"); version != "" {
+		var err error
+		if opts.Version, err = strconv.Atoi(version); err != nil {
+			return nil, fmt.Errorf("bad 'version' param: %s", err)
+		}
+	}
+	if precision := params.Get("precision"); precision != "" {
+		var err error
+		if opts.Precision, err = parseInfluxPrecision(precision); err != nil {
+			return nil, fmt.Errorf("bad 'precision' param: %s", err)
+		}
+	}
+	if interval := params.Get("flush_interval"); interval != "" {
+		var err error
+		if opts.FlushInterval, err = time.ParseDuration(interval); err != nil {
+			return nil, fmt.Errorf("bad 'flush_interval' param: %s", err)
+		}
+	}
+	if name := params.Get("key_format"); name != "" {
+		var err error
+		if opts.KeyFormatter, err = ParseKeyFormatter(name); err != nil {
+			return nil, fmt.Errorf("bad 'key_format' param: %s", err)
+		}
+	}
+	return NewInfluxSink(opts)
+}
+
+// parseInfluxPrecision parses the precision names of both API versions
+func parseInfluxPrecision(name string) (time.Duration, error) {
+	switch name {
+	case "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	default:
+		return 0, fmt.Errorf("unknown precision: %q", name)
+	}
+}
+
+// InfluxSink provides a MetricSink that writes to InfluxDB in the line
+// protocol. Metrics are aggregated over the flush interval, and written as
+// one point per series, whose fields depend on the metric type:
+//
+//   - Gauges and keys have a "value" field holding the last value
+//   - Counters have "count" and "sum" fields
+//   - Samples have "count", "sum", "min" and "max" fields
+//
+// Labels become tags.
+type InfluxSink struct {
+	opts       InfluxSinkOpts
+	aggregator *IntervalAggregator
+	client     *http.Client
+	writeURL   string
+
+	// conn is the UDP connection, only used by the flushes
+	conn net.Conn
+}
+
+// NewInfluxSink is used to create a new InfluxSink
+func NewInfluxSink(opts InfluxSinkOpts) (*InfluxSink, error) {
+	if opts.Version == 0 {
+		opts.Version = 2
+	}
+	if opts.Precision == 0 {
+		opts.Precision = time.Nanosecond
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+
+	s := &InfluxSink{opts: opts}
+
+	// Version 1 only accepts the short precision names
+	precisions := map[time.Duration][2]string{
+		time.Nanosecond:  {"n", "ns"},
+		time.Microsecond: {"u", "us"},
+		time.Millisecond: {"ms", "ms"},
+		time.Second:      {"s", "s"},
+	}
+	names, ok := precisions[opts.Precision]
+	if !ok {
+		return nil, fmt.Errorf("unsupported precision: %s", opts.Precision)
+	}
+
+	if opts.Transport != InfluxUDP {
+		query := url.Values{}
+		var path string
+		switch opts.Version {
+		case 1:
+			path = "/write"
+			query.Set("db", opts.Database)
+			if opts.RetentionPolicy != "" {
+				query.Set("rp", opts.RetentionPolicy)
+			}
+			query.Set("precision", names[0])
+		case 2:
+			path = "/api/v2/write"
+			query.Set("org", opts.Org)
+			query.Set("bucket", opts.Bucket)
+			query.Set("precision", names[1])
+		default:
+			return nil, fmt.Errorf("unsupported InfluxDB API version: %d", opts.Version)
+		}
+		scheme := "http"
+		if opts.Transport == InfluxHTTPS {
+			scheme = "https"
+		}
+		s.writeURL = (&url.URL{Scheme: scheme, Host: opts.Addr, Path: path, RawQuery: query.Encode()}).String()
+		s.client = &http.Client{Timeout: influxHTTPTimeout}
+	}
+
+	s.aggregator = NewIntervalAggregator(IntervalAggregatorOpts{
+		Interval: opts.FlushInterval,
+		Flush:    s.write,
+		Close:    s.close,
+	})
+	return s, nil
+}
+
+// Shutdown stops accepting new metrics, then blocks until the aggregated
+// metrics have been written to InfluxDB, or until shutdownTimeout has
+// elapsed.
+func (s *InfluxSink) Shutdown() {
+	s.aggregator.Shutdown()
+}
+
+func (s *InfluxSink) SetGauge(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *InfluxSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesGauge, key, float64(val), labels)
+}
+
+func (s *InfluxSink) SetPrecisionGauge(key []string, val float64) {
+	s.pushMetric(SeriesGauge, key, val, nil)
+}
+
+func (s *InfluxSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	s.pushMetric(SeriesGauge, key, val, labels)
+}
+
+func (s *InfluxSink) EmitKey(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *InfluxSink) IncrCounter(key []string, val float32) {
+	s.pushMetric(SeriesCounter, key, float64(val), nil)
+}
+
+func (s *InfluxSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesCounter, key, float64(val), labels)
+}
+
+func (s *InfluxSink) AddSample(key []string, val float32) {
+	s.pushMetric(SeriesSample, key, float64(val), nil)
+}
+
+func (s *InfluxSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesSample, key, float64(val), labels)
+}
+
+// influxTags returns the labels InfluxDB accepts as tags, as it rejects
+// tags with an empty key or value
+func influxTags(labels []Label) []Label {
+	tags := make([]Label, 0, len(labels))
+	for _, label := range labels {
+		if label.Name != "" && label.Value != "" {
+			tags = append(tags, label)
+		}
+	}
+	return tags
+}
+
+// pushMetric adds a metric to the aggregator, which drops the NaN and
+// infinite values InfluxDB doesn't accept
+func (s *InfluxSink) pushMetric(kind SeriesKind, key []string, val float64, labels []Label) {
+	s.aggregator.Add(kind, formatKey(s.opts.KeyFormatter, key), influxTags(labels), val)
+}
+
+// write writes the series aggregated over an interval
+func (s *InfluxSink) write(series []*IntervalSeries, now time.Time) {
+	lines := s.encode(series, now)
+
+	var err error
+	if s.opts.Transport == InfluxUDP {
+		s.conn, err = s.writeUDP(s.conn, lines)
+	} else {
+		err = s.writeHTTP(lines)
+	}
+	if err != nil {
+		log.Printf("[ERR] Error writing to InfluxDB! Err: %s", err)
+	}
+}
+
+// close closes the UDP connection once the last series have been written
+func (s *InfluxSink) close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+}
+
+// encode returns the series as lines of the line protocol. The measurement
+// and the tags are escaped, the tags being sorted by key as InfluxDB
+// recommends.
+func (s *InfluxSink) encode(series []*IntervalSeries, now time.Time) [][]byte {
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(s.opts.Precision), 10)
+	float := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	lines := make([][]byte, 0, len(series))
+	for _, ser := range series {
+		var buf bytes.Buffer
+		influxMeasurementEscaper.WriteString(&buf, ser.Name)
+		for _, label := range ser.Labels {
+			buf.WriteByte(',')
+			influxTagEscaper.WriteString(&buf, label.Name)
+			buf.WriteByte('=')
+			influxTagEscaper.WriteString(&buf, label.Value)
+		}
+
+		switch ser.Kind {
+		case SeriesGauge:
+			fmt.Fprintf(&buf, " value=%s", float(ser.Value))
+		case SeriesCounter:
+			fmt.Fprintf(&buf, " count=%di,sum=%s", ser.Count, float(ser.Sum))
+		case SeriesSample:
+			fmt.Fprintf(&buf, " count=%di,sum=%s,min=%s,max=%s",
+				ser.Count, float(ser.Sum), float(ser.Min), float(ser.Max))
+		}
+		fmt.Fprintf(&buf, " %s\n", timestamp)
+		lines = append(lines, buf.Bytes())
+	}
+	return lines
+}
+
+// writeUDP sends the lines in as few packets as possible. It returns the
+// connection to use for the next write.
+func (s *InfluxSink) writeUDP(conn net.Conn, lines [][]byte) (net.Conn, error) {
+	if conn == nil {
+		var err error
+		if conn, err = net.Dial("udp", s.opts.Addr); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+len(line) > influxMaxPacketLen {
+			if _, err := conn.Write(buf.Bytes()); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			buf.Reset()
+		}
+		buf.Write(line)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// writeHTTP posts the lines to the write API
+func (s *InfluxSink) writeHTTP(lines [][]byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.writeURL, bytes.NewReader(bytes.Join(lines, nil)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.opts.Version == 1 && s.opts.Username != "" {
+		req.SetBasicAuth(s.opts.Username, s.opts.Password)
+	}
+	if s.opts.Version == 2 && s.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.opts.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("InfluxDB returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
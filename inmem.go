@@ -35,6 +35,9 @@ type InmemSink struct {
 	intervalLock sync.RWMutex
 
 	rateDenom float64
+
+	// formatter, if set, names the metrics instead of joining the key
+	formatter KeyFormatter
 }
 
 // IntervalMetrics stores the aggregated metrics
@@ -63,6 +66,10 @@ type IntervalMetrics struct {
 	// which has the rolled up view of a sample
 	Samples map[string]SampledValue
 
+	// sets maps the key to the distinct values added with AddToSet,
+	// the size of each set is reported in Gauges
+	sets map[string]map[string]struct{}
+
 	// done is closed when this interval has ended, and a new IntervalMetrics
 	// has been created to receive any future metrics.
 	done chan struct{}
@@ -77,6 +84,7 @@ func NewIntervalMetrics(intv time.Time) *IntervalMetrics {
 		Points:          make(map[string][]float32),
 		Counters:        make(map[string]SampledValue),
 		Samples:         make(map[string]SampledValue),
+		sets:            make(map[string]map[string]struct{}),
 		done:            make(chan struct{}),
 	}
 }
@@ -152,7 +160,15 @@ func NewInmemSinkFromURL(u *url.URL) (MetricSink, error) {
 		return nil, fmt.Errorf("bad 'retain' param: %s", err)
 	}
 
-	return NewInmemSink(interval, retain), nil
+	sink := NewInmemSink(interval, retain)
+	if name := params.Get("key_format"); name != "" {
+		formatter, err := ParseKeyFormatter(name)
+		if err != nil {
+			return nil, fmt.Errorf("bad 'key_format' param: %s", err)
+		}
+		sink.SetKeyFormatter(formatter)
+	}
+	return sink, nil
 }
 
 // NewInmemSink is used to construct a new in-memory sink.
@@ -169,6 +185,12 @@ func NewInmemSink(interval, retain time.Duration) *InmemSink {
 	return i
 }
 
+// SetKeyFormatter sets how keys are turned into metric names, by default
+// the parts are joined with '.'. It must be called before the sink is used.
+func (i *InmemSink) SetKeyFormatter(formatter KeyFormatter) {
+	i.formatter = formatter
+}
+
 func (i *InmemSink) SetGauge(key []string, val float32) {
 	i.SetGaugeWithLabels(key, val, nil)
 }
@@ -195,6 +217,55 @@ func (i *InmemSink) SetPrecisionGaugeWithLabels(key []string, val float64, label
 	intv.PrecisionGauges[k] = PrecisionGaugeValue{Name: name, Value: val, Labels: labels}
 }
 
+func (i *InmemSink) AddGauge(key []string, delta float32) {
+	i.AddGaugeWithLabels(key, delta, nil)
+}
+
+// AddGaugeWithLabels adds delta to the gauge. A gauge that has not been set
+// in the current interval starts from its value in the previous interval.
+func (i *InmemSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	k, name := i.flattenKeyLabels(key, labels)
+	intv := i.getInterval()
+
+	intv.RLock()
+	_, exists := intv.Gauges[k]
+	intv.RUnlock()
+	var prev float32
+	if !exists {
+		prev = i.previousGauge(intv, k)
+	}
+
+	intv.Lock()
+	defer intv.Unlock()
+	g, ok := intv.Gauges[k]
+	if !ok {
+		g = GaugeValue{Name: name, Value: prev, Labels: labels}
+	}
+	g.Value += delta
+	intv.Gauges[k] = g
+}
+
+// AddToSet reports the number of distinct values added to the key during
+// the interval as a gauge.
+func (i *InmemSink) AddToSet(key []string, val string) {
+	i.AddToSetWithLabels(key, val, nil)
+}
+
+func (i *InmemSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	k, name := i.flattenKeyLabels(key, labels)
+	intv := i.getInterval()
+
+	intv.Lock()
+	defer intv.Unlock()
+	set, ok := intv.sets[k]
+	if !ok {
+		set = make(map[string]struct{})
+		intv.sets[k] = set
+	}
+	set[val] = struct{}{}
+	intv.Gauges[k] = GaugeValue{Name: name, Value: float32(len(set)), Labels: labels}
+}
+
 func (i *InmemSink) EmitKey(key []string, val float32) {
 	k := i.flattenKey(key)
 	intv := i.getInterval()
@@ -315,8 +386,44 @@ func (i *InmemSink) getInterval() *IntervalMetrics {
 	return current
 }
 
+// previousGauge returns the value of the gauge in the interval before intv,
+// or zero if there is no such interval or the gauge was not set in it.
+func (i *InmemSink) previousGauge(intv *IntervalMetrics, k string) float32 {
+	i.intervalLock.RLock()
+	defer i.intervalLock.RUnlock()
+
+	for j := len(i.intervals) - 1; j > 0; j-- {
+		if i.intervals[j] == intv {
+			prev := i.intervals[j-1]
+			prev.RLock()
+			defer prev.RUnlock()
+			return prev.Gauges[k].Value
+		}
+	}
+	return 0
+}
+
 // Flattens the key for formatting, removes spaces
 func (i *InmemSink) flattenKey(parts []string) string {
+	return seriesName(i.formatParts(parts))
+}
+
+// Flattens the key for formatting along with its labels, removes spaces
+func (i *InmemSink) flattenKeyLabels(parts []string, labels []Label) (string, string) {
+	return seriesKey(i.formatParts(parts), labels)
+}
+
+// formatParts returns the key as a single part named by the formatter, or
+// as is if there is no formatter
+func (i *InmemSink) formatParts(parts []string) []string {
+	if i.formatter == nil {
+		return parts
+	}
+	return []string{i.formatter.FormatKey(parts)}
+}
+
+// seriesName flattens the key the way InmemSink names metrics
+func seriesName(parts []string) string {
 	buf := &bytes.Buffer{}
 
 	joined := strings.Join(parts, ".")
@@ -326,9 +433,10 @@ func (i *InmemSink) flattenKey(parts []string) string {
 	return buf.String()
 }
 
-// Flattens the key for formatting along with its labels, removes spaces
-func (i *InmemSink) flattenKeyLabels(parts []string, labels []Label) (string, string) {
-	key := i.flattenKey(parts)
+// seriesKey returns the key that identifies a series in InmemSink, along with
+// its name. Labels are part of the key, in the order they are given.
+func seriesKey(parts []string, labels []Label) (string, string) {
+	key := seriesName(parts)
 	buf := bytes.NewBufferString(key)
 
 	for _, label := range labels {
@@ -11,6 +11,53 @@ import (
 	"time"
 )
 
+func TestInmemSink_AddGauge(t *testing.T) {
+	inm := NewInmemSink(50*time.Millisecond, time.Second)
+
+	inm.AddGauge([]string{"foo"}, 2)
+	inm.AddGauge([]string{"foo"}, 3)
+	inm.SetGauge([]string{"bar"}, 10)
+	inm.AddGauge([]string{"bar"}, -4)
+
+	data := inm.Data()
+	intvM := data[len(data)-1]
+	if v := intvM.Gauges["foo"].Value; v != 5 {
+		t.Fatalf("bad val: %v", v)
+	}
+	if v := intvM.Gauges["bar"].Value; v != 6 {
+		t.Fatalf("bad val: %v", v)
+	}
+
+	// Deltas carry over into the next interval
+	intv := intvM.Interval
+	for inm.getInterval().Interval.Equal(intv) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	inm.AddGauge([]string{"bar"}, 1)
+	data = inm.Data()
+	if v := data[len(data)-1].Gauges["bar"].Value; v != 7 {
+		t.Fatalf("bad val: %v", v)
+	}
+}
+
+func TestInmemSink_AddToSet(t *testing.T) {
+	inm := NewInmemSink(time.Minute, time.Hour)
+
+	inm.AddToSet([]string{"users"}, "a")
+	inm.AddToSet([]string{"users"}, "b")
+	inm.AddToSet([]string{"users"}, "a")
+	inm.AddToSetWithLabels([]string{"users"}, "a", []Label{{"x", "y"}})
+
+	data := inm.Data()
+	intvM := data[len(data)-1]
+	if v := intvM.Gauges["users"].Value; v != 2 {
+		t.Fatalf("bad val: %v", v)
+	}
+	if v := intvM.Gauges["users;x=y"].Value; v != 1 {
+		t.Fatalf("bad val: %v", v)
+	}
+}
+
 func TestInmemSink(t *testing.T) {
 	inm := NewInmemSink(10*time.Millisecond, 50*time.Millisecond)
 
@@ -0,0 +1,278 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SeriesKind is the kind of metric an IntervalAggregator aggregates a
+// series as
+type SeriesKind int
+
+const (
+	// SeriesGauge keeps the last value of the interval
+	SeriesGauge SeriesKind = iota
+
+	// SeriesCounter sums the values of the interval
+	SeriesCounter
+
+	// SeriesSample summarizes the values of the interval
+	SeriesSample
+)
+
+func (k SeriesKind) String() string {
+	switch k {
+	case SeriesGauge:
+		return "gauge"
+	case SeriesCounter:
+		return "counter"
+	default:
+		return "sample"
+	}
+}
+
+// IntervalSeries is a series aggregated over an interval
+type IntervalSeries struct {
+	Kind SeriesKind
+	Name string
+
+	// Labels are sorted by name, with one label per name
+	Labels []Label
+
+	// Value is the last value of a gauge, or the sum of a counter
+	Value float64
+
+	// AggregateSample summarizes the values of the interval
+	AggregateSample
+
+	// Values are the distinct values of a sample in the order they were
+	// first added, and Counts how many times each was added. They are only
+	// kept up to IntervalAggregatorOpts.MaxValues distinct values, and are
+	// nil past that.
+	Values []float64
+	Counts []int
+
+	// valueIndex is the index of every value in Values
+	valueIndex map[float64]int
+
+	// tooManyValues is set once the sample has more than MaxValues
+	// distinct values
+	tooManyValues bool
+}
+
+// IntervalAggregatorOpts is used to configure an IntervalAggregator
+type IntervalAggregatorOpts struct {
+	// Interval is how often the series are flushed, 10 seconds if zero
+	Interval time.Duration
+
+	// MaxValues is the maximum number of distinct values kept per sample
+	// with their counts, on top of the summary. No values are kept if
+	// zero.
+	MaxValues int
+
+	// Flush receives the series of every interval which had any, sorted by
+	// name, kind and labels. Flushes are serialized.
+	Flush func(series []*IntervalSeries, now time.Time)
+
+	// Close is called once the last interval has been flushed, if set
+	Close func()
+}
+
+// IntervalAggregator aggregates metrics per series over an interval, and
+// hands the series to a flush function every interval. It is the shared
+// part of the sinks writing one point per series and interval, which only
+// have to encode the series in their own format.
+//
+// Series are identified by kind, name and labels, so that a gauge and a
+// counter may have the same name, and labels in a different order are the
+// same series. NaN and infinite values are dropped, as most formats can't
+// hold them.
+//
+// It is exported for the sinks living in their own package, such as the
+// EMF sink, so that they don't have to copy the queueing, flushing and
+// shutdown handling the sinks of this package share.
+type IntervalAggregator struct {
+	interval  time.Duration
+	maxValues int
+	flush     func([]*IntervalSeries, time.Time)
+	close     func()
+
+	lock     sync.Mutex
+	series   map[string]*IntervalSeries
+	shutdown bool
+
+	// flushLock serializes the flushes
+	flushLock sync.Mutex
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewIntervalAggregator creates an IntervalAggregator, and starts flushing
+// it every interval
+func NewIntervalAggregator(opts IntervalAggregatorOpts) *IntervalAggregator {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	a := &IntervalAggregator{
+		interval:  opts.Interval,
+		maxValues: opts.MaxValues,
+		flush:     opts.Flush,
+		close:     opts.Close,
+		series:    make(map[string]*IntervalSeries),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Add adds a value to the series of the given kind, name and labels. Values
+// are dropped once the aggregator has been shut down.
+func (a *IntervalAggregator) Add(kind SeriesKind, name string, labels []Label, val float64) {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return
+	}
+	if len(labels) == 0 {
+		labels = nil
+	} else {
+		labels = sortLabels(slices.Clone(labels), LabelLastWins)
+	}
+	id := intervalSeriesID(kind, name, labels)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.shutdown {
+		return
+	}
+	ser, ok := a.series[id]
+	if !ok {
+		ser = &IntervalSeries{Kind: kind, Name: name, Labels: labels}
+		a.series[id] = ser
+	}
+	if kind == SeriesCounter {
+		ser.Value += val
+	} else {
+		ser.Value = val
+	}
+	ser.Ingest(val, a.interval.Seconds())
+	if kind == SeriesSample && a.maxValues > 0 {
+		ser.addValue(val, a.maxValues)
+	}
+}
+
+// addValue counts a value of a sample, unless it has more than maxValues
+// distinct values
+func (ser *IntervalSeries) addValue(val float64, maxValues int) {
+	if ser.tooManyValues {
+		return
+	}
+	if i, ok := ser.valueIndex[val]; ok {
+		ser.Counts[i]++
+		return
+	}
+	if len(ser.Values) == maxValues {
+		ser.Values, ser.Counts, ser.valueIndex = nil, nil, nil
+		ser.tooManyValues = true
+		return
+	}
+	if ser.valueIndex == nil {
+		ser.valueIndex = make(map[float64]int)
+	}
+	ser.valueIndex[val] = len(ser.Values)
+	ser.Values = append(ser.Values, val)
+	ser.Counts = append(ser.Counts, 1)
+}
+
+// Flush flushes the series aggregated since the previous flush now
+func (a *IntervalAggregator) Flush() {
+	a.flushLock.Lock()
+	defer a.flushLock.Unlock()
+
+	a.lock.Lock()
+	series := a.series
+	a.series = make(map[string]*IntervalSeries)
+	a.lock.Unlock()
+
+	if len(series) == 0 || a.flush == nil {
+		return
+	}
+	sorted := slices.SortedFunc(maps.Values(series), compareIntervalSeries)
+	a.flush(sorted, time.Now())
+}
+
+// Shutdown stops accepting new values, then blocks until the last interval
+// has been flushed, or until shutdownTimeout has elapsed.
+func (a *IntervalAggregator) Shutdown() {
+	a.stopOnce.Do(func() {
+		a.lock.Lock()
+		a.shutdown = true
+		a.lock.Unlock()
+		close(a.stopCh)
+	})
+
+	select {
+	case <-a.doneCh:
+	case <-time.After(shutdownTimeout):
+		log.Printf("[WARN] Timed out flushing metrics during shutdown")
+	}
+}
+
+// run flushes every interval until Shutdown is called
+func (a *IntervalAggregator) run() {
+	defer close(a.doneCh)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-a.stopCh:
+			a.Flush()
+			if a.close != nil {
+				a.close()
+			}
+			return
+		}
+	}
+}
+
+// compareIntervalSeries orders series by name, kind and labels
+func compareIntervalSeries(a, b *IntervalSeries) int {
+	if c := cmp.Compare(a.Name, b.Name); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Kind, b.Kind); c != 0 {
+		return c
+	}
+	return slices.CompareFunc(a.Labels, b.Labels, func(a, b Label) int {
+		if c := cmp.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+}
+
+// intervalSeriesID identifies a series by kind, name and labels. Every
+// string is prefixed by its length, so that names and values holding the
+// separators can't make two series collide.
+func intervalSeriesID(kind SeriesKind, name string, labels []Label) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d;%d:%s", kind, len(name), name)
+	for _, label := range labels {
+		fmt.Fprintf(&b, ";%d:%s=%d:%s", len(label.Name), label.Name, len(label.Value), label.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,131 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// intervalRecorder records the series flushed by an IntervalAggregator
+type intervalRecorder struct {
+	lock    sync.Mutex
+	flushes [][]*IntervalSeries
+	closed  bool
+}
+
+func (r *intervalRecorder) flush(series []*IntervalSeries, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.flushes = append(r.flushes, series)
+}
+
+func (r *intervalRecorder) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+}
+
+func TestIntervalAggregator(t *testing.T) {
+	r := &intervalRecorder{}
+	a := NewIntervalAggregator(IntervalAggregatorOpts{
+		Interval:  time.Second,
+		MaxValues: 2,
+		Flush:     r.flush,
+		Close:     r.close,
+	})
+
+	a.Add(SeriesGauge, "pool", []Label{{"b", "2"}, {"a", "1"}}, 4)
+	a.Add(SeriesGauge, "pool", []Label{{"a", "1"}, {"b", "2"}}, 5)
+	a.Add(SeriesCounter, "pool", nil, 1)
+	a.Add(SeriesCounter, "pool", nil, 2)
+	a.Add(SeriesSample, "latency", []Label{{"a", "1"}, {"a", "2"}}, 1)
+	a.Add(SeriesSample, "latency", []Label{{"a", "2"}}, 3)
+	a.Add(SeriesSample, "latency", []Label{{"a", "2"}}, 1)
+	a.Add(SeriesSample, "queue", nil, 1)
+	a.Add(SeriesSample, "queue", nil, 2)
+	a.Add(SeriesSample, "queue", nil, 3)
+	a.Add(SeriesSample, "latency", []Label{{"a", "2"}}, math.NaN())
+	a.Add(SeriesSample, "latency", []Label{{"a", "2"}}, math.Inf(1))
+	a.Shutdown()
+
+	// Nothing is added once shut down
+	a.Add(SeriesCounter, "pool", nil, 1)
+	a.Flush()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.flushes) != 1 || !r.closed {
+		t.Fatalf("bad flushes: %v %v", r.flushes, r.closed)
+	}
+
+	type summary struct {
+		kind   SeriesKind
+		name   string
+		labels []Label
+		value  float64
+		count  int
+		values []float64
+		counts []int
+	}
+	var got []summary
+	for _, ser := range r.flushes[0] {
+		got = append(got, summary{ser.Kind, ser.Name, ser.Labels, ser.Value, ser.Count, ser.Values, ser.Counts})
+	}
+	expect := []summary{
+		{SeriesSample, "latency", []Label{{"a", "2"}}, 1, 3, []float64{1, 3}, []int{2, 1}},
+		{SeriesGauge, "pool", []Label{{"a", "1"}, {"b", "2"}}, 5, 2, nil, nil},
+		{SeriesCounter, "pool", nil, 3, 2, nil, nil},
+
+		// The values of samples with too many distinct values aren't kept
+		{SeriesSample, "queue", nil, 3, 3, nil, nil},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad series: %+v", got)
+	}
+}
+
+func TestIntervalAggregator_Interval(t *testing.T) {
+	r := &intervalRecorder{}
+	a := NewIntervalAggregator(IntervalAggregatorOpts{Interval: 10 * time.Millisecond, Flush: r.flush})
+	defer a.Shutdown()
+
+	a.Add(SeriesCounter, "requests", nil, 1)
+	time.Sleep(50 * time.Millisecond)
+
+	// Intervals without series aren't flushed
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.flushes) != 1 || r.flushes[0][0].Value != 1 {
+		t.Fatalf("bad flushes: %v", r.flushes)
+	}
+}
+
+func TestIntervalAggregator_SeriesID(t *testing.T) {
+	r := &intervalRecorder{}
+	a := NewIntervalAggregator(IntervalAggregatorOpts{Flush: r.flush})
+
+	// Values holding the separators don't make series collide
+	a.Add(SeriesGauge, "pool", []Label{{"x", "1;y=2"}}, 1)
+	a.Add(SeriesGauge, "pool", []Label{{"x", "1"}, {"y", "2"}}, 2)
+	a.Add(SeriesGauge, "pool;x=1", nil, 3)
+	a.Add(SeriesGauge, "pool", []Label{{"x", "1"}}, 4)
+	a.Shutdown()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.flushes) != 1 || len(r.flushes[0]) != 4 {
+		t.Fatalf("bad flushes: %v", r.flushes)
+	}
+	var got []float64
+	for _, ser := range r.flushes[0] {
+		got = append(got, ser.Value)
+	}
+	if expect := []float64{4, 2, 1, 3}; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad series: %v", got)
+	}
+}
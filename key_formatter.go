@@ -0,0 +1,193 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeyFormatter turns the parts of a metric key into the metric name sent to
+// a backend. Sinks that accept a KeyFormatter still escape the result for
+// their wire format, so a formatter only needs to pick a naming scheme.
+// Using the same formatter for every sink of a FanoutSink gives consistent
+// names across backends.
+type KeyFormatter interface {
+	FormatKey(parts []string) string
+}
+
+// KeyFormatterFunc adapts a function to the KeyFormatter interface
+type KeyFormatterFunc func(parts []string) string
+
+// FormatKey calls f(parts)
+func (f KeyFormatterFunc) FormatKey(parts []string) string {
+	return f(parts)
+}
+
+var (
+	// GraphiteKeyFormatter joins the parts with '.' and replaces the
+	// characters other than letters, digits, '_' and '-' with '_', so that
+	// every part is a single Graphite path node.
+	GraphiteKeyFormatter KeyFormatter = KeyFormatterFunc(func(parts []string) string {
+		return joinSanitized(parts, ".", isGraphiteRune)
+	})
+
+	// PrometheusKeyFormatter joins the parts with '_' and replaces the
+	// characters not allowed in a Prometheus metric name with '_'. Names
+	// starting with a digit are prefixed with '_'.
+	PrometheusKeyFormatter KeyFormatter = KeyFormatterFunc(func(parts []string) string {
+		name := joinSanitized(parts, "_", isPrometheusRune)
+		if name != "" && name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		return name
+	})
+
+	// OTelKeyFormatter joins the parts with '.' as OpenTelemetry instrument
+	// names are, and replaces the characters other than letters, digits,
+	// '_', '-' and '/' with '_'. Names are truncated to 255 characters.
+	OTelKeyFormatter KeyFormatter = KeyFormatterFunc(func(parts []string) string {
+		name := joinSanitized(parts, ".", isOTelRune)
+		if len(name) > 255 {
+			name = name[:255]
+		}
+		return name
+	})
+)
+
+var keyFormatterNames = map[string]KeyFormatter{
+	"graphite":   GraphiteKeyFormatter,
+	"prometheus": PrometheusKeyFormatter,
+	"otel":       OTelKeyFormatter,
+}
+
+// ParseKeyFormatter returns the built-in KeyFormatter with the given name,
+// one of "graphite", "prometheus" or "otel". The name may be followed by
+// "+snake" or "+camel" to convert the case of every part first, for
+// example "otel+snake".
+func ParseKeyFormatter(name string) (KeyFormatter, error) {
+	base, conv, _ := strings.Cut(name, "+")
+	formatter, ok := keyFormatterNames[base]
+	if !ok {
+		return nil, fmt.Errorf("unknown key format: %q", name)
+	}
+	switch conv {
+	case "":
+		return formatter, nil
+	case "snake":
+		return SnakeCaseKeys(formatter), nil
+	case "camel":
+		return CamelCaseKeys(formatter), nil
+	default:
+		return nil, fmt.Errorf("unknown key format: %q", name)
+	}
+}
+
+// SnakeCaseKeys returns a KeyFormatter that converts every part to
+// snake_case, "raftApply" and "raft-apply" become "raft_apply", before
+// passing the key to formatter.
+func SnakeCaseKeys(formatter KeyFormatter) KeyFormatter {
+	return KeyFormatterFunc(func(parts []string) string {
+		converted := make([]string, len(parts))
+		for i, part := range parts {
+			converted[i] = strings.Join(splitWords(part), "_")
+		}
+		return formatter.FormatKey(converted)
+	})
+}
+
+// CamelCaseKeys returns a KeyFormatter that converts every part to
+// camelCase, "raft_apply" and "raft-apply" become "raftApply", before
+// passing the key to formatter.
+func CamelCaseKeys(formatter KeyFormatter) KeyFormatter {
+	return KeyFormatterFunc(func(parts []string) string {
+		converted := make([]string, len(parts))
+		for i, part := range parts {
+			words := splitWords(part)
+			for j := 1; j < len(words); j++ {
+				r, size := utf8.DecodeRuneInString(words[j])
+				words[j] = string(unicode.ToUpper(r)) + words[j][size:]
+			}
+			converted[i] = strings.Join(words, "")
+		}
+		return formatter.FormatKey(converted)
+	})
+}
+
+// splitWords splits s into lower case words on '_', '-', spaces and case
+// changes. An upper case run is a single word: "HTTPServer" is split into
+// "http" and "server".
+func splitWords(s string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		if r == '_' || r == '-' || unicode.IsSpace(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// joinSanitized joins the parts with sep, replacing the runes for which
+// valid returns false with '_'
+func joinSanitized(parts []string, sep string, valid func(rune) bool) string {
+	buf := strings.Builder{}
+	for i, part := range parts {
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		for _, r := range part {
+			if valid(r) {
+				buf.WriteRune(r)
+			} else {
+				buf.WriteByte('_')
+			}
+		}
+	}
+	return buf.String()
+}
+
+func isASCIIAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func isGraphiteRune(r rune) bool {
+	return isASCIIAlnum(r) || r == '_' || r == '-'
+}
+
+func isPrometheusRune(r rune) bool {
+	return isASCIIAlnum(r) || r == '_' || r == ':'
+}
+
+func isOTelRune(r rune) bool {
+	return isASCIIAlnum(r) || r == '_' || r == '-' || r == '/'
+}
+
+// formatKey formats the key with formatter, or joins the parts with '.' if
+// formatter is nil
+func formatKey(formatter KeyFormatter, parts []string) string {
+	if formatter == nil {
+		return strings.Join(parts, ".")
+	}
+	return formatter.FormatKey(parts)
+}
@@ -0,0 +1,77 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyFormatters(t *testing.T) {
+	key := []string{"consul", "raft.leader", "applyTime", "9 lives"}
+	for _, tc := range []struct {
+		name      string
+		formatter KeyFormatter
+		expect    string
+	}{
+		{"graphite", GraphiteKeyFormatter, "consul.raft_leader.applyTime.9_lives"},
+		{"prometheus", PrometheusKeyFormatter, "consul_raft_leader_applyTime_9_lives"},
+		{"otel", OTelKeyFormatter, "consul.raft_leader.applyTime.9_lives"},
+		{"snake", SnakeCaseKeys(GraphiteKeyFormatter), "consul.raft_leader.apply_time.9_lives"},
+		{"camel", CamelCaseKeys(GraphiteKeyFormatter), "consul.raft_leader.applyTime.9Lives"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.formatter.FormatKey(key); got != tc.expect {
+				t.Fatalf("expected %q, got %q", tc.expect, got)
+			}
+		})
+	}
+
+	if got := PrometheusKeyFormatter.FormatKey([]string{"2xx", "count"}); got != "_2xx_count" {
+		t.Fatalf("bad prometheus name: %q", got)
+	}
+	if got := OTelKeyFormatter.FormatKey([]string{strings.Repeat("a", 300)}); len(got) != 255 {
+		t.Fatalf("bad otel name length: %d", len(got))
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	for in, expect := range map[string]string{
+		"raftApply":       "raft apply",
+		"raft_apply":      "raft apply",
+		"raft-apply time": "raft apply time",
+		"HTTPServer":      "http server",
+		"getHTTP":         "get http",
+		"v2Apply":         "v2 apply",
+		"__x__":           "x",
+	} {
+		if got := strings.Join(splitWords(in), " "); got != expect {
+			t.Fatalf("splitWords(%q): expected %q, got %q", in, expect, got)
+		}
+	}
+}
+
+func TestParseKeyFormatter(t *testing.T) {
+	key := []string{"raft", "apply_time"}
+	for name, expect := range map[string]string{
+		"graphite":         "raft.apply_time",
+		"prometheus":       "raft_apply_time",
+		"otel+camel":       "raft.applyTime",
+		"prometheus+snake": "raft_apply_time",
+	} {
+		formatter, err := ParseKeyFormatter(name)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if got := formatter.FormatKey(key); got != expect {
+			t.Fatalf("%s: expected %q, got %q", name, expect, got)
+		}
+	}
+
+	for _, name := range []string{"bogus", "otel+kebab", ""} {
+		if _, err := ParseKeyFormatter(name); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
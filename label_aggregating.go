@@ -0,0 +1,399 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// GaugeAggregation is how a LabelAggregatingSink combines the gauges of
+// merged series
+type GaugeAggregation int
+
+const (
+	// GaugeLast sends the last value set on any of the merged series. This
+	// is the default.
+	GaugeLast GaugeAggregation = iota
+
+	// GaugeMin sends the minimum of the last values of the merged series.
+	GaugeMin
+
+	// GaugeMax sends the maximum of the last values of the merged series.
+	GaugeMax
+
+	// GaugeSum sends the sum of the last values of the merged series.
+	GaugeSum
+)
+
+// LabelAggregation removes labels from some metrics, merging the series
+// that only differ by these labels.
+type LabelAggregation struct {
+	// Prefixes selects the metrics by key prefix, with '.' as the
+	// separator. The longest matching prefix of all the aggregations wins.
+	// If empty, the aggregation applies to every metric.
+	Prefixes []string
+
+	// Labels are the names of the labels to remove
+	Labels []string
+
+	// Gauge is how the gauges of the merged series are combined
+	Gauge GaugeAggregation
+}
+
+// LabelAggregatingSinkOpts is used to configure a LabelAggregatingSink
+type LabelAggregatingSinkOpts struct {
+	// Aggregations are the labels to remove, and from which metrics
+	Aggregations []LabelAggregation
+
+	// Expiration is how long the value of a merged series is kept once it
+	// is no longer updated, so that the series that stopped reporting
+	// neither count in GaugeMin, GaugeMax and GaugeSum nor use memory. If
+	// zero, it is DefaultLabelAggregationExpiration. If negative, values are
+	// never expired.
+	Expiration time.Duration
+}
+
+// DefaultLabelAggregationExpiration is the default Expiration of a
+// LabelAggregatingSink
+const DefaultLabelAggregationExpiration = 10 * time.Minute
+
+// LabelAggregatingSink wraps a MetricSink and removes labels from metrics,
+// aggregating the series that collapse into one. Unlike BlockedLabels, the
+// merged series are not sent as overwrites of each other:
+//
+//   - Counters, samples and sets are sent as the merged series, with the
+//     labels left sorted by name, so that the wrapped sink sums, merges and
+//     unions them as one series whatever the order of the labels.
+//   - Gauges are combined with a GaugeAggregation, and the combined value
+//     is sent as the merged series.
+type LabelAggregatingSink struct {
+	sink       MetricSink
+	filter     *iradix.Tree
+	expiration time.Duration
+
+	// lock guards gauges. The merged gauges have their own lock, so that
+	// the wrapped sink is only called for one merged gauge at a time.
+	lock   sync.Mutex
+	gauges map[string]*mergedGauge
+
+	// swept is when the expired values were last removed from gauges
+	swept time.Time
+}
+
+// labelAggregation is a compiled LabelAggregation
+type labelAggregation struct {
+	labels map[string]bool
+	gauge  GaugeAggregation
+}
+
+// mergedGauge holds the last value of each series merged into a gauge, and
+// their aggregates, which are updated as the values are
+type mergedGauge struct {
+	// lock is held while the combined value is sent, so that the values
+	// are sent in the order they were combined in
+	lock   sync.Mutex
+	values map[string]mergedGaugeValue
+
+	sum      float64
+	min, max float64
+
+	// stale is set when the min or max value was replaced or removed, and
+	// they have to be found again
+	stale bool
+
+	// removed is set once the sweep removed the merged gauge from the sink
+	removed bool
+}
+
+type mergedGaugeValue struct {
+	value     float64
+	updatedAt time.Time
+}
+
+// NewLabelAggregatingSink creates a LabelAggregatingSink sending to sink
+func NewLabelAggregatingSink(sink MetricSink, opts LabelAggregatingSinkOpts) *LabelAggregatingSink {
+	l := &LabelAggregatingSink{
+		sink:       sink,
+		filter:     iradix.New(),
+		expiration: opts.Expiration,
+		gauges:     make(map[string]*mergedGauge),
+		swept:      time.Now(),
+	}
+	if l.expiration == 0 {
+		l.expiration = DefaultLabelAggregationExpiration
+	}
+	for _, conf := range opts.Aggregations {
+		agg := &labelAggregation{
+			labels: make(map[string]bool),
+			gauge:  conf.Gauge,
+		}
+		for _, name := range conf.Labels {
+			agg.labels[name] = true
+		}
+		prefixes := conf.Prefixes
+		if len(prefixes) == 0 {
+			prefixes = []string{""}
+		}
+		for _, prefix := range prefixes {
+			l.filter, _, _ = l.filter.Insert([]byte(prefix), agg)
+		}
+	}
+	return l
+}
+
+func (l *LabelAggregatingSink) SetGauge(key []string, val float32) {
+	l.SetGaugeWithLabels(key, val, nil)
+}
+
+func (l *LabelAggregatingSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	l.setGauge(key, float64(val), false, labels, func(k []string, v float64, ls []Label) {
+		l.sink.SetGaugeWithLabels(k, float32(v), ls)
+	})
+}
+
+func (l *LabelAggregatingSink) SetPrecisionGauge(key []string, val float64) {
+	l.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+func (l *LabelAggregatingSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	if s, ok := l.sink.(PrecisionGaugeMetricSink); ok {
+		l.setGauge(key, val, false, labels, s.SetPrecisionGaugeWithLabels)
+	}
+}
+
+func (l *LabelAggregatingSink) AddGauge(key []string, delta float32) {
+	l.AddGaugeWithLabels(key, delta, nil)
+}
+
+// AddGaugeWithLabels adds the delta to the value of the series, and sends
+// the combined value as an absolute gauge if labels were removed.
+func (l *LabelAggregatingSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	if agg := l.aggregation(key); agg == nil || !agg.removes(labels) {
+		if s, ok := l.sink.(GaugeDeltaMetricSink); ok {
+			s.AddGaugeWithLabels(key, delta, labels)
+		}
+		return
+	}
+	l.setGauge(key, float64(delta), true, labels, func(k []string, v float64, ls []Label) {
+		l.sink.SetGaugeWithLabels(k, float32(v), ls)
+	})
+}
+
+// EmitKey has no labels and is passed through
+func (l *LabelAggregatingSink) EmitKey(key []string, val float32) {
+	l.sink.EmitKey(key, val)
+}
+
+func (l *LabelAggregatingSink) IncrCounter(key []string, val float32) {
+	l.IncrCounterWithLabels(key, val, nil)
+}
+
+// IncrCounterWithLabels increments the merged series, which the wrapped
+// sink sums the increments of the series merged into
+func (l *LabelAggregatingSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	l.sink.IncrCounterWithLabels(key, val, l.mergedLabels(l.aggregation(key), labels))
+}
+
+func (l *LabelAggregatingSink) AddSample(key []string, val float32) {
+	l.AddSampleWithLabels(key, val, nil)
+}
+
+// AddSampleWithLabels adds the sample to the merged series, which the
+// wrapped sink summarizes the samples of the series merged into with
+func (l *LabelAggregatingSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	l.sink.AddSampleWithLabels(key, val, l.mergedLabels(l.aggregation(key), labels))
+}
+
+func (l *LabelAggregatingSink) AddToSet(key []string, val string) {
+	l.AddToSetWithLabels(key, val, nil)
+}
+
+func (l *LabelAggregatingSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	if s, ok := l.sink.(SetMetricSink); ok {
+		s.AddToSetWithLabels(key, val, l.mergedLabels(l.aggregation(key), labels))
+	}
+}
+
+// Shutdown shuts down the wrapped sink
+func (l *LabelAggregatingSink) Shutdown() {
+	if ss, ok := l.sink.(ShutdownSink); ok {
+		ss.Shutdown()
+	}
+}
+
+// aggregation returns the aggregation applying to key, or nil
+func (l *LabelAggregatingSink) aggregation(key []string) *labelAggregation {
+	if l.filter.Len() == 0 {
+		return nil
+	}
+	_, agg, ok := l.filter.Root().LongestPrefix([]byte(strings.Join(key, ".")))
+	if !ok {
+		return nil
+	}
+	return agg.(*labelAggregation)
+}
+
+// removes returns true if any of the labels is removed by the aggregation
+func (agg *labelAggregation) removes(labels []Label) bool {
+	for _, label := range labels {
+		if agg.labels[label.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedLabels returns the labels of the merged series: the labels not
+// removed by agg, sorted by name. The labels are returned as they are if
+// none is removed, and the given slice is never modified.
+func (l *LabelAggregatingSink) mergedLabels(agg *labelAggregation, labels []Label) []Label {
+	if agg == nil || !agg.removes(labels) {
+		return labels
+	}
+	kept := make([]Label, 0, len(labels))
+	for _, label := range labels {
+		if !agg.labels[label.Name] {
+			kept = append(kept, label)
+		}
+	}
+	return sortLabels(kept, LabelLastWins)
+}
+
+// setGauge records the value of the series, or adds it if delta is set,
+// and sends the combined value of the merged series with send. GaugeLast
+// only keeps the value of the merged series, which deltas are added to.
+// The merged gauge is locked while sending, so that the last value sent is
+// the last one combined.
+func (l *LabelAggregatingSink) setGauge(key []string, val float64, delta bool, labels []Label, send func([]string, float64, []Label)) {
+	agg := l.aggregation(key)
+	if agg == nil || !agg.removes(labels) {
+		send(key, val, labels)
+		return
+	}
+	kept := l.mergedLabels(agg, labels)
+	mergedID, _ := seriesKey(key, kept)
+	seriesID := mergedID
+	if agg.gauge != GaugeLast {
+		seriesID, _ = seriesKey(key, labels)
+	}
+	now := time.Now()
+
+	g := l.mergedGauge(mergedID, now)
+	for {
+		g.lock.Lock()
+		if !g.removed {
+			break
+		}
+		// The sweep removed the merged gauge in the meantime
+		g.lock.Unlock()
+		g = l.mergedGauge(mergedID, now)
+	}
+	defer g.lock.Unlock()
+
+	if delta {
+		val += g.values[seriesID].value
+	}
+	g.set(seriesID, val, now)
+	combined := val
+	if agg.gauge != GaugeLast {
+		combined = g.combine(agg.gauge)
+	}
+	send(key, combined, kept)
+}
+
+// mergedGauge returns the merged gauge with the given ID, creating it if
+// needed, and sweeps the expired values
+func (l *LabelAggregatingSink) mergedGauge(mergedID string, now time.Time) *mergedGauge {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sweep(now)
+	g, ok := l.gauges[mergedID]
+	if !ok {
+		g = &mergedGauge{values: make(map[string]mergedGaugeValue)}
+		l.gauges[mergedID] = g
+	}
+	return g
+}
+
+// sweep removes the expired values of all the merged gauges, and the merged
+// gauges left without values, once per expiration. Values are therefore
+// kept for up to twice the expiration. The lock must be held.
+func (l *LabelAggregatingSink) sweep(now time.Time) {
+	if l.expiration < 0 || now.Sub(l.swept) < l.expiration {
+		return
+	}
+	l.swept = now
+	for mergedID, g := range l.gauges {
+		g.lock.Lock()
+		for id, v := range g.values {
+			if now.Sub(v.updatedAt) > l.expiration {
+				delete(g.values, id)
+			}
+		}
+		if len(g.values) == 0 {
+			g.removed = true
+			delete(l.gauges, mergedID)
+		}
+		// Finding the aggregates again also drops the rounding errors the
+		// running sum accumulated
+		g.aggregate()
+		g.lock.Unlock()
+	}
+}
+
+// set records the value of a series, updating the aggregates. The merged
+// gauge's lock must be held.
+func (g *mergedGauge) set(seriesID string, val float64, now time.Time) {
+	old, ok := g.values[seriesID]
+	g.values[seriesID] = mergedGaugeValue{value: val, updatedAt: now}
+	if !ok {
+		g.sum += val
+	} else {
+		g.sum += val - old.value
+	}
+
+	switch {
+	case len(g.values) == 1:
+		g.min, g.max, g.stale = val, val, false
+	case g.stale:
+	case ok && (old.value == g.min && val > g.min || old.value == g.max && val < g.max):
+		g.stale = true
+	default:
+		g.min = math.Min(g.min, val)
+		g.max = math.Max(g.max, val)
+	}
+}
+
+// aggregate finds the aggregates of the values again. The merged gauge's
+// lock must be held.
+func (g *mergedGauge) aggregate() {
+	g.sum, g.min, g.max, g.stale = 0, math.Inf(1), math.Inf(-1), false
+	for _, v := range g.values {
+		g.sum += v.value
+		g.min = math.Min(g.min, v.value)
+		g.max = math.Max(g.max, v.value)
+	}
+}
+
+// combine returns the value of the merged gauge. The merged gauge's lock
+// must be held.
+func (g *mergedGauge) combine(aggregation GaugeAggregation) float64 {
+	if g.stale {
+		g.aggregate()
+	}
+	switch aggregation {
+	case GaugeMin:
+		return g.min
+	case GaugeMax:
+		return g.max
+	default:
+		return g.sum
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLabelAggregatingSink(t *testing.T) {
+	m := &MockSink{}
+	l := NewLabelAggregatingSink(m, LabelAggregatingSinkOpts{
+		Aggregations: []LabelAggregation{
+			{Prefixes: []string{"http"}, Labels: []string{"path", "peer"}},
+		},
+	})
+
+	labels := []Label{{"method", "GET"}, {"path", "/a"}}
+	l.IncrCounterWithLabels([]string{"http", "requests"}, 1, labels)
+	l.IncrCounterWithLabels([]string{"http", "requests"}, 2, []Label{{"method", "GET"}, {"path", "/b"}})
+	l.AddSampleWithLabels([]string{"http", "latency"}, 3, labels)
+	l.AddToSetWithLabels([]string{"http", "clients"}, "x", []Label{{"peer", "10.0.0.1"}})
+	l.IncrCounterWithLabels([]string{"rpc", "requests"}, 4, labels)
+	l.EmitKey([]string{"http", "key"}, 5)
+
+	expect := [][]Label{
+		{{"method", "GET"}},
+		{{"method", "GET"}},
+		{{"method", "GET"}},
+		{},
+		labels,
+		nil,
+	}
+	if !reflect.DeepEqual(m.labels, expect) {
+		t.Fatalf("bad labels: %v", m.labels)
+	}
+	if !reflect.DeepEqual(m.vals, []float32{1, 2, 3, 4, 5}) {
+		t.Fatalf("bad values: %v", m.vals)
+	}
+	if !reflect.DeepEqual(labels, []Label{{"method", "GET"}, {"path", "/a"}}) {
+		t.Fatalf("labels were modified: %v", labels)
+	}
+}
+
+func TestLabelAggregatingSink_LabelOrder(t *testing.T) {
+	m := &MockSink{}
+	l := NewLabelAggregatingSink(m, LabelAggregatingSinkOpts{
+		Aggregations: []LabelAggregation{{Labels: []string{"path"}}},
+	})
+
+	// The merged series are the same whatever the order of the labels
+	l.IncrCounterWithLabels([]string{"requests"}, 1, []Label{{"path", "/a"}, {"method", "GET"}, {"code", "200"}})
+	l.AddSampleWithLabels([]string{"latency"}, 2, []Label{{"code", "200"}, {"path", "/b"}, {"method", "GET"}})
+
+	merged := []Label{{"code", "200"}, {"method", "GET"}}
+	if !reflect.DeepEqual(m.labels, [][]Label{merged, merged}) {
+		t.Fatalf("bad labels: %v", m.labels)
+	}
+}
+
+func TestLabelAggregatingSink_Gauges(t *testing.T) {
+	key := []string{"pool", "size"}
+	for _, tc := range []struct {
+		name   string
+		gauge  GaugeAggregation
+		expect []float32
+	}{
+		{"last", GaugeLast, []float32{5, 3, 1, 4}},
+		{"min", GaugeMin, []float32{5, 3, 1, 4}},
+		{"max", GaugeMax, []float32{5, 5, 5, 5}},
+		{"sum", GaugeSum, []float32{5, 8, 6, 9}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &MockSink{}
+			l := NewLabelAggregatingSink(m, LabelAggregatingSinkOpts{
+				Aggregations: []LabelAggregation{{Labels: []string{"node"}, Gauge: tc.gauge}},
+			})
+
+			l.SetGaugeWithLabels(key, 5, []Label{{"node", "a"}})
+			l.SetGaugeWithLabels(key, 3, []Label{{"node", "b"}})
+			l.SetGaugeWithLabels(key, 1, []Label{{"node", "b"}})
+			l.AddGaugeWithLabels(key, 3, []Label{{"node", "b"}})
+
+			if !reflect.DeepEqual(m.vals, tc.expect) {
+				t.Fatalf("expected %v, got %v", tc.expect, m.vals)
+			}
+			for _, labels := range m.labels {
+				if len(labels) != 0 {
+					t.Fatalf("labels were not removed: %v", labels)
+				}
+			}
+		})
+	}
+}
+
+func TestLabelAggregatingSink_Concurrent(t *testing.T) {
+	m := &MockSink{}
+	l := NewLabelAggregatingSink(m, LabelAggregatingSinkOpts{
+		Aggregations: []LabelAggregation{{Labels: []string{"node"}, Gauge: GaugeSum}},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			for j := 1; j <= 100; j++ {
+				l.SetGaugeWithLabels([]string{"pool", "size"}, float32(j), []Label{{"node", node}})
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	// The last value sent is the last one combined
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if last := m.vals[len(m.vals)-1]; last != 800 {
+		t.Fatalf("bad last value: %v", last)
+	}
+}
+
+func TestLabelAggregatingSink_Expiration(t *testing.T) {
+	m := &MockSink{}
+	l := NewLabelAggregatingSink(m, LabelAggregatingSinkOpts{
+		Aggregations: []LabelAggregation{{Labels: []string{"node"}, Gauge: GaugeSum}},
+		Expiration:   10 * time.Millisecond,
+	})
+
+	key := []string{"pool", "size"}
+	l.SetGaugeWithLabels(key, 5, []Label{{"node", "a"}})
+	time.Sleep(20 * time.Millisecond)
+	l.SetGaugeWithLabels(key, 3, []Label{{"node", "b"}})
+
+	if !reflect.DeepEqual(m.vals, []float32{5, 3}) {
+		t.Fatalf("expired value was not dropped: %v", m.vals)
+	}
+}
+
+func TestLabelAggregatingSink_Unchanged(t *testing.T) {
+	m := &MockSink{}
+	l := NewLabelAggregatingSink(m, LabelAggregatingSinkOpts{
+		Aggregations: []LabelAggregation{{Prefixes: []string{"pool"}, Labels: []string{"node"}, Gauge: GaugeSum}},
+	})
+
+	// Deltas are passed on for series without removed labels
+	l.AddGaugeWithLabels([]string{"pool", "size"}, 2, []Label{{"dc", "x"}})
+	l.AddGauge([]string{"other"}, 3)
+	l.SetGauge([]string{"other"}, 4)
+
+	if !reflect.DeepEqual(m.vals, []float32{2, 3, 4}) {
+		t.Fatalf("bad values: %v", m.vals)
+	}
+	if !reflect.DeepEqual(m.labels[0], []Label{{"dc", "x"}}) {
+		t.Fatalf("bad labels: %v", m.labels[0])
+	}
+}
+
+func TestLabelAggregatingSink_Sweep(t *testing.T) {
+	m := &MockSink{}
+	l := NewLabelAggregatingSink(m, LabelAggregatingSinkOpts{
+		Aggregations: []LabelAggregation{{Labels: []string{"node"}}},
+		Expiration:   10 * time.Millisecond,
+	})
+
+	l.SetGaugeWithLabels([]string{"a"}, 1, []Label{{"node", "a"}})
+	l.SetGaugeWithLabels([]string{"b"}, 2, []Label{{"node", "b"}})
+	time.Sleep(20 * time.Millisecond)
+	l.SetGaugeWithLabels([]string{"c"}, 3, []Label{{"node", "c"}})
+
+	// The merged gauges that are no longer updated are removed
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.gauges) != 1 || l.gauges["c"] == nil {
+		t.Fatalf("bad gauges: %v", l.gauges)
+	}
+}
+
+func TestNewLabelAggregatingSink_Expiration(t *testing.T) {
+	l := NewLabelAggregatingSink(&MockSink{}, LabelAggregatingSinkOpts{})
+	if l.expiration != DefaultLabelAggregationExpiration {
+		t.Fatalf("bad expiration: %v", l.expiration)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"sync/atomic"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// LabelFilter allows or blocks metrics based on the value of a label. For
+// example {Name: "env", Values: []string{"test"}} blocks every metric with
+// env=test, and {Prefix: "rpc", Name: "method", Values: methods, Allow: true}
+// only keeps the rpc metrics whose method is one of methods.
+type LabelFilter struct {
+	// Prefix restricts the filter to the keys with this prefix, with '.' as
+	// the separator. If empty, the filter applies to every metric.
+	Prefix string
+
+	// Name is the name of the label to look at
+	Name string
+
+	// Values are the label values the filter matches
+	Values []string
+
+	// Allow makes the filter only allow the metrics whose label has one of
+	// Values, metrics without the label are then blocked. Otherwise the
+	// filter blocks the metrics whose label has one of Values.
+	Allow bool
+}
+
+// labelFilter is a compiled LabelFilter
+type labelFilter struct {
+	conf   LabelFilter
+	values map[string]struct{}
+	hits   atomic.Uint64
+}
+
+// allows returns true if the labels pass the filter
+func (f *labelFilter) allows(labels []Label) bool {
+	for _, label := range labels {
+		if label.Name == f.conf.Name {
+			_, ok := f.values[label.Value]
+			return ok == f.conf.Allow
+		}
+	}
+	return !f.conf.Allow
+}
+
+// UpdateLabelFilters overwrites the existing label value filters. Metrics
+// must pass every filter that applies to their key, after the prefix filter.
+// The filters look at the labels as given, before they are filtered and
+// normalized. Like the other filter updates, it increments the version of
+// the FilterConfig.
+func (m *Metrics) UpdateLabelFilters(filters []LabelFilter) {
+	m.filterLock.Lock()
+	defer m.filterLock.Unlock()
+
+	m.updateLabelFilters(filters)
+}
+
+// updateLabelFilters overwrites the existing label value filters
+// the caller should lock m.filterLock while calling this method
+func (m *Metrics) updateLabelFilters(filters []LabelFilter) {
+	m.filterVersion++
+	m.LabelFilters = filters
+	m.labelFilters = nil
+	if len(filters) == 0 {
+		m.labelFilter = nil
+		return
+	}
+
+	// Filters are grouped by prefix, so that a single walk along the key
+	// finds all the filters that apply to it
+	byPrefix := make(map[string][]*labelFilter)
+	for _, conf := range filters {
+		f := &labelFilter{
+			conf:   conf,
+			values: make(map[string]struct{}, len(conf.Values)),
+		}
+		for _, value := range conf.Values {
+			f.values[value] = struct{}{}
+		}
+		byPrefix[conf.Prefix] = append(byPrefix[conf.Prefix], f)
+		m.labelFilters = append(m.labelFilters, f)
+	}
+	txn := iradix.New().Txn()
+	for prefix, fs := range byPrefix {
+		txn.Insert([]byte(prefix), fs)
+	}
+	m.labelFilter = txn.Commit()
+}
+
+// blockingLabelFilter returns the first label value filter that applies to
+// the flattened key and blocks the labels, or nil if they are allowed
+// the caller should lock m.filterLock while calling this method
+func (m *Metrics) blockingLabelFilter(flatKey []byte, labels []Label) *labelFilter {
+	var blocking *labelFilter
+	m.labelFilter.Root().WalkPath(flatKey, func(_ []byte, v any) bool {
+		for _, f := range v.([]*labelFilter) {
+			if !f.allows(labels) {
+				blocking = f
+				return true
+			}
+		}
+		return false
+	})
+	return blocking
+}
@@ -0,0 +1,108 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// LabelNormalizer rewrites label values before they are sent to the sinks,
+// typically to bound their cardinality. Normalizers are set per label name
+// with Config.LabelNormalizers, and must be safe for concurrent use.
+type LabelNormalizer interface {
+	NormalizeLabel(value string) string
+}
+
+// LabelNormalizerFunc adapts a function to the LabelNormalizer interface
+type LabelNormalizerFunc func(value string) string
+
+// NormalizeLabel calls f(value)
+func (f LabelNormalizerFunc) NormalizeLabel(value string) string {
+	return f(value)
+}
+
+// LowercaseNormalizer lower cases label values
+var LowercaseNormalizer LabelNormalizer = LabelNormalizerFunc(strings.ToLower)
+
+// TruncateNormalizer returns a LabelNormalizer that truncates label values
+// to at most n bytes, without splitting a UTF-8 character.
+func TruncateNormalizer(n int) LabelNormalizer {
+	return LabelNormalizerFunc(func(value string) string {
+		if len(value) <= n {
+			return value
+		}
+		end := n
+		for end > 0 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+		return value[:end]
+	})
+}
+
+// RegexNormalizer returns a LabelNormalizer that replaces the matches of
+// pattern with template, which can refer to capture groups as in
+// regexp.Regexp.Expand. For example the pattern `^/users/\d+` with the
+// template "/users/:id" turns "/users/123/posts" into "/users/:id/posts".
+func RegexNormalizer(pattern, template string) (LabelNormalizer, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad label normalizer pattern %q: %w", pattern, err)
+	}
+	return LabelNormalizerFunc(func(value string) string {
+		return re.ReplaceAllString(value, template)
+	}), nil
+}
+
+// BucketNormalizer returns a LabelNormalizer that replaces numeric label
+// values with the smallest of the bounds that is greater than or equal to
+// them, or "+Inf" if there is none. The bounds must be sorted. Values that
+// are not numbers are left unchanged.
+func BucketNormalizer(bounds []float64) LabelNormalizer {
+	return LabelNormalizerFunc(func(value string) string {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return value
+		}
+		for _, bound := range bounds {
+			if v <= bound {
+				return strconv.FormatFloat(bound, 'g', -1, 64)
+			}
+		}
+		return "+Inf"
+	})
+}
+
+// AllowlistNormalizer returns a LabelNormalizer that keeps the allowed
+// label values and replaces the others with fallback, or "other" if
+// fallback is empty.
+func AllowlistNormalizer(allowed []string, fallback string) LabelNormalizer {
+	if fallback == "" {
+		fallback = "other"
+	}
+	set := make(map[string]struct{}, len(allowed))
+	for _, value := range allowed {
+		set[value] = struct{}{}
+	}
+	return LabelNormalizerFunc(func(value string) string {
+		if _, ok := set[value]; ok {
+			return value
+		}
+		return fallback
+	})
+}
+
+// ChainNormalizers returns a LabelNormalizer applying the normalizers in
+// order
+func ChainNormalizers(normalizers ...LabelNormalizer) LabelNormalizer {
+	return LabelNormalizerFunc(func(value string) string {
+		for _, n := range normalizers {
+			value = n.NormalizeLabel(value)
+		}
+		return value
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"testing"
+)
+
+func TestLabelNormalizers(t *testing.T) {
+	path, err := RegexNormalizer(`^/users/\d+`, "/users/:id")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := RegexNormalizer("(", ""); err == nil {
+		t.Fatalf("expected error for bad pattern")
+	}
+
+	for _, tc := range []struct {
+		name       string
+		normalizer LabelNormalizer
+		in, expect string
+	}{
+		{"lowercase", LowercaseNormalizer, "GET", "get"},
+		{"truncate", TruncateNormalizer(5), "connection refused", "conne"},
+		{"truncate short", TruncateNormalizer(5), "eof", "eof"},
+		{"truncate rune", TruncateNormalizer(2), "héllo", "h"},
+		{"regex", path, "/users/123/posts", "/users/:id/posts"},
+		{"regex no match", path, "/health", "/health"},
+		{"bucket", BucketNormalizer([]float64{10, 100}), "37", "100"},
+		{"bucket bound", BucketNormalizer([]float64{10, 100}), "10", "10"},
+		{"bucket inf", BucketNormalizer([]float64{10, 100}), "1e3", "+Inf"},
+		{"bucket not a number", BucketNormalizer([]float64{10, 100}), "abc", "abc"},
+		{"allowlist", AllowlistNormalizer([]string{"GET", "POST"}, ""), "POST", "POST"},
+		{"allowlist other", AllowlistNormalizer([]string{"GET", "POST"}, ""), "BREW", "other"},
+		{"allowlist fallback", AllowlistNormalizer([]string{"GET"}, "unknown"), "PUT", "unknown"},
+		{"chain", ChainNormalizers(LowercaseNormalizer, AllowlistNormalizer([]string{"get"}, "")), "GET", "get"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.normalizer.NormalizeLabel(tc.in); got != tc.expect {
+				t.Fatalf("expected %q, got %q", tc.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LabelStyle selects how StatsdSink and StatsiteSink encode labels
+type LabelStyle int
+
+const (
+	// LabelStyleValues appends the label values to the key and drops the
+	// label names: "key.value:1|c". This is the default.
+	LabelStyleValues LabelStyle = iota
+
+	// LabelStyleDogStatsd adds DogStatsD tags: "key:1|c|#name:value".
+	LabelStyleDogStatsd
+
+	// LabelStyleInflux adds InfluxDB style tags to the key:
+	// "key,name=value:1|c". Labels with an empty value are skipped.
+	LabelStyleInflux
+
+	// LabelStyleGraphite adds Graphite tags to the key:
+	// "key;name=value:1|c". Labels with an empty value are skipped.
+	LabelStyleGraphite
+
+	// LabelStyleSignalFx adds SignalFx dimensions to the key:
+	// "key[name=value]:1|c".
+	LabelStyleSignalFx
+)
+
+var (
+	// InfluxStatsdFormat is the statsd format with InfluxDB style tags.
+	InfluxStatsdFormat = WireFormat{
+		Name:               "influx-statsd",
+		KeyReserved:        ":|@,=",
+		LabelNameReserved:  ":|@,=",
+		LabelValueReserved: ":|@,=",
+	}
+
+	// GraphiteStatsdFormat is the statsd format with Graphite tags.
+	GraphiteStatsdFormat = WireFormat{
+		Name:               "graphite-statsd",
+		KeyReserved:        ":|@;",
+		LabelNameReserved:  ":|@;=!^~",
+		LabelValueReserved: ":|@;~",
+	}
+
+	// SignalFxStatsdFormat is the statsd format with SignalFx dimensions.
+	SignalFxStatsdFormat = WireFormat{
+		Name:               "signalfx-statsd",
+		KeyReserved:        ":|@[]",
+		LabelNameReserved:  ":|@[],=",
+		LabelValueReserved: ":|@[],=",
+	}
+)
+
+var labelStyleNames = map[string]LabelStyle{
+	"values":    LabelStyleValues,
+	"dogstatsd": LabelStyleDogStatsd,
+	"influx":    LabelStyleInflux,
+	"graphite":  LabelStyleGraphite,
+	"signalfx":  LabelStyleSignalFx,
+}
+
+// defaultLabelStyleEncoders replace unsafe characters for each label style
+var defaultLabelStyleEncoders = map[LabelStyle]*LineEncoder{
+	LabelStyleValues:    NewLineEncoder(StatsdFormat, EscapeReplace, nil),
+	LabelStyleDogStatsd: NewLineEncoder(DogStatsdFormat, EscapeReplace, nil),
+	LabelStyleInflux:    NewLineEncoder(InfluxStatsdFormat, EscapeReplace, nil),
+	LabelStyleGraphite:  NewLineEncoder(GraphiteStatsdFormat, EscapeReplace, nil),
+	LabelStyleSignalFx:  NewLineEncoder(SignalFxStatsdFormat, EscapeReplace, nil),
+}
+
+// ParseLabelStyle returns the LabelStyle with the given name, one of
+// "values", "dogstatsd", "influx", "graphite" or "signalfx".
+func ParseLabelStyle(name string) (LabelStyle, error) {
+	style, ok := labelStyleNames[name]
+	if !ok {
+		return LabelStyleValues, fmt.Errorf("unknown label style: %q", name)
+	}
+	return style, nil
+}
+
+// WireFormat returns the wire format a LineEncoder must use for this style.
+func (l LabelStyle) WireFormat() WireFormat {
+	return l.defaultEncoder().Format()
+}
+
+func (l LabelStyle) defaultEncoder() *LineEncoder {
+	if enc, ok := defaultLabelStyleEncoders[l]; ok {
+		return enc
+	}
+	return defaultLabelStyleEncoders[LabelStyleValues]
+}
+
+// formatLabels adds the labels to an already encoded key. It returns the
+// key with labels, and a suffix to write after the metric type. It returns
+// false if the encoder rejected a label and the metric must be dropped.
+func (l LabelStyle) formatLabels(enc *LineEncoder, key string, labels []Label) (string, string, bool) {
+	if len(labels) == 0 {
+		return key, "", true
+	}
+
+	buf := strings.Builder{}
+	if l != LabelStyleDogStatsd {
+		buf.WriteString(key)
+	}
+
+	first := true
+	for _, label := range labels {
+		value, ok := enc.EncodeLabelValue(label.Value)
+		if !ok {
+			return "", "", false
+		}
+		if l == LabelStyleValues {
+			buf.WriteString(".")
+			buf.WriteString(value)
+			continue
+		}
+		if value == "" && (l == LabelStyleInflux || l == LabelStyleGraphite) {
+			continue
+		}
+		name, ok := enc.EncodeLabelName(label.Name)
+		if !ok {
+			return "", "", false
+		}
+
+		switch l {
+		case LabelStyleDogStatsd:
+			if first {
+				buf.WriteString("|#")
+			} else {
+				buf.WriteString(",")
+			}
+			buf.WriteString(name)
+			if value != "" {
+				buf.WriteString(":")
+				buf.WriteString(value)
+			}
+		case LabelStyleInflux:
+			buf.WriteString(",")
+			buf.WriteString(name)
+			buf.WriteString("=")
+			buf.WriteString(value)
+		case LabelStyleGraphite:
+			buf.WriteString(";")
+			buf.WriteString(name)
+			buf.WriteString("=")
+			buf.WriteString(value)
+		case LabelStyleSignalFx:
+			if first {
+				buf.WriteString("[")
+			} else {
+				buf.WriteString(",")
+			}
+			buf.WriteString(name)
+			buf.WriteString("=")
+			buf.WriteString(value)
+		}
+		first = false
+	}
+
+	if l == LabelStyleSignalFx && !first {
+		buf.WriteString("]")
+	}
+	if l == LabelStyleDogStatsd {
+		return key, buf.String(), true
+	}
+	return buf.String(), "", true
+}
@@ -0,0 +1,68 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelStyle_Format(t *testing.T) {
+	labels := []Label{{"method", "GET"}, {"empty", ""}, {"path", "a,b;c=d[e]|f:g"}}
+	for _, tc := range []struct {
+		style  LabelStyle
+		expect string
+	}{
+		{LabelStyleValues, "http.req.GET..a,b;c=d[e]_f_g:1.000000|c\n"},
+		{LabelStyleDogStatsd, "http.req:1.000000|c|#method:GET,empty,path:a_b;c=d[e]_f_g\n"},
+		{LabelStyleInflux, "http.req,method=GET,path=a_b;c_d[e]_f_g:1.000000|c\n"},
+		{LabelStyleGraphite, "http.req;method=GET;path=a,b_c=d[e]_f_g:1.000000|c\n"},
+		{LabelStyleSignalFx, "http.req[method=GET,empty=,path=a_b;c_d_e__f_g]:1.000000|c\n"},
+	} {
+		s := &StatsdSink{metricQueue: make(chan string, 1)}
+		s.SetLabelStyle(tc.style)
+		s.IncrCounterWithLabels([]string{"http", "req"}, 1, labels)
+		if line := <-s.metricQueue; line != tc.expect {
+			t.Fatalf("style %d: expected %q, got %q", tc.style, tc.expect, line)
+		}
+
+		// Metrics without labels are unchanged by the style
+		s.IncrCounter([]string{"http", "req"}, 1)
+		if line := <-s.metricQueue; line != "http.req:1.000000|c\n" {
+			t.Fatalf("style %d: bad line %q", tc.style, line)
+		}
+	}
+}
+
+func TestParseLabelStyle(t *testing.T) {
+	style, err := ParseLabelStyle("graphite")
+	if err != nil || style != LabelStyleGraphite {
+		t.Fatalf("bad style %v %v", style, err)
+	}
+	if _, err := ParseLabelStyle("bogus"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if LabelStyleSignalFx.WireFormat().Name != "signalfx-statsd" {
+		t.Fatalf("bad wire format")
+	}
+}
+
+func FuzzLabelStyle_SingleLine(f *testing.F) {
+	f.Add("http", "req", "method", "GET")
+	f.Add("a,b", "c;d", "e=f", "[g]#h\n")
+	f.Fuzz(func(t *testing.T, k1, k2, name, value string) {
+		for style := LabelStyleValues; style <= LabelStyleSignalFx; style++ {
+			s := &StatsiteSink{metricQueue: make(chan string, 1)}
+			s.SetLabelStyle(style)
+			s.AddSampleWithLabels([]string{k1, k2}, 1, []Label{{name, value}, {"b", "c"}})
+			line := <-s.metricQueue
+			if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+				t.Fatalf("style %d: more than one line: %q", style, line)
+			}
+			if style != LabelStyleDogStatsd && strings.Count(line, "|") != 1 {
+				t.Fatalf("style %d: corrupt line: %q", style, line)
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// LabelConflict decides which label is kept when several labels have the
+// same name
+type LabelConflict int
+
+const (
+	// LabelLastWins keeps the last label with a given name. Labels added by
+	// Metrics, such as "host" and "service", override the caller's. This is
+	// the default.
+	LabelLastWins LabelConflict = iota
+
+	// LabelFirstWins keeps the first label with a given name, so that the
+	// caller's labels override the ones added by Metrics.
+	LabelFirstWins
+)
+
+// ValidLabelName returns true if name is a valid label name for all the
+// supported backends: a letter or '_' followed by letters, digits and '_'.
+func ValidLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CanonicalizeLabels returns the labels sorted by name, with a single label
+// per name chosen by conflict, and without the labels whose name is not
+// valid according to ValidLabelName. Two sets of labels that only differ by
+// their order have the same canonical form. The given slice is not modified.
+func CanonicalizeLabels(labels []Label, conflict LabelConflict) []Label {
+	if labels == nil {
+		return nil
+	}
+	return canonicalizeLabels(slices.Clone(labels), conflict)
+}
+
+// CanonicalizeLabelsStrict is CanonicalizeLabels, returning an error naming
+// every label whose name is not valid rather than only dropping it. The
+// canonical form of the valid labels is returned either way.
+func CanonicalizeLabelsStrict(labels []Label, conflict LabelConflict) ([]Label, error) {
+	var errs []error
+	for _, label := range labels {
+		if !ValidLabelName(label.Name) {
+			errs = append(errs, fmt.Errorf("invalid label name %q", label.Name))
+		}
+	}
+	return CanonicalizeLabels(labels, conflict), errors.Join(errs...)
+}
+
+// canonicalizeLabels is CanonicalizeLabels, modifying the given slice
+func canonicalizeLabels(labels []Label, conflict LabelConflict) []Label {
+	labels = slices.DeleteFunc(labels, func(label Label) bool {
+		return !ValidLabelName(label.Name)
+	})
+	return sortLabels(labels, conflict)
+}
+
+// sortLabels sorts the labels by name, with a single label per name chosen
+// by conflict, modifying the given slice
+func sortLabels(labels []Label, conflict LabelConflict) []Label {
+	// The sort is stable so that the order of labels with the same name
+	// is the order they were added in
+	slices.SortStableFunc(labels, func(a, b Label) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	out := labels[:0]
+	for _, label := range labels {
+		if len(out) > 0 && label.Name == out[len(out)-1].Name {
+			if conflict == LabelLastWins {
+				out[len(out)-1] = label
+			}
+			continue
+		}
+		out = append(out, label)
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalizeLabels(t *testing.T) {
+	labels := []Label{{"b", "1"}, {"a", "2"}, {"host", "x"}, {"bad-name", "3"}, {"host", "y"}, {"", "4"}}
+	orig := append([]Label{}, labels...)
+
+	last := CanonicalizeLabels(labels, LabelLastWins)
+	if !reflect.DeepEqual(last, []Label{{"a", "2"}, {"b", "1"}, {"host", "y"}}) {
+		t.Fatalf("bad last wins labels: %v", last)
+	}
+	first := CanonicalizeLabels(labels, LabelFirstWins)
+	if !reflect.DeepEqual(first, []Label{{"a", "2"}, {"b", "1"}, {"host", "x"}}) {
+		t.Fatalf("bad first wins labels: %v", first)
+	}
+	if !reflect.DeepEqual(labels, orig) {
+		t.Fatalf("labels were modified: %v", labels)
+	}
+
+	reordered := CanonicalizeLabels([]Label{{"host", "y"}, {"a", "2"}, {"b", "1"}}, LabelLastWins)
+	if !reflect.DeepEqual(reordered, last) {
+		t.Fatalf("order changed the canonical labels: %v", reordered)
+	}
+	if CanonicalizeLabels(nil, LabelLastWins) != nil {
+		t.Fatalf("expected nil labels")
+	}
+}
+
+func TestCanonicalizeLabelsStrict(t *testing.T) {
+	labels, err := CanonicalizeLabelsStrict([]Label{{"b", "1"}, {"a", "2"}}, LabelLastWins)
+	if err != nil || !reflect.DeepEqual(labels, []Label{{"a", "2"}, {"b", "1"}}) {
+		t.Fatalf("bad labels: %v %v", labels, err)
+	}
+
+	// Invalid names are reported, and the valid labels still returned
+	labels, err = CanonicalizeLabelsStrict([]Label{{"bad-name", "1"}, {"a", "2"}, {"", "3"}}, LabelLastWins)
+	if err == nil || err.Error() != "invalid label name \"bad-name\"\ninvalid label name \"\"" {
+		t.Fatalf("bad err: %v", err)
+	}
+	if !reflect.DeepEqual(labels, []Label{{"a", "2"}}) {
+		t.Fatalf("bad labels: %v", labels)
+	}
+}
+
+func TestValidLabelName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"host":     true,
+		"_private": true,
+		"Name2":    true,
+		"":         false,
+		"2xx":      false,
+		"a.b":      false,
+		"a-b":      false,
+		"naïve":    false,
+	} {
+		if ValidLabelName(name) != valid {
+			t.Fatalf("ValidLabelName(%q) should be %v", name, valid)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogFormat is how the LogSink writes the metrics
+type LogFormat int
+
+const (
+	// LogFormatSlog logs a log/slog record per series
+	LogFormatSlog LogFormat = iota
+
+	// LogFormatL2met writes a logfmt line per series, using the l2met
+	// conventions: "count#" for counters, "sample#" for gauges, and for
+	// samples "measure#" with their mean and "count#" with their count,
+	// suffixed with ".count"
+	LogFormatL2met
+)
+
+// LogSinkOpts is used to configure a LogSink
+type LogSinkOpts struct {
+	// Format is how the metrics are written
+	Format LogFormat
+
+	// Logger receives the records with LogFormatSlog, slog.Default() if
+	// nil. Level is the level of the records, Info by default.
+	Logger *slog.Logger
+	Level  slog.Level
+
+	// Writer receives the lines with LogFormatL2met, os.Stderr if nil.
+	// Source is the l2met "source" of every line, if set.
+	Writer io.Writer
+	Source string
+
+	// Interval is how often the metrics are summarized and written.
+	// Defaults to 10 seconds.
+	Interval time.Duration
+
+	// KeyFormatter names the metrics, by default the parts of the key are
+	// joined with '.'
+	KeyFormatter KeyFormatter
+}
+
+// LogSink summarizes metrics over an interval, and writes them as log/slog
+// records or l2met logfmt lines, so that log pipelines can extract them.
+// Counters are summed, gauges keep the last value, and samples are reduced
+// to their count, min, max and mean, or to their count and mean in l2met
+// lines. Labels become attributes. Labels named like the attributes of the
+// sink, such as "type" or "count", are prefixed with "label_", and '#' is
+// replaced with '_' in label names, as l2met gives it a meaning.
+type LogSink struct {
+	format     LogFormat
+	logger     *slog.Logger
+	level      slog.Level
+	writer     io.Writer
+	source     string
+	formatter  KeyFormatter
+	aggregator *IntervalAggregator
+}
+
+// NewLogSink creates a LogSink, and starts writing the metrics every
+// interval.
+func NewLogSink(opts LogSinkOpts) (*LogSink, error) {
+	switch opts.Format {
+	case LogFormatSlog, LogFormatL2met:
+	default:
+		return nil, fmt.Errorf("unknown log format: %d", opts.Format)
+	}
+
+	s := &LogSink{
+		format:    opts.Format,
+		logger:    opts.Logger,
+		level:     opts.Level,
+		writer:    opts.Writer,
+		source:    opts.Source,
+		formatter: opts.KeyFormatter,
+	}
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+	if s.writer == nil {
+		s.writer = os.Stderr
+	}
+	s.aggregator = NewIntervalAggregator(IntervalAggregatorOpts{
+		Interval: opts.Interval,
+		Flush:    s.write,
+	})
+	return s, nil
+}
+
+func (s *LogSink) SetGauge(key []string, val float32) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), nil)
+}
+
+func (s *LogSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), labels)
+}
+
+func (s *LogSink) SetPrecisionGauge(key []string, val float64) {
+	s.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+func (s *LogSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	s.aggregator.Add(SeriesGauge, formatKey(s.formatter, key), labels, val)
+}
+
+func (s *LogSink) EmitKey(key []string, val float32) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), nil)
+}
+
+func (s *LogSink) IncrCounter(key []string, val float32) {
+	s.IncrCounterWithLabels(key, val, nil)
+}
+
+func (s *LogSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	s.aggregator.Add(SeriesCounter, formatKey(s.formatter, key), labels, float64(val))
+}
+
+func (s *LogSink) AddSample(key []string, val float32) {
+	s.AddSampleWithLabels(key, val, nil)
+}
+
+func (s *LogSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	s.aggregator.Add(SeriesSample, formatKey(s.formatter, key), labels, float64(val))
+}
+
+// Flush writes the metrics summarized since the previous flush now
+func (s *LogSink) Flush() {
+	s.aggregator.Flush()
+}
+
+// Shutdown stops the sink, and blocks while writing the metrics one last
+// time.
+func (s *LogSink) Shutdown() {
+	s.aggregator.Shutdown()
+}
+
+// write writes the series summarized over an interval
+func (s *LogSink) write(series []*IntervalSeries, now time.Time) {
+	for _, ser := range series {
+		if s.format == LogFormatSlog {
+			s.logRecord(ser)
+		} else {
+			s.writeL2met(ser)
+		}
+	}
+}
+
+// logRecord logs a record named after the series, with its type, values
+// and labels as attributes
+func (s *LogSink) logRecord(ser *IntervalSeries) {
+	attrs := make([]slog.Attr, 0, len(ser.Labels)+5)
+	switch ser.Kind {
+	case SeriesGauge, SeriesCounter:
+		attrs = append(attrs, slog.String("type", ser.Kind.String()), slog.Float64("value", ser.Value))
+	case SeriesSample:
+		attrs = append(attrs,
+			slog.String("type", "sample"),
+			slog.Int("count", ser.Count),
+			slog.Float64("min", ser.Min),
+			slog.Float64("max", ser.Max),
+			slog.Float64("mean", ser.Mean()))
+	}
+	for _, label := range ser.Labels {
+		attrs = append(attrs, slog.String(logLabelName(label.Name), label.Value))
+	}
+	s.logger.LogAttrs(context.Background(), s.level, ser.Name, attrs...)
+}
+
+// writeL2met writes the l2met logfmt line of a series. l2met computes its
+// own statistics from the "measure#" values, so a sample is measured by its
+// mean, and its count is counted separately.
+func (s *LogSink) writeL2met(ser *IntervalSeries) {
+	var buf []byte
+	if s.source != "" {
+		buf = appendLogfmt(buf, "source", s.source)
+	}
+	float := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	switch ser.Kind {
+	case SeriesGauge:
+		buf = appendLogfmt(buf, "sample#"+ser.Name, float(ser.Value))
+	case SeriesCounter:
+		buf = appendLogfmt(buf, "count#"+ser.Name, float(ser.Value))
+	case SeriesSample:
+		buf = appendLogfmt(buf, "count#"+ser.Name+".count", strconv.Itoa(ser.Count))
+		buf = appendLogfmt(buf, "measure#"+ser.Name, float(ser.Mean()))
+	}
+	for _, label := range ser.Labels {
+		buf = appendLogfmt(buf, logLabelName(label.Name), label.Value)
+	}
+	buf = append(buf, '\n')
+
+	if _, err := s.writer.Write(buf); err != nil {
+		log.Printf("[ERR] Error writing metrics log line! Err: %s", err)
+	}
+}
+
+// logReservedNames are the attribute names the LogSink writes itself, in
+// either format
+var logReservedNames = map[string]bool{
+	"source": true,
+	"type":   true,
+	"value":  true,
+	"count":  true,
+	"min":    true,
+	"max":    true,
+	"mean":   true,
+
+	slog.TimeKey:    true,
+	slog.LevelKey:   true,
+	slog.MessageKey: true,
+}
+
+// logLabelName returns the attribute name of a label, which can't be
+// mistaken for one of the sink's attributes
+func logLabelName(name string) string {
+	name = strings.ReplaceAll(name, "#", "_")
+	if logReservedNames[name] {
+		return "label_" + name
+	}
+	return name
+}
+
+// appendLogfmt appends a logfmt key=value pair. The characters not allowed
+// in keys are replaced with '_', and values are quoted if needed.
+func appendLogfmt(buf []byte, key, value string) []byte {
+	if len(buf) > 0 {
+		buf = append(buf, ' ')
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			r = '_'
+		}
+		buf = append(buf, string(r)...)
+	}
+	buf = append(buf, '=')
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+	}) {
+		return strconv.AppendQuote(buf, value)
+	}
+	return append(buf, value...)
+}
@@ -0,0 +1,129 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogSink_L2met(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewLogSink(LogSinkOpts{
+		Format:   LogFormatL2met,
+		Writer:   &buf,
+		Source:   "web1",
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	labels := []Label{{"method", "GET"}, {"path", "/a b"}}
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1, labels)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 2, labels)
+	s.SetGauge([]string{"pool", "size"}, 4)
+	s.SetGauge([]string{"pool", "size"}, 5)
+	s.AddSample([]string{"http", "latency"}, 1)
+	s.AddSample([]string{"http", "latency"}, 3)
+	s.EmitKey([]string{"a key"}, 1)
+	s.Flush()
+
+	expect := []string{
+		`source=web1 sample#a_key=1`,
+		`source=web1 count#http.latency.count=2 measure#http.latency=2`,
+		`source=web1 count#http.requests=3 method=GET path="/a b"`,
+		`source=web1 sample#pool.size=5`,
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad lines: %q", got)
+	}
+
+	// The metrics are summarized per interval
+	buf.Reset()
+	s.Shutdown()
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected lines: %q", buf.String())
+	}
+}
+
+func TestLogSink_Slog(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewLogSink(LogSinkOpts{
+		Logger:   slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Level:    slog.LevelDebug,
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 3, []Label{{"method", "GET"}})
+	s.AddSample([]string{"http", "latency"}, 2)
+	s.Shutdown()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		delete(record, "time")
+		records = append(records, record)
+	}
+	expect := []map[string]any{
+		{"level": "DEBUG", "msg": "http.latency", "type": "sample", "count": 1.0, "min": 2.0, "max": 2.0, "mean": 2.0},
+		{"level": "DEBUG", "msg": "http.requests", "type": "counter", "value": 3.0, "method": "GET"},
+	}
+	if !reflect.DeepEqual(records, expect) {
+		t.Fatalf("bad records: %v", records)
+	}
+}
+
+func TestLogSink_LabelNames(t *testing.T) {
+	labels := []Label{{"count", "1"}, {"measure#x", "2"}, {"source", "3"}, {"type", "4"}}
+
+	var buf bytes.Buffer
+	s, err := NewLogSink(LogSinkOpts{Format: LogFormatL2met, Writer: &buf, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.IncrCounterWithLabels([]string{"requests"}, 1, labels)
+	s.Shutdown()
+
+	// Labels can't be mistaken for the sink's own keys
+	expect := "count#requests=1 label_count=1 measure_x=2 label_source=3 label_type=4\n"
+	if buf.String() != expect {
+		t.Fatalf("bad line: %q", buf.String())
+	}
+
+	buf.Reset()
+	s, err = NewLogSink(LogSinkOpts{
+		Logger:   slog.New(slog.NewJSONHandler(&buf, nil)),
+		Interval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.IncrCounterWithLabels([]string{"requests"}, 1, labels)
+	s.Shutdown()
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if record["type"] != "counter" || record["label_type"] != "4" || record["label_count"] != "1" || record["measure_x"] != "2" {
+		t.Fatalf("bad record: %v", record)
+	}
+}
+
+func TestNewLogSink_Errors(t *testing.T) {
+	if _, err := NewLogSink(LogSinkOpts{Format: 42}); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
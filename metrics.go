@@ -5,7 +5,6 @@ package metrics
 
 import (
 	"runtime"
-	"strings"
 	"time"
 
 	iradix "github.com/hashicorp/go-immutable-radix"
@@ -79,6 +78,64 @@ func (m *Metrics) SetPrecisionGaugeWithLabels(key []string, val float64, labels
 	}
 }
 
+func (m *Metrics) AddGauge(key []string, delta float32) {
+	m.AddGaugeWithLabels(key, delta, nil)
+}
+
+func (m *Metrics) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	if m.HostName != "" {
+		if m.EnableHostnameLabel {
+			labels = append(labels, Label{"host", m.HostName})
+		} else if m.EnableHostname {
+			key = insert(0, m.HostName, key)
+		}
+	}
+	if m.EnableTypePrefix {
+		key = insert(0, "gauge", key)
+	}
+	if m.ServiceName != "" {
+		if m.EnableServiceLabel {
+			labels = append(labels, Label{"service", m.ServiceName})
+		} else {
+			key = insert(0, m.ServiceName, key)
+		}
+	}
+	allowed, labelsFiltered := m.allowMetric(key, labels)
+	if !allowed {
+		return
+	}
+	if sink, ok := m.sink.(GaugeDeltaMetricSink); ok {
+		sink.AddGaugeWithLabels(key, delta, labelsFiltered)
+	}
+}
+
+func (m *Metrics) AddToSet(key []string, val string) {
+	m.AddToSetWithLabels(key, val, nil)
+}
+
+func (m *Metrics) AddToSetWithLabels(key []string, val string, labels []Label) {
+	if m.HostName != "" && m.EnableHostnameLabel {
+		labels = append(labels, Label{"host", m.HostName})
+	}
+	if m.EnableTypePrefix {
+		key = insert(0, "set", key)
+	}
+	if m.ServiceName != "" {
+		if m.EnableServiceLabel {
+			labels = append(labels, Label{"service", m.ServiceName})
+		} else {
+			key = insert(0, m.ServiceName, key)
+		}
+	}
+	allowed, labelsFiltered := m.allowMetric(key, labels)
+	if !allowed {
+		return
+	}
+	if sink, ok := m.sink.(SetMetricSink); ok {
+		sink.AddToSetWithLabels(key, val, labelsFiltered)
+	}
+}
+
 func (m *Metrics) EmitKey(key []string, val float32) {
 	if m.EnableTypePrefix {
 		key = insert(0, "kv", key)
@@ -181,6 +238,12 @@ func (m *Metrics) UpdateFilterAndLabels(allow, block, allowedLabels, blockedLabe
 	m.filterLock.Lock()
 	defer m.filterLock.Unlock()
 
+	m.updateFilterAndLabels(allow, block, allowedLabels, blockedLabels)
+}
+
+// updateFilterAndLabels overwrites the existing filter with the given rules
+// the caller should lock m.filterLock while calling this method
+func (m *Metrics) updateFilterAndLabels(allow, block, allowedLabels, blockedLabels []string) {
 	m.AllowedPrefixes = allow
 	m.BlockedPrefixes = block
 
@@ -202,11 +265,21 @@ func (m *Metrics) UpdateFilterAndLabels(allow, block, allowedLabels, blockedLabe
 
 	m.filter = iradix.New()
 	for _, prefix := range m.AllowedPrefixes {
-		m.filter, _, _ = m.filter.Insert([]byte(prefix), true)
+		m.filter, _, _ = m.filter.Insert([]byte(prefix), &prefixRule{allow: true})
 	}
 	for _, prefix := range m.BlockedPrefixes {
-		m.filter, _, _ = m.filter.Insert([]byte(prefix), false)
+		m.filter, _, _ = m.filter.Insert([]byte(prefix), &prefixRule{allow: false})
 	}
+	m.defaultHits.Store(0)
+	m.filterVersion++
+}
+
+// UpdateLabelNormalizers overwrites the existing label normalizers.
+func (m *Metrics) UpdateLabelNormalizers(normalizers map[string]LabelNormalizer) {
+	m.filterLock.Lock()
+	defer m.filterLock.Unlock()
+
+	m.LabelNormalizers = normalizers
 }
 
 func (m *Metrics) Shutdown() {
@@ -234,7 +307,7 @@ func (m *Metrics) labelIsAllowed(label *Label) bool {
 	return true
 }
 
-// filterLabels return only allowed labels
+// filterLabels return only allowed labels, with their values normalized
 // the caller should lock m.filterLock while calling this method
 func (m *Metrics) filterLabels(labels []Label) []Label {
 	if labels == nil {
@@ -243,28 +316,42 @@ func (m *Metrics) filterLabels(labels []Label) []Label {
 	toReturn := []Label{}
 	for _, label := range labels {
 		if m.labelIsAllowed(&label) {
+			if n, ok := m.LabelNormalizers[label.Name]; ok {
+				label.Value = n.NormalizeLabel(label.Value)
+			}
 			toReturn = append(toReturn, label)
 		}
 	}
 	return toReturn
 }
 
-// Returns whether the metric should be allowed based on configured prefix filters
+// Returns whether the metric should be allowed based on configured prefix and label value filters
 // Also return the applicable labels
 func (m *Metrics) allowMetric(key []string, labels []Label) (bool, []Label) {
 	m.filterLock.RLock()
-	defer m.filterLock.RUnlock()
-
-	if m.filter == nil || m.filter.Len() == 0 {
-		return m.FilterDefault, m.filterLabels(labels)
+	match := m.matchFilter(key, labels)
+	if m.CountFilterHits {
+		match.hit(&m.defaultHits)
 	}
+	sent := m.sinkLabels(labels)
+	m.filterLock.RUnlock()
 
-	_, allowed, ok := m.filter.Root().LongestPrefix([]byte(strings.Join(key, ".")))
-	if !ok {
-		return m.FilterDefault, m.filterLabels(labels)
+	// The dry run is recorded without holding the filter lock
+	if dryRun := m.dryRun.Load(); dryRun != nil {
+		dryRun.record(key, labels, match.allowed, sent)
 	}
+	return match.allowed, sent
+}
 
-	return allowed.(bool), m.filterLabels(labels)
+// sinkLabels returns the filtered labels, made canonical if enabled
+// the caller should lock m.filterLock while calling this method
+func (m *Metrics) sinkLabels(labels []Label) []Label {
+	filtered := m.filterLabels(labels)
+	if !m.CanonicalLabels {
+		return filtered
+	}
+	// filterLabels returns a copy, which can be modified
+	return canonicalizeLabels(filtered, m.LabelConflict)
 }
 
 // Periodically collects runtime stats to publish
@@ -126,6 +126,66 @@ func TestMetrics_SetPrecisionGauge(t *testing.T) {
 	}
 }
 
+func TestMetrics_AddGauge(t *testing.T) {
+	m, met := mockMetric()
+	labels := []Label{{"a", "b"}}
+	met.AddGaugeWithLabels([]string{"key"}, float32(-1), labels)
+	if m.getKeys()[0][0] != "key" {
+		t.Fatalf("")
+	}
+	if m.vals[0] != -1 {
+		t.Fatalf("")
+	}
+	if !reflect.DeepEqual(m.labels[0], labels) {
+		t.Fatalf("")
+	}
+
+	m, met = mockMetric()
+	met.HostName = "test"
+	met.EnableHostname = true
+	met.EnableTypePrefix = true
+	met.AddGauge([]string{"key"}, float32(1))
+	if m.getKeys()[0][0] != "gauge" || m.getKeys()[0][1] != "test" || m.getKeys()[0][2] != "key" {
+		t.Fatalf("")
+	}
+
+	// Sinks without relative gauges ignore the update
+	met = &Metrics{Config: Config{FilterDefault: true}, sink: &noExtrasSink{}}
+	met.AddGauge([]string{"key"}, float32(1))
+}
+
+func TestMetrics_AddToSet(t *testing.T) {
+	m, met := mockMetric()
+	labels := []Label{{"a", "b"}}
+	met.AddToSetWithLabels([]string{"key"}, "user1", labels)
+	if m.getKeys()[0][0] != "key" {
+		t.Fatalf("")
+	}
+	if m.setVals[0] != "user1" {
+		t.Fatalf("")
+	}
+	if !reflect.DeepEqual(m.labels[0], labels) {
+		t.Fatalf("")
+	}
+
+	m, met = mockMetric()
+	met.ServiceName = "service"
+	met.EnableTypePrefix = true
+	met.AddToSet([]string{"key"}, "user1")
+	if m.getKeys()[0][0] != "service" || m.getKeys()[0][1] != "set" || m.getKeys()[0][2] != "key" {
+		t.Fatalf("")
+	}
+
+	// Sinks without sets ignore the value
+	met = &Metrics{Config: Config{FilterDefault: true}, sink: &noExtrasSink{}}
+	met.AddToSet([]string{"key"}, "user1")
+}
+
+// noExtrasSink only implements MetricSink
+type noExtrasSink struct {
+	MetricSink
+}
+
 func TestMetrics_EmitKey(t *testing.T) {
 	m, met := mockMetric()
 	met.EmitKey([]string{"key"}, float32(1))
@@ -573,3 +633,227 @@ func TestMetrics_Filter_Labels_ModifyArgs(t *testing.T) {
 		t.Fatalf("SetGaugeWithLabels modified the input argument")
 	}
 }
+
+func TestMetrics_CanonicalLabels(t *testing.T) {
+	m := &MockSink{}
+	conf := DefaultConfig("svc")
+	conf.HostName = "node1"
+	conf.EnableHostnameLabel = true
+	conf.EnableServiceLabel = true
+	conf.CanonicalLabels = true
+	conf.BlockedLabels = []string{"secret"}
+	met, err := New(conf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := []Label{{"zone", "z1"}, {"host", "caller"}, {"secret", "x"}, {"method", "GET"}}
+	met.IncrCounterWithLabels([]string{"requests"}, 1, labels)
+	expect := []Label{{"host", "node1"}, {"method", "GET"}, {"service", "svc"}, {"zone", "z1"}}
+	if !reflect.DeepEqual(m.labels[0], expect) {
+		t.Fatalf("bad labels: %v", m.labels[0])
+	}
+
+	met.LabelConflict = LabelFirstWins
+	met.IncrCounterWithLabels([]string{"requests"}, 1, labels)
+	expect = []Label{{"host", "caller"}, {"method", "GET"}, {"service", "svc"}, {"zone", "z1"}}
+	if !reflect.DeepEqual(m.labels[1], expect) {
+		t.Fatalf("bad labels: %v", m.labels[1])
+	}
+}
+
+func TestMetrics_LabelNormalizers(t *testing.T) {
+	m, met := mockMetric()
+	met.LabelNormalizers = map[string]LabelNormalizer{
+		"method": LowercaseNormalizer,
+	}
+
+	labels := []Label{{"method", "GET"}, {"path", "/a"}}
+	met.IncrCounterWithLabels([]string{"requests"}, 1, labels)
+	if !reflect.DeepEqual(m.labels[0], []Label{{"method", "get"}, {"path", "/a"}}) {
+		t.Fatalf("bad labels: %v", m.labels[0])
+	}
+	if labels[0].Value != "GET" {
+		t.Fatalf("labels were modified: %v", labels)
+	}
+
+	met.UpdateLabelNormalizers(map[string]LabelNormalizer{
+		"path": AllowlistNormalizer([]string{"/b"}, ""),
+	})
+	met.IncrCounterWithLabels([]string{"requests"}, 1, labels)
+	if !reflect.DeepEqual(m.labels[1], []Label{{"method", "GET"}, {"path", "other"}}) {
+		t.Fatalf("bad labels: %v", m.labels[1])
+	}
+}
+
+func TestMetrics_Filter_LabelValues(t *testing.T) {
+	m := &MockSink{}
+	conf := DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	conf.BlockedPrefixes = []string{"debug"}
+	conf.LabelFilters = []LabelFilter{
+		{Name: "env", Values: []string{"test"}},
+		{Prefix: "rpc", Name: "method", Values: []string{"Get", "Put"}, Allow: true},
+	}
+	met, err := New(conf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	met.IncrCounterWithLabels([]string{"http", "requests"}, 1, []Label{{"env", "test"}})
+	met.IncrCounterWithLabels([]string{"http", "requests"}, 2, []Label{{"env", "prod"}})
+	met.IncrCounterWithLabels([]string{"rpc", "calls"}, 3, []Label{{"method", "Get"}})
+	met.IncrCounterWithLabels([]string{"rpc", "calls"}, 4, []Label{{"method", "Delete"}})
+	met.IncrCounterWithLabels([]string{"rpc", "calls"}, 5, nil)
+	met.IncrCounterWithLabels([]string{"rpc", "calls"}, 6, []Label{{"method", "Put"}, {"env", "test"}})
+	met.IncrCounterWithLabels([]string{"debug", "calls"}, 7, []Label{{"env", "prod"}})
+
+	if !reflect.DeepEqual(m.vals, []float32{2, 3}) {
+		t.Fatalf("bad values: %v", m.vals)
+	}
+
+	// Filters can be replaced at runtime
+	met.UpdateLabelFilters(nil)
+	met.IncrCounterWithLabels([]string{"rpc", "calls"}, 8, []Label{{"env", "test"}})
+	if !reflect.DeepEqual(m.vals, []float32{2, 3, 8}) {
+		t.Fatalf("bad values: %v", m.vals)
+	}
+}
+
+func TestMetrics_ExplainFilter(t *testing.T) {
+	m := &MockSink{}
+	conf := DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	conf.FilterDefault = false
+	conf.AllowedPrefixes = []string{"api", "debug.keep"}
+	conf.BlockedPrefixes = []string{"debug"}
+	conf.BlockedLabels = []string{"user"}
+	conf.LabelFilters = []LabelFilter{{Prefix: "api", Name: "env", Values: []string{"test"}}}
+	met, err := New(conf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := []Label{{"env", "prod"}, {"user", "alice"}}
+	for _, tc := range []struct {
+		key     []string
+		labels  []Label
+		allowed bool
+		rule    FilterRule
+		prefix  string
+	}{
+		{[]string{"api", "calls"}, labels, true, FilterRuleAllowedPrefix, "api"},
+		{[]string{"api", "calls"}, []Label{{"env", "test"}}, false, FilterRuleLabelFilter, "api"},
+		{[]string{"debug", "keep", "x"}, nil, true, FilterRuleAllowedPrefix, "debug.keep"},
+		{[]string{"debug", "x"}, nil, false, FilterRuleBlockedPrefix, "debug"},
+		{[]string{"other"}, nil, false, FilterRuleDefault, ""},
+	} {
+		e := met.ExplainFilter(tc.key, tc.labels)
+		if e.Allowed != tc.allowed || e.Rule != tc.rule || e.Prefix != tc.prefix {
+			t.Fatalf("bad explanation for %v: %+v", tc.key, e)
+		}
+		if tc.rule == FilterRuleLabelFilter && (e.LabelFilter == nil || e.LabelFilter.Name != "env") {
+			t.Fatalf("bad label filter: %v", e.LabelFilter)
+		}
+	}
+
+	e := met.ExplainFilter([]string{"api", "calls"}, labels)
+	if !reflect.DeepEqual(e.Labels, []Label{{"env", "prod"}}) || !reflect.DeepEqual(e.DroppedLabels, []string{"user"}) {
+		t.Fatalf("bad labels: %+v", e)
+	}
+
+	// Explaining doesn't count hits
+	for _, hits := range met.FilterHits() {
+		if hits.Hits != 0 {
+			t.Fatalf("unexpected hits: %+v", hits)
+		}
+	}
+}
+
+func TestMetrics_FilterHits(t *testing.T) {
+	m := &MockSink{}
+	conf := DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	conf.AllowedPrefixes = []string{"api"}
+	conf.BlockedPrefixes = []string{"debug"}
+	conf.LabelFilters = []LabelFilter{{Name: "env", Values: []string{"test"}}}
+	met, err := New(conf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hits are only counted if enabled
+	met.IncrCounter([]string{"api", "calls"}, 1)
+	if hits := met.FilterHits(); hits[1].Hits != 0 {
+		t.Fatalf("unexpected hits: %+v", hits)
+	}
+	met.CountFilterHits = true
+
+	met.IncrCounter([]string{"api", "calls"}, 1)
+	met.IncrCounter([]string{"api", "calls"}, 1)
+	met.IncrCounter([]string{"debug", "calls"}, 1)
+	met.IncrCounterWithLabels([]string{"api", "calls"}, 1, []Label{{"env", "test"}})
+	met.IncrCounter([]string{"other"}, 1)
+
+	expect := []FilterRuleHits{
+		{Rule: FilterRuleDefault, Hits: 1},
+		{Rule: FilterRuleAllowedPrefix, Prefix: "api", Hits: 2},
+		{Rule: FilterRuleBlockedPrefix, Prefix: "debug", Hits: 1},
+		{Rule: FilterRuleLabelFilter, LabelFilter: &conf.LabelFilters[0], Hits: 1},
+	}
+	if hits := met.FilterHits(); !reflect.DeepEqual(hits, expect) {
+		t.Fatalf("bad hits: %+v", hits)
+	}
+
+	// Counters restart with new rules
+	met.UpdateFilter([]string{"api"}, nil)
+	if hits := met.FilterHits(); hits[0].Hits != 0 || hits[1].Hits != 0 {
+		t.Fatalf("hits were not reset: %+v", hits)
+	}
+}
+
+func TestMetrics_FilterDryRun(t *testing.T) {
+	m, met := mockMetric()
+	met.UpdateFilterAndLabels(nil, []string{"debug"}, nil, nil)
+
+	if _, ok := met.FilterDryRunReport(); ok {
+		t.Fatalf("unexpected dry run")
+	}
+	met.StartFilterDryRun(nil, []string{"raft"}, nil, []string{"peer"})
+
+	met.IncrCounter([]string{"raft", "apply"}, 1)
+	met.IncrCounter([]string{"raft", "apply"}, 1)
+	met.IncrCounter([]string{"debug", "x"}, 1)
+	met.IncrCounterWithLabels([]string{"rpc", "calls"}, 1, []Label{{"peer", "a"}, {"method", "Get"}})
+
+	// The proposed rules are not applied
+	if len(m.keys) != 3 {
+		t.Fatalf("bad keys: %v", m.keys)
+	}
+
+	report, ok := met.FilterDryRunReport()
+	if !ok {
+		t.Fatalf("missing dry run")
+	}
+	expect := FilterDryRunReport{
+		Evaluated:     4,
+		WouldBlock:    2,
+		WouldAllow:    1,
+		BlockedKeys:   map[string]uint64{"raft.apply": 2},
+		DroppedLabels: map[string]uint64{"peer": 1},
+	}
+	if !reflect.DeepEqual(report, expect) {
+		t.Fatalf("bad report: %+v", report)
+	}
+
+	if report, ok := met.StopFilterDryRun(); !ok || report.Evaluated != 4 {
+		t.Fatalf("bad report: %+v", report)
+	}
+	met.IncrCounter([]string{"raft", "apply"}, 1)
+	if _, ok := met.FilterDryRunReport(); ok {
+		t.Fatalf("dry run was not stopped")
+	}
+}
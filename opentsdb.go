@@ -0,0 +1,393 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// openTSDBTimeout bounds every connection, write and HTTP request to
+	// OpenTSDB
+	openTSDBTimeout = 10 * time.Second
+)
+
+// OpenTSDBTransport is how the OpenTSDBSink sends metrics to OpenTSDB
+type OpenTSDBTransport int
+
+const (
+	// OpenTSDBHTTP posts JSON to the /api/put endpoint
+	OpenTSDBHTTP OpenTSDBTransport = iota
+
+	// OpenTSDBHTTPS posts JSON to the /api/put endpoint over TLS
+	OpenTSDBHTTPS
+
+	// OpenTSDBTelnet sends "put" lines over TCP
+	OpenTSDBTelnet
+)
+
+// OpenTSDBSinkOpts is used to configure the OpenTSDBSink
+type OpenTSDBSinkOpts struct {
+	// Addr is the host:port of the OpenTSDB server, which serves both
+	// transports on port 4242 by default
+	Addr string
+
+	// Transport is how the metrics are sent
+	Transport OpenTSDBTransport
+
+	// Tags are added to every datapoint, and take precedence over the
+	// labels with the same name. OpenTSDB requires at least one tag per
+	// datapoint, so it is a "host" tag with the hostname if nil, and the
+	// datapoints left without tags, such as when Tags is empty, get that
+	// "host" tag too.
+	Tags []Label
+
+	// BatchSize is the maximum number of datapoints posted in a single
+	// HTTP request, 50 if zero
+	BatchSize int
+
+	// FlushInterval is how often the metrics are aggregated and sent, 10
+	// seconds if zero
+	FlushInterval time.Duration
+
+	// KeyFormatter names the metrics, by default the parts of the key are
+	// joined with '.'
+	KeyFormatter KeyFormatter
+}
+
+// NewOpenTSDBSinkFromURL creates an OpenTSDBSink from a URL. It is used
+// (and tested) from NewMetricSinkFromURL.
+func NewOpenTSDBSinkFromURL(u *url.URL) (MetricSink, error) {
+	params := u.Query()
+	opts := OpenTSDBSinkOpts{Addr: u.Host}
+
+	switch transport := params.Get("transport"); transport {
+	case "", "http":
+	case "https":
+		opts.Transport = OpenTSDBHTTPS
+	case "telnet":
+		opts.Transport = OpenTSDBTelnet
+	default:
+		return nil, fmt.Errorf("bad 'transport' param: unknown transport: %q", transport)
+	}
+	for _, tag := range params["tag"] {
+		name, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			return nil, fmt.Errorf("bad 'tag' param: %q is not name:value", tag)
+		}
+		opts.Tags = append(opts.Tags, Label{Name: name, Value: value})
+	}
+	if size := params.Get("batch_size"); size != "" {
+		var err error
+		if opts.BatchSize, err = strconv.Atoi(size); err != nil {
+			return nil, fmt.Errorf("bad 'batch_size' param: %s", err)
+		}
+	}
+	if interval := params.Get("flush_interval"); interval != "" {
+		var err error
+		if opts.FlushInterval, err = time.ParseDuration(interval); err != nil {
+			return nil, fmt.Errorf("bad 'flush_interval' param: %s", err)
+		}
+	}
+	if name := params.Get("key_format"); name != "" {
+		var err error
+		if opts.KeyFormatter, err = ParseKeyFormatter(name); err != nil {
+			return nil, fmt.Errorf("bad 'key_format' param: %s", err)
+		}
+	}
+	return NewOpenTSDBSink(opts)
+}
+
+// openTSDBDatapoint is a datapoint of the /api/put endpoint
+type openTSDBDatapoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     float64           `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// OpenTSDBSink provides a MetricSink that sends to OpenTSDB, either as JSON
+// posted to the /api/put endpoint, or as "put" lines of the telnet
+// protocol. Metrics are aggregated over the flush interval, and sent as:
+//
+//   - Gauges and keys: the last value
+//   - Counters: the sum of the interval
+//   - Samples: the count, sum, min, max and mean of the interval, as
+//     metrics suffixed with ".count", ".sum", ".min", ".max" and ".mean"
+//
+// Labels become tags. The characters OpenTSDB doesn't accept in metric
+// names and tags are replaced with '_'.
+type OpenTSDBSink struct {
+	opts       OpenTSDBSinkOpts
+	aggregator *IntervalAggregator
+	client     *http.Client
+	putURL     string
+
+	// hostTag is the tag of the datapoints that have none, if the hostname
+	// is known
+	hostTag []Label
+
+	// conn is the telnet connection, only used by the flushes
+	conn net.Conn
+}
+
+// NewOpenTSDBSink is used to create a new OpenTSDBSink
+func NewOpenTSDBSink(opts OpenTSDBSinkOpts) (*OpenTSDBSink, error) {
+	var hostTag []Label
+	hostname, err := os.Hostname()
+	if err == nil {
+		hostTag = []Label{{Name: "host", Value: openTSDBSanitize(hostname)}}
+	}
+	if opts.Tags == nil {
+		if err != nil {
+			return nil, fmt.Errorf("no tags and failed to get the hostname: %w", err)
+		}
+		opts.Tags = hostTag
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+
+	s := &OpenTSDBSink{opts: opts, hostTag: hostTag}
+	switch opts.Transport {
+	case OpenTSDBHTTP, OpenTSDBHTTPS:
+		scheme := "http"
+		if opts.Transport == OpenTSDBHTTPS {
+			scheme = "https"
+		}
+		s.putURL = (&url.URL{Scheme: scheme, Host: opts.Addr, Path: "/api/put"}).String()
+		s.client = &http.Client{Timeout: openTSDBTimeout}
+	case OpenTSDBTelnet:
+	default:
+		return nil, fmt.Errorf("unknown OpenTSDB transport: %d", opts.Transport)
+	}
+
+	s.aggregator = NewIntervalAggregator(IntervalAggregatorOpts{
+		Interval: opts.FlushInterval,
+		Flush:    s.write,
+		Close:    s.close,
+	})
+	return s, nil
+}
+
+// Shutdown stops accepting new metrics, then blocks until the aggregated
+// metrics have been sent to OpenTSDB, or until shutdownTimeout has elapsed.
+func (s *OpenTSDBSink) Shutdown() {
+	s.aggregator.Shutdown()
+}
+
+func (s *OpenTSDBSink) SetGauge(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *OpenTSDBSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesGauge, key, float64(val), labels)
+}
+
+func (s *OpenTSDBSink) SetPrecisionGauge(key []string, val float64) {
+	s.pushMetric(SeriesGauge, key, val, nil)
+}
+
+func (s *OpenTSDBSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	s.pushMetric(SeriesGauge, key, val, labels)
+}
+
+func (s *OpenTSDBSink) EmitKey(key []string, val float32) {
+	s.pushMetric(SeriesGauge, key, float64(val), nil)
+}
+
+func (s *OpenTSDBSink) IncrCounter(key []string, val float32) {
+	s.pushMetric(SeriesCounter, key, float64(val), nil)
+}
+
+func (s *OpenTSDBSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesCounter, key, float64(val), labels)
+}
+
+func (s *OpenTSDBSink) AddSample(key []string, val float32) {
+	s.pushMetric(SeriesSample, key, float64(val), nil)
+}
+
+func (s *OpenTSDBSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	s.pushMetric(SeriesSample, key, float64(val), labels)
+}
+
+// openTSDBTags returns the sanitized tags of a series, which the aggregator
+// sorts by name. Tags with an empty name or value are dropped as OpenTSDB
+// rejects them, and the configured tags replace the labels with the same
+// name. Series left without tags get the host tag.
+func (s *OpenTSDBSink) openTSDBTags(labels []Label) []Label {
+	tags := make([]Label, 0, len(labels)+len(s.opts.Tags))
+	seen := make(map[string]bool, cap(tags))
+	for _, label := range slices.Concat(s.opts.Tags, labels) {
+		name, value := openTSDBSanitize(label.Name), openTSDBSanitize(label.Value)
+		if name == "" || value == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, Label{Name: name, Value: value})
+	}
+	if len(tags) == 0 {
+		return s.hostTag
+	}
+	return tags
+}
+
+// openTSDBSanitize replaces the characters other than letters, digits, '-',
+// '_', '.' and '/' with '_'
+func openTSDBSanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' || r == '/' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// pushMetric adds a metric to the aggregator, which drops the NaN and
+// infinite values OpenTSDB doesn't accept
+func (s *OpenTSDBSink) pushMetric(kind SeriesKind, key []string, val float64, labels []Label) {
+	metric := openTSDBSanitize(formatKey(s.opts.KeyFormatter, key))
+	s.aggregator.Add(kind, metric, s.openTSDBTags(labels), val)
+}
+
+// write sends the series aggregated over an interval
+func (s *OpenTSDBSink) write(series []*IntervalSeries, now time.Time) {
+	points := s.datapoints(series, now)
+
+	var err error
+	if s.opts.Transport == OpenTSDBTelnet {
+		s.conn, err = s.writeTelnet(s.conn, points)
+	} else {
+		err = s.writeHTTP(points)
+	}
+	if err != nil {
+		log.Printf("[ERR] Error writing to OpenTSDB! Err: %s", err)
+	}
+}
+
+// close closes the telnet connection once the last series have been sent
+func (s *OpenTSDBSink) close() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+}
+
+// datapoints returns the datapoints of the aggregated series
+func (s *OpenTSDBSink) datapoints(series []*IntervalSeries, now time.Time) []openTSDBDatapoint {
+	timestamp := now.Unix()
+
+	points := make([]openTSDBDatapoint, 0, len(series))
+	add := func(ser *IntervalSeries, suffix string, value float64) {
+		tags := make(map[string]string, len(ser.Labels))
+		for _, tag := range ser.Labels {
+			tags[tag.Name] = tag.Value
+		}
+		points = append(points, openTSDBDatapoint{
+			Metric:    ser.Name + suffix,
+			Timestamp: timestamp,
+			Value:     value,
+			Tags:      tags,
+		})
+	}
+	for _, ser := range series {
+		switch ser.Kind {
+		case SeriesGauge, SeriesCounter:
+			add(ser, "", ser.Value)
+		case SeriesSample:
+			add(ser, ".count", float64(ser.Count))
+			add(ser, ".sum", ser.Sum)
+			add(ser, ".min", ser.Min)
+			add(ser, ".max", ser.Max)
+			add(ser, ".mean", ser.Mean())
+		}
+	}
+	return points
+}
+
+// writeTelnet sends the datapoints as "put" lines. It returns the
+// connection to use for the next write.
+func (s *OpenTSDBSink) writeTelnet(conn net.Conn, points []openTSDBDatapoint) (net.Conn, error) {
+	if conn == nil {
+		var err error
+		if conn, err = net.DialTimeout("tcp", s.opts.Addr, openTSDBTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf []byte
+	for _, p := range points {
+		buf = fmt.Appendf(buf, "put %s %d %s", p.Metric, p.Timestamp, strconv.FormatFloat(p.Value, 'f', -1, 64))
+		names := make([]string, 0, len(p.Tags))
+		for name := range p.Tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			buf = fmt.Appendf(buf, " %s=%s", name, p.Tags[name])
+		}
+		buf = append(buf, '\n')
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(openTSDBTimeout))
+	if _, err := conn.Write(buf); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// writeHTTP posts the datapoints to the /api/put endpoint, in batches of
+// at most BatchSize datapoints
+func (s *OpenTSDBSink) writeHTTP(points []openTSDBDatapoint) error {
+	var errs []error
+	for batch := range slices.Chunk(points, s.opts.BatchSize) {
+		if err := s.post(batch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// post posts a batch of datapoints
+func (s *OpenTSDBSink) post(points []openTSDBDatapoint) error {
+	body, err := json.Marshal(points)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.putURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("OpenTSDB returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOpenTSDBSink_HTTP(t *testing.T) {
+	var lock sync.Mutex
+	var batches [][]openTSDBDatapoint
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/put" {
+			t.Errorf("bad request: %s %s", r.Method, r.URL)
+		}
+		var batch []openTSDBDatapoint
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("err: %v", err)
+		}
+		lock.Lock()
+		batches = append(batches, batch)
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s, err := NewOpenTSDBSink(OpenTSDBSinkOpts{
+		Addr:          strings.TrimPrefix(srv.URL, "http://"),
+		Tags:          []Label{{"host", "web1"}},
+		BatchSize:     4,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	labels := []Label{{"method", "GET"}, {"host", "ignored"}, {"dc", "eu west"}, {"empty", ""}}
+	s.SetGauge([]string{"pool", "size"}, 4)
+	s.SetGauge([]string{"pool", "size"}, 5)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1, labels)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 2, labels)
+	s.AddSample([]string{"http", "latency"}, 1)
+	s.AddSample([]string{"http", "latency"}, 3)
+	s.Shutdown()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(batches) != 2 || len(batches[0]) != 4 || len(batches[1]) != 3 {
+		t.Fatalf("bad batches: %v", batches)
+	}
+	host := map[string]string{"host": "web1"}
+	expect := []openTSDBDatapoint{
+		{Metric: "http.latency.count", Value: 2, Tags: host},
+		{Metric: "http.latency.sum", Value: 4, Tags: host},
+		{Metric: "http.latency.min", Value: 1, Tags: host},
+		{Metric: "http.latency.max", Value: 3, Tags: host},
+		{Metric: "http.latency.mean", Value: 2, Tags: host},
+		{Metric: "http.requests", Value: 3, Tags: map[string]string{"dc": "eu_west", "host": "web1", "method": "GET"}},
+		{Metric: "pool.size", Value: 5, Tags: host},
+	}
+	got := append(batches[0], batches[1]...)
+	for i := range got {
+		if d := time.Since(time.Unix(got[i].Timestamp, 0)); d < -time.Second || d > time.Minute {
+			t.Fatalf("bad timestamp: %v", got[i])
+		}
+		got[i].Timestamp = 0
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("bad datapoints: %v", got)
+	}
+}
+
+func TestOpenTSDBSink_Telnet(t *testing.T) {
+	addr, received := tcpReceiver(t)
+	s, err := NewOpenTSDBSink(OpenTSDBSinkOpts{
+		Addr:          addr,
+		Transport:     OpenTSDBTelnet,
+		Tags:          []Label{{"host", "web1"}},
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1.5, []Label{{"method", "GET"}})
+	s.Shutdown()
+
+	var data []byte
+	select {
+	case data = <-received:
+	case <-time.After(time.Second):
+		t.Fatalf("nothing was sent")
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 6 || !strings.HasSuffix(string(data), "\n") {
+		t.Fatalf("bad line: %q", data)
+	}
+	fields[2] = "<ts>"
+	expect := []string{"put", "http.requests", "<ts>", "1.5", "host=web1", "method=GET"}
+	if !reflect.DeepEqual(fields, expect) {
+		t.Fatalf("bad line: %q", data)
+	}
+}
+
+func TestOpenTSDBSink_HostTag(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no hostname: %v", err)
+	}
+	s, err := NewOpenTSDBSink(OpenTSDBSinkOpts{Tags: []Label{}, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer s.Shutdown()
+
+	// OpenTSDB requires at least one tag
+	host := []Label{{"host", openTSDBSanitize(hostname)}}
+	if tags := s.openTSDBTags([]Label{{"empty", ""}}); !reflect.DeepEqual(tags, host) {
+		t.Fatalf("bad tags: %v", tags)
+	}
+	if tags := s.openTSDBTags([]Label{{"method", "GET"}}); !reflect.DeepEqual(tags, []Label{{"method", "GET"}}) {
+		t.Fatalf("bad tags: %v", tags)
+	}
+}
+
+func TestNewOpenTSDBSinkFromURL(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		input     string
+		expect    OpenTSDBSinkOpts
+		putURL    string
+		expectErr string
+	}{
+		{
+			desc:   "http",
+			input:  "opentsdb://localhost:4242?tag=host:web1&tag=dc:eu",
+			expect: OpenTSDBSinkOpts{Addr: "localhost:4242", Tags: []Label{{"host", "web1"}, {"dc", "eu"}}, BatchSize: 50, FlushInterval: 10 * time.Second},
+			putURL: "http://localhost:4242/api/put",
+		},
+		{
+			desc:   "https",
+			input:  "opentsdb://localhost:4242?transport=https&tag=host:web1&batch_size=10&flush_interval=1m",
+			expect: OpenTSDBSinkOpts{Addr: "localhost:4242", Transport: OpenTSDBHTTPS, Tags: []Label{{"host", "web1"}}, BatchSize: 10, FlushInterval: time.Minute},
+			putURL: "https://localhost:4242/api/put",
+		},
+		{
+			desc:   "telnet",
+			input:  "opentsdb://localhost:4242?transport=telnet&tag=host:web1",
+			expect: OpenTSDBSinkOpts{Addr: "localhost:4242", Transport: OpenTSDBTelnet, Tags: []Label{{"host", "web1"}}, BatchSize: 50, FlushInterval: 10 * time.Second},
+		},
+		{
+			desc:      "bad transport",
+			input:     "opentsdb://localhost:4242?transport=udp",
+			expectErr: "bad 'transport' param",
+		},
+		{
+			desc:      "bad tag",
+			input:     "opentsdb://localhost:4242?tag=host",
+			expectErr: "bad 'tag' param",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			u, err := url.Parse(tc.input)
+			if err != nil {
+				t.Fatalf("error parsing URL: %s", err)
+			}
+			ms, err := NewOpenTSDBSinkFromURL(u)
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expected err: %q, to contain: %q", err, tc.expectErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %s", err)
+			}
+			s := ms.(*OpenTSDBSink)
+			defer s.Shutdown()
+			if !reflect.DeepEqual(s.opts, tc.expect) {
+				t.Fatalf("bad opts: %+v", s.opts)
+			}
+			if s.putURL != tc.putURL {
+				t.Fatalf("bad put URL: %s", s.putURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,511 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+// OpenTelemetry Meter API bridge
+
+package otel
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+var (
+	// DefaultMeterProviderOpts is the default set of options used when
+	// creating a MeterProvider.
+	DefaultMeterProviderOpts = MeterProviderOpts{
+		CollectInterval: 10 * time.Second,
+	}
+)
+
+// MeterProviderOpts is used to configure the MeterProvider
+type MeterProviderOpts struct {
+	// Metrics receives the measurements. If nil, they go to the global
+	// metrics, as configured at the time of the measurement.
+	Metrics *metrics.Metrics
+
+	// CollectInterval is how often the callbacks of the observable
+	// instruments are run
+	CollectInterval time.Duration
+
+	// MeterLabel, if set, is the name of a label added to every metric,
+	// holding the name of the meter it was measured with
+	MeterLabel string
+}
+
+// MeterProvider implements the OpenTelemetry metric.MeterProvider, so that
+// code instrumented with OpenTelemetry emits into go-metrics. Instrument
+// names are split on '.' into keys, and attributes become labels:
+//
+//   - Counters and observable counters increment counters
+//   - UpDownCounters add to gauges, observable ones set gauges
+//   - Gauges and observable gauges set precision gauges
+//   - Histograms add samples
+//
+// Instrument options such as the unit, description and bucket boundaries
+// are ignored.
+type MeterProvider struct {
+	embedded.MeterProvider
+
+	metrics    *metrics.Metrics
+	meterLabel string
+
+	// collectLock serializes the collections
+	collectLock sync.Mutex
+
+	lock      sync.Mutex
+	callbacks map[*registration]func(context.Context) error
+	shutdown  bool
+
+	// observed holds the last value of the observable counters, which are
+	// cumulative, to increment the go-metrics counters by the difference.
+	// The values not observed by the last collection are removed.
+	observed   map[string]observedValue
+	collection uint64
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// observedValue is the last value of an observable counter, and the
+// collection it was observed in
+type observedValue struct {
+	value      float64
+	collection uint64
+}
+
+// NewMeterProvider creates a new MeterProvider emitting into the global
+// metrics, using the default options.
+func NewMeterProvider() *MeterProvider {
+	return NewMeterProviderFrom(DefaultMeterProviderOpts)
+}
+
+// NewMeterProviderFrom creates a new MeterProvider using the passed options.
+func NewMeterProviderFrom(opts MeterProviderOpts) *MeterProvider {
+	interval := opts.CollectInterval
+	if interval <= 0 {
+		interval = DefaultMeterProviderOpts.CollectInterval
+	}
+	p := &MeterProvider{
+		metrics:    opts.Metrics,
+		meterLabel: opts.MeterLabel,
+		callbacks:  make(map[*registration]func(context.Context) error),
+		observed:   make(map[string]observedValue),
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	go p.run(interval)
+	return p
+}
+
+// Meter returns a Meter emitting into go-metrics. The options are ignored.
+func (p *MeterProvider) Meter(name string, _ ...metric.MeterOption) metric.Meter {
+	return &meter{provider: p, name: name}
+}
+
+// Collect runs the callbacks of the observable instruments now. The
+// observable counters that none of the callbacks observed are forgotten,
+// unless a callback failed.
+func (p *MeterProvider) Collect(ctx context.Context) {
+	p.collectLock.Lock()
+	defer p.collectLock.Unlock()
+
+	p.lock.Lock()
+	p.collection++
+	collection := p.collection
+	callbacks := make([]func(context.Context) error, 0, len(p.callbacks))
+	for _, f := range p.callbacks {
+		callbacks = append(callbacks, f)
+	}
+	p.lock.Unlock()
+
+	failed := false
+	for _, f := range callbacks {
+		if err := f(ctx); err != nil {
+			log.Printf("[ERR] Error collecting OpenTelemetry observable instruments! Err: %s", err)
+			failed = true
+		}
+	}
+	if failed {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for id, v := range p.observed {
+		if v.collection != collection {
+			delete(p.observed, id)
+		}
+	}
+}
+
+// Shutdown stops running the callbacks of the observable instruments, and
+// unregisters them
+func (p *MeterProvider) Shutdown() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+		<-p.doneCh
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		p.shutdown = true
+		clear(p.callbacks)
+		clear(p.observed)
+	})
+}
+
+func (p *MeterProvider) run(interval time.Duration) {
+	defer close(p.doneCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.Collect(context.Background())
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// sink returns the metrics receiving the measurements
+func (p *MeterProvider) sink() *metrics.Metrics {
+	if p.metrics != nil {
+		return p.metrics
+	}
+	return metrics.Default()
+}
+
+// register adds a callback run on every collection, unless the provider
+// was shut down
+func (p *MeterProvider) register(f func(context.Context) error) *registration {
+	r := &registration{provider: p}
+	p.lock.Lock()
+	if !p.shutdown {
+		p.callbacks[r] = f
+	}
+	p.lock.Unlock()
+	return r
+}
+
+// registration implements metric.Registration
+type registration struct {
+	embedded.Registration
+	provider *MeterProvider
+}
+
+func (r *registration) Unregister() error {
+	r.provider.lock.Lock()
+	delete(r.provider.callbacks, r)
+	r.provider.lock.Unlock()
+	return nil
+}
+
+// instrumentKind is how the measurements of an instrument are emitted
+type instrumentKind int
+
+const (
+	kindCounter instrumentKind = iota
+	kindUpDownCounter
+	kindGauge
+	kindHistogram
+	kindObservableCounter
+	kindObservableUpDownCounter
+	kindObservableGauge
+)
+
+// instrument emits the measurements of an OpenTelemetry instrument
+type instrument struct {
+	provider *MeterProvider
+	kind     instrumentKind
+	key      []string
+	meter    string
+}
+
+func (i *instrument) Enabled(context.Context) bool {
+	return true
+}
+
+func (i *instrument) emit(val float64, attrs attribute.Set) {
+	labels := make([]metrics.Label, 0, attrs.Len()+1)
+	for iter := attrs.Iter(); iter.Next(); {
+		kv := iter.Attribute()
+		labels = append(labels, metrics.Label{Name: string(kv.Key), Value: kv.Value.Emit()})
+	}
+	if i.provider.meterLabel != "" {
+		labels = append(labels, metrics.Label{Name: i.provider.meterLabel, Value: i.meter})
+	}
+
+	m := i.provider.sink()
+	switch i.kind {
+	case kindCounter:
+		m.IncrCounterWithLabels(i.key, float32(val), labels)
+	case kindUpDownCounter:
+		m.AddGaugeWithLabels(i.key, float32(val), labels)
+	case kindGauge, kindObservableUpDownCounter, kindObservableGauge:
+		m.SetPrecisionGaugeWithLabels(i.key, val, labels)
+	case kindHistogram:
+		m.AddSampleWithLabels(i.key, float32(val), labels)
+	case kindObservableCounter:
+		// Observed values are totals, a lower one means that the counter
+		// was reset
+		id := i.meter + "|" + strings.Join(i.key, ".") + "|" + attrs.Encoded(attribute.DefaultEncoder())
+		p := i.provider
+		p.lock.Lock()
+		last, ok := p.observed[id]
+		p.observed[id] = observedValue{value: val, collection: p.collection}
+		p.lock.Unlock()
+
+		delta := val
+		if ok && val >= last.value {
+			delta = val - last.value
+		}
+		if delta != 0 {
+			m.IncrCounterWithLabels(i.key, float32(delta), labels)
+		}
+	}
+}
+
+// meter implements metric.Meter. The noop.Meter provides the methods
+// added to the interface in the future.
+type meter struct {
+	noop.Meter
+	provider *MeterProvider
+	name     string
+}
+
+func (m *meter) instrument(kind instrumentKind, name string) *instrument {
+	return &instrument{
+		provider: m.provider,
+		kind:     kind,
+		key:      strings.Split(name, "."),
+		meter:    m.name,
+	}
+}
+
+func (m *meter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &int64Instrument{instrument: m.instrument(kindCounter, name)}, nil
+}
+
+func (m *meter) Int64UpDownCounter(name string, _ ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	return &int64Instrument{instrument: m.instrument(kindUpDownCounter, name)}, nil
+}
+
+func (m *meter) Int64Histogram(name string, _ ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	return &int64Instrument{instrument: m.instrument(kindHistogram, name)}, nil
+}
+
+func (m *meter) Int64Gauge(name string, _ ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	return &int64Instrument{instrument: m.instrument(kindGauge, name)}, nil
+}
+
+func (m *meter) Float64Counter(name string, _ ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	return &float64Instrument{instrument: m.instrument(kindCounter, name)}, nil
+}
+
+func (m *meter) Float64UpDownCounter(name string, _ ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	return &float64Instrument{instrument: m.instrument(kindUpDownCounter, name)}, nil
+}
+
+func (m *meter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &float64Instrument{instrument: m.instrument(kindHistogram, name)}, nil
+}
+
+func (m *meter) Float64Gauge(name string, _ ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	return &float64Instrument{instrument: m.instrument(kindGauge, name)}, nil
+}
+
+func (m *meter) Int64ObservableCounter(name string, opts ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	callbacks := metric.NewInt64ObservableCounterConfig(opts...).Callbacks()
+	return m.int64Observable(kindObservableCounter, name, callbacks), nil
+}
+
+func (m *meter) Int64ObservableUpDownCounter(name string, opts ...metric.Int64ObservableUpDownCounterOption) (metric.Int64ObservableUpDownCounter, error) {
+	callbacks := metric.NewInt64ObservableUpDownCounterConfig(opts...).Callbacks()
+	return m.int64Observable(kindObservableUpDownCounter, name, callbacks), nil
+}
+
+func (m *meter) Int64ObservableGauge(name string, opts ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	callbacks := metric.NewInt64ObservableGaugeConfig(opts...).Callbacks()
+	return m.int64Observable(kindObservableGauge, name, callbacks), nil
+}
+
+func (m *meter) Float64ObservableCounter(name string, opts ...metric.Float64ObservableCounterOption) (metric.Float64ObservableCounter, error) {
+	callbacks := metric.NewFloat64ObservableCounterConfig(opts...).Callbacks()
+	return m.float64Observable(kindObservableCounter, name, callbacks), nil
+}
+
+func (m *meter) Float64ObservableUpDownCounter(name string, opts ...metric.Float64ObservableUpDownCounterOption) (metric.Float64ObservableUpDownCounter, error) {
+	callbacks := metric.NewFloat64ObservableUpDownCounterConfig(opts...).Callbacks()
+	return m.float64Observable(kindObservableUpDownCounter, name, callbacks), nil
+}
+
+func (m *meter) Float64ObservableGauge(name string, opts ...metric.Float64ObservableGaugeOption) (metric.Float64ObservableGauge, error) {
+	callbacks := metric.NewFloat64ObservableGaugeConfig(opts...).Callbacks()
+	return m.float64Observable(kindObservableGauge, name, callbacks), nil
+}
+
+func (m *meter) int64Observable(kind instrumentKind, name string, callbacks []metric.Int64Callback) *int64Observable {
+	o := &int64Observable{instrument: m.instrument(kind, name)}
+	for _, cb := range callbacks {
+		o.registrations = append(o.registrations, m.provider.register(func(ctx context.Context) error {
+			return cb(ctx, &int64Observer{instrument: o.instrument})
+		}))
+	}
+	return o
+}
+
+func (m *meter) float64Observable(kind instrumentKind, name string, callbacks []metric.Float64Callback) *float64Observable {
+	o := &float64Observable{instrument: m.instrument(kind, name)}
+	for _, cb := range callbacks {
+		o.registrations = append(o.registrations, m.provider.register(func(ctx context.Context) error {
+			return cb(ctx, &float64Observer{instrument: o.instrument})
+		}))
+	}
+	return o
+}
+
+// RegisterCallback registers f to be run on every collection. Observations
+// of instruments that were not passed, or not created by a MeterProvider,
+// are dropped.
+func (m *meter) RegisterCallback(f metric.Callback, instruments ...metric.Observable) (metric.Registration, error) {
+	allowed := make(map[*instrument]struct{}, len(instruments))
+	for _, inst := range instruments {
+		switch o := inst.(type) {
+		case *int64Observable:
+			allowed[o.instrument] = struct{}{}
+		case *float64Observable:
+			allowed[o.instrument] = struct{}{}
+		}
+	}
+	return m.provider.register(func(ctx context.Context) error {
+		return f(ctx, &observer{allowed: allowed})
+	}), nil
+}
+
+// int64Instrument implements the synchronous int64 instruments
+type int64Instrument struct {
+	embedded.Int64Counter
+	embedded.Int64UpDownCounter
+	embedded.Int64Histogram
+	embedded.Int64Gauge
+	*instrument
+}
+
+func (i *int64Instrument) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	i.emit(float64(incr), metric.NewAddConfig(opts).Attributes())
+}
+
+func (i *int64Instrument) Record(_ context.Context, value int64, opts ...metric.RecordOption) {
+	i.emit(float64(value), metric.NewRecordConfig(opts).Attributes())
+}
+
+// float64Instrument implements the synchronous float64 instruments
+type float64Instrument struct {
+	embedded.Float64Counter
+	embedded.Float64UpDownCounter
+	embedded.Float64Histogram
+	embedded.Float64Gauge
+	*instrument
+}
+
+func (i *float64Instrument) Add(_ context.Context, incr float64, opts ...metric.AddOption) {
+	i.emit(incr, metric.NewAddConfig(opts).Attributes())
+}
+
+func (i *float64Instrument) Record(_ context.Context, value float64, opts ...metric.RecordOption) {
+	i.emit(value, metric.NewRecordConfig(opts).Attributes())
+}
+
+// int64Observable implements the asynchronous int64 instruments. The
+// embedded metric.Int64Observable is always nil, it only provides the
+// unexported methods of the interface.
+type int64Observable struct {
+	metric.Int64Observable
+	embedded.Int64ObservableCounter
+	embedded.Int64ObservableUpDownCounter
+	embedded.Int64ObservableGauge
+	*instrument
+	observableCallbacks
+}
+
+// float64Observable implements the asynchronous float64 instruments
+type float64Observable struct {
+	metric.Float64Observable
+	embedded.Float64ObservableCounter
+	embedded.Float64ObservableUpDownCounter
+	embedded.Float64ObservableGauge
+	*instrument
+	observableCallbacks
+}
+
+// observableCallbacks are the registrations of the callbacks an observable
+// instrument was created with
+type observableCallbacks struct {
+	registrations []*registration
+}
+
+// Unregister removes the callbacks the instrument was created with, which
+// the OpenTelemetry API has no other way to remove. Shutdown removes them
+// too.
+func (c *observableCallbacks) Unregister() error {
+	for _, r := range c.registrations {
+		_ = r.Unregister()
+	}
+	return nil
+}
+
+// int64Observer implements metric.Int64Observer
+type int64Observer struct {
+	embedded.Int64Observer
+	instrument *instrument
+}
+
+func (o *int64Observer) Observe(value int64, opts ...metric.ObserveOption) {
+	o.instrument.emit(float64(value), metric.NewObserveConfig(opts).Attributes())
+}
+
+// float64Observer implements metric.Float64Observer
+type float64Observer struct {
+	embedded.Float64Observer
+	instrument *instrument
+}
+
+func (o *float64Observer) Observe(value float64, opts ...metric.ObserveOption) {
+	o.instrument.emit(value, metric.NewObserveConfig(opts).Attributes())
+}
+
+// observer implements metric.Observer
+type observer struct {
+	embedded.Observer
+	allowed map[*instrument]struct{}
+}
+
+func (o *observer) ObserveInt64(obsrv metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	if inst, ok := obsrv.(*int64Observable); ok {
+		o.observe(inst.instrument, float64(value), opts)
+	}
+}
+
+func (o *observer) ObserveFloat64(obsrv metric.Float64Observable, value float64, opts ...metric.ObserveOption) {
+	if inst, ok := obsrv.(*float64Observable); ok {
+		o.observe(inst.instrument, value, opts)
+	}
+}
+
+func (o *observer) observe(inst *instrument, value float64, opts []metric.ObserveOption) {
+	if _, ok := o.allowed[inst]; ok {
+		inst.emit(value, metric.NewObserveConfig(opts).Attributes())
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+func newTestProvider(t *testing.T) (*metrics.InmemSink, *MeterProvider) {
+	inm := metrics.NewInmemSink(time.Hour, time.Hour)
+	conf := metrics.DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	met, err := metrics.New(conf, inm)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p := NewMeterProviderFrom(MeterProviderOpts{
+		Metrics:         met,
+		CollectInterval: time.Hour,
+		MeterLabel:      "meter",
+	})
+	t.Cleanup(p.Shutdown)
+	return inm, p
+}
+
+func TestMeterProvider(t *testing.T) {
+	inm, p := newTestProvider(t)
+	meter := p.Meter("lib")
+	ctx := context.Background()
+	attrs := metric.WithAttributes(attribute.String("method", "GET"))
+
+	counter, _ := meter.Int64Counter("http.requests")
+	counter.Add(ctx, 2, attrs)
+	counter.Add(ctx, 3, attrs)
+
+	histogram, _ := meter.Float64Histogram("http.latency")
+	histogram.Record(ctx, 1.5)
+	histogram.Record(ctx, 2.5)
+
+	upDown, _ := meter.Int64UpDownCounter("pool.active")
+	upDown.Add(ctx, 3)
+	upDown.Add(ctx, -1)
+
+	gauge, _ := meter.Float64Gauge("pool.load")
+	gauge.Record(ctx, 0.25)
+
+	data := inm.Data()[0]
+	if c := data.Counters["http.requests;method=GET;meter=lib"]; c.Count != 2 || c.Sum != 5 {
+		t.Fatalf("bad counter: %v", data.Counters)
+	}
+	if s := data.Samples["http.latency;meter=lib"]; s.Count != 2 || s.Sum != 4 {
+		t.Fatalf("bad samples: %v", data.Samples)
+	}
+	if g := data.Gauges["pool.active;meter=lib"]; g.Value != 2 {
+		t.Fatalf("bad gauge: %v", data.Gauges)
+	}
+	if g := data.PrecisionGauges["pool.load;meter=lib"]; g.Value != 0.25 {
+		t.Fatalf("bad precision gauge: %v", data.PrecisionGauges)
+	}
+}
+
+func TestMeterProvider_Observable(t *testing.T) {
+	inm, p := newTestProvider(t)
+	meter := p.Meter("lib")
+
+	total := int64(10)
+	_, err := meter.Int64ObservableCounter("rpc.calls", metric.WithInt64Callback(
+		func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(total)
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	queue, _ := meter.Float64ObservableGauge("queue.size")
+	size := 7.0
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(queue, size)
+		return nil
+	}, queue)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ctx := context.Background()
+	p.Collect(ctx)
+	total = 15
+	p.Collect(ctx)
+
+	data := inm.Data()[0]
+	if c := data.Counters["rpc.calls;meter=lib"]; c.Count != 2 || c.Sum != 15 {
+		t.Fatalf("bad counter: %v", data.Counters)
+	}
+	if g := data.PrecisionGauges["queue.size;meter=lib"]; g.Value != 7 {
+		t.Fatalf("bad gauge: %v", data.PrecisionGauges)
+	}
+
+	// Unregistered callbacks are not run anymore
+	if err := reg.Unregister(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	size = 8
+	p.Collect(ctx)
+	if g := inm.Data()[0].PrecisionGauges["queue.size;meter=lib"]; g.Value != 7 {
+		t.Fatalf("callback was not unregistered: %v", g.Value)
+	}
+}
+
+func TestMeterProvider_ObservedExpiration(t *testing.T) {
+	inm, p := newTestProvider(t)
+	meter := p.Meter("lib")
+
+	peer := "a"
+	calls := 0
+	counter, err := meter.Int64ObservableCounter("rpc.calls", metric.WithInt64Callback(
+		func(_ context.Context, o metric.Int64Observer) error {
+			calls++
+			o.Observe(10, metric.WithAttributes(attribute.String("peer", peer)))
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ctx := context.Background()
+	p.Collect(ctx)
+	peer = "b"
+	p.Collect(ctx)
+
+	// The series that are no longer observed are forgotten
+	p.lock.Lock()
+	if len(p.observed) != 1 {
+		t.Fatalf("bad observed: %v", p.observed)
+	}
+	p.lock.Unlock()
+	if c := inm.Data()[0].Counters["rpc.calls;peer=b;meter=lib"]; c.Sum != 10 {
+		t.Fatalf("bad counter: %v", inm.Data()[0].Counters)
+	}
+
+	// The callbacks the instrument was created with can be unregistered
+	if err := counter.(interface{ Unregister() error }).Unregister(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p.Collect(ctx)
+	if calls != 2 {
+		t.Fatalf("callback was not unregistered: %d calls", calls)
+	}
+}
+
+func TestMeterProvider_ShutdownUnregisters(t *testing.T) {
+	_, p := newTestProvider(t)
+	calls := 0
+	_, err := p.Meter("lib").Float64ObservableGauge("queue.size", metric.WithFloat64Callback(
+		func(_ context.Context, o metric.Float64Observer) error {
+			calls++
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	p.Shutdown()
+	p.Collect(context.Background())
+	if calls != 0 {
+		t.Fatalf("callback was not unregistered: %d calls", calls)
+	}
+}
+
+func TestMeterProvider_Global(t *testing.T) {
+	inm := metrics.NewInmemSink(time.Hour, time.Hour)
+	conf := metrics.DefaultConfig("")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+
+	// The global metrics are looked up on every measurement
+	p := NewMeterProvider()
+	defer p.Shutdown()
+	counter, _ := p.Meter("lib").Float64Counter("requests")
+	if _, err := metrics.NewGlobal(conf, inm); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	counter.Add(context.Background(), 1)
+
+	if c := inm.Data()[0].Counters["requests"]; c.Count != 1 {
+		t.Fatalf("bad counter: %v", inm.Data()[0].Counters)
+	}
+}
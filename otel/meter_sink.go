@@ -0,0 +1,146 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package otel
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// MeterSink records metrics into an OpenTelemetry Meter, so that they are
+// exported by the OpenTelemetry SDK along with the metrics of the code
+// instrumented with it:
+//
+//   - Gauges and keys are recorded with Float64Gauge instruments
+//   - Gauge deltas are added to Float64UpDownCounter instruments
+//   - Counters are added to Float64Counter instruments, and must not be
+//     negative
+//   - Samples are recorded with Float64Histogram instruments
+//
+// The Meter must not come from a MeterProvider emitting into the Metrics
+// using this sink, as every metric would then be emitted again.
+type MeterSink struct {
+	meter     metric.Meter
+	formatter metrics.KeyFormatter
+
+	// Instruments by name
+	gauges     sync.Map
+	upDowns    sync.Map
+	counters   sync.Map
+	histograms sync.Map
+}
+
+// NewMeterSink creates a new MeterSink recording into meter
+func NewMeterSink(meter metric.Meter) *MeterSink {
+	return &MeterSink{
+		meter:     meter,
+		formatter: metrics.OTelKeyFormatter,
+	}
+}
+
+// SetKeyFormatter sets how keys are turned into instrument names, by
+// default metrics.OTelKeyFormatter. It must be called before the sink is
+// used.
+func (s *MeterSink) SetKeyFormatter(formatter metrics.KeyFormatter) {
+	s.formatter = formatter
+}
+
+// SetGauge sets value for a gauge metric
+func (s *MeterSink) SetGauge(key []string, val float32) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), nil)
+}
+
+// SetGaugeWithLabels sets value for a gauge metric with the given labels
+func (s *MeterSink) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), labels)
+}
+
+// SetPrecisionGauge sets value for a gauge metric with float64 precision
+func (s *MeterSink) SetPrecisionGauge(key []string, val float64) {
+	s.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+// SetPrecisionGaugeWithLabels sets value for a gauge metric with the given
+// labels and float64 precision
+func (s *MeterSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []metrics.Label) {
+	gauge := loadInstrument[metric.Float64Gauge](&s.gauges, s.formatter.FormatKey(key), func(name string) (metric.Float64Gauge, error) {
+		return s.meter.Float64Gauge(name)
+	}, noop.Float64Gauge{})
+	gauge.Record(context.Background(), val, attributes(labels))
+}
+
+// AddGauge adds delta to a gauge metric
+func (s *MeterSink) AddGauge(key []string, delta float32) {
+	s.AddGaugeWithLabels(key, delta, nil)
+}
+
+// AddGaugeWithLabels adds delta to a gauge metric with the given labels
+func (s *MeterSink) AddGaugeWithLabels(key []string, delta float32, labels []metrics.Label) {
+	upDown := loadInstrument[metric.Float64UpDownCounter](&s.upDowns, s.formatter.FormatKey(key), func(name string) (metric.Float64UpDownCounter, error) {
+		return s.meter.Float64UpDownCounter(name)
+	}, noop.Float64UpDownCounter{})
+	upDown.Add(context.Background(), float64(delta), attributes(labels))
+}
+
+// EmitKey is recorded as a gauge
+func (s *MeterSink) EmitKey(key []string, val float32) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), nil)
+}
+
+// IncrCounter increments a counter metric
+func (s *MeterSink) IncrCounter(key []string, val float32) {
+	s.IncrCounterWithLabels(key, val, nil)
+}
+
+// IncrCounterWithLabels increments a counter metric with the given labels
+func (s *MeterSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	counter := loadInstrument[metric.Float64Counter](&s.counters, s.formatter.FormatKey(key), func(name string) (metric.Float64Counter, error) {
+		return s.meter.Float64Counter(name)
+	}, noop.Float64Counter{})
+	counter.Add(context.Background(), float64(val), attributes(labels))
+}
+
+// AddSample adds a sample to a histogram metric
+func (s *MeterSink) AddSample(key []string, val float32) {
+	s.AddSampleWithLabels(key, val, nil)
+}
+
+// AddSampleWithLabels adds a sample to a histogram metric with the given
+// labels
+func (s *MeterSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	histogram := loadInstrument[metric.Float64Histogram](&s.histograms, s.formatter.FormatKey(key), func(name string) (metric.Float64Histogram, error) {
+		return s.meter.Float64Histogram(name)
+	}, noop.Float64Histogram{})
+	histogram.Record(context.Background(), float64(val), attributes(labels))
+}
+
+// loadInstrument returns the instrument with the given name, creating it
+// if needed. If it can't be created, fallback is used instead.
+func loadInstrument[T any](instruments *sync.Map, name string, create func(name string) (T, error), fallback T) T {
+	if inst, ok := instruments.Load(name); ok {
+		return inst.(T)
+	}
+	inst, err := create(name)
+	if err != nil {
+		log.Printf("[ERR] Error creating OpenTelemetry instrument %q! Err: %s", name, err)
+		inst = fallback
+	}
+	actual, _ := instruments.LoadOrStore(name, inst)
+	return actual.(T)
+}
+
+// attributes returns the labels as a measurement option
+func attributes(labels []metrics.Label) metric.MeasurementOption {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for _, label := range labels {
+		attrs = append(attrs, attribute.String(label.Name, label.Value))
+	}
+	return metric.WithAttributes(attrs...)
+}
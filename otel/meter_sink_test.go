@@ -0,0 +1,61 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMeterSink(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	s := NewMeterSink(provider.Meter("test"))
+
+	labels := []metrics.Label{{Name: "method", Value: "GET"}}
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 2, labels)
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 3, labels)
+	s.SetGauge([]string{"pool", "size"}, 4)
+	s.SetPrecisionGauge([]string{"pool", "load"}, 0.25)
+	s.AddGauge([]string{"pool", "active"}, 3)
+	s.AddGauge([]string{"pool", "active"}, -1)
+	s.AddSample([]string{"http", "latency"}, 1.5)
+	s.AddSample([]string{"http", "latency"}, 2.5)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	got := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+
+	sum := got["http.requests"].(metricdata.Sum[float64])
+	if !sum.IsMonotonic || sum.DataPoints[0].Value != 5 {
+		t.Fatalf("bad counter: %+v", sum)
+	}
+	if v, _ := sum.DataPoints[0].Attributes.Value(attribute.Key("method")); v.AsString() != "GET" {
+		t.Fatalf("bad attributes: %v", sum.DataPoints[0].Attributes)
+	}
+	if g := got["pool.size"].(metricdata.Gauge[float64]); g.DataPoints[0].Value != 4 {
+		t.Fatalf("bad gauge: %+v", g)
+	}
+	if g := got["pool.load"].(metricdata.Gauge[float64]); g.DataPoints[0].Value != 0.25 {
+		t.Fatalf("bad precision gauge: %+v", g)
+	}
+	if u := got["pool.active"].(metricdata.Sum[float64]); u.IsMonotonic || u.DataPoints[0].Value != 2 {
+		t.Fatalf("bad gauge delta: %+v", u)
+	}
+	if h := got["http.latency"].(metricdata.Histogram[float64]); h.DataPoints[0].Count != 2 || h.DataPoints[0].Sum != 4 {
+		t.Fatalf("bad histogram: %+v", h)
+	}
+}
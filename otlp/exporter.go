@@ -0,0 +1,189 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// exporter sends export requests to an OTLP receiver
+type exporter interface {
+	export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error
+	close() error
+}
+
+// retryableError is a transient export error
+type retryableError struct {
+	err error
+
+	// after is how long the server asked to wait before retrying, if set
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func newExporter(opts OTLPOpts) (exporter, error) {
+	switch opts.Protocol {
+	case ProtocolHTTPProtobuf, ProtocolHTTPJSON:
+		endpoint := opts.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultHTTPEndpoint
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = opts.TLSConfig
+		return &httpExporter{
+			client:   &http.Client{Transport: transport},
+			endpoint: endpoint,
+			json:     opts.Protocol == ProtocolHTTPJSON,
+			headers:  opts.Headers,
+		}, nil
+
+	case ProtocolGRPC:
+		endpoint := opts.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultGRPCEndpoint
+		}
+		creds := credentials.NewTLS(opts.TLSConfig)
+		if opts.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+		return &grpcExporter{
+			conn:    conn,
+			client:  colmetricpb.NewMetricsServiceClient(conn),
+			headers: metadata.New(opts.Headers),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol: %d", opts.Protocol)
+	}
+}
+
+// httpExporter implements OTLP/HTTP
+type httpExporter struct {
+	client   *http.Client
+	endpoint string
+	json     bool
+	headers  map[string]string
+}
+
+func (e *httpExporter) export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	contentType := "application/x-protobuf"
+	marshal, unmarshal := proto.Marshal, proto.Unmarshal
+	if e.json {
+		// OTLP/JSON encodes enums as integers
+		contentType = "application/json"
+		marshal = protojson.MarshalOptions{UseEnumNumbers: true}.Marshal
+		unmarshal = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal
+	}
+	body, err := marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	for name, value := range e.headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return &retryableError{err: err}
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		var exportResp colmetricpb.ExportMetricsServiceResponse
+		if len(respBody) > 0 && unmarshal(respBody, &exportResp) == nil {
+			logPartialSuccess(&exportResp)
+		}
+		return nil
+
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		retry := &retryableError{err: fmt.Errorf("OTLP receiver returned %s", resp.Status)}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retry.after = time.Duration(seconds) * time.Second
+		}
+		return retry
+
+	default:
+		return fmt.Errorf("OTLP receiver returned %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// grpcExporter implements OTLP/gRPC
+type grpcExporter struct {
+	conn    *grpc.ClientConn
+	client  colmetricpb.MetricsServiceClient
+	headers metadata.MD
+}
+
+func (e *grpcExporter) export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	resp, err := e.client.Export(ctx, req)
+	if err == nil {
+		logPartialSuccess(resp)
+		return nil
+	}
+
+	// These are the retryable codes of the OTLP specification
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+		return &retryableError{err: err}
+	default:
+		return err
+	}
+}
+
+func (e *grpcExporter) close() error {
+	return e.conn.Close()
+}
+
+func logPartialSuccess(resp *colmetricpb.ExportMetricsServiceResponse) {
+	partial := resp.GetPartialSuccess()
+	if partial.GetRejectedDataPoints() > 0 || partial.GetErrorMessage() != "" {
+		log.Printf("[WARN] OTLP receiver rejected %d data points: %s",
+			partial.GetRejectedDataPoints(), partial.GetErrorMessage())
+	}
+}
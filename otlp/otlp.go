@@ -0,0 +1,640 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+// OpenTelemetry OTLP Metrics Sink
+
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	// DefaultHTTPEndpoint is the default URL metrics are posted to with the
+	// HTTP protocols
+	DefaultHTTPEndpoint = "http://localhost:4318/v1/metrics"
+
+	// DefaultGRPCEndpoint is the default address of the collector with
+	// ProtocolGRPC
+	DefaultGRPCEndpoint = "localhost:4317"
+
+	// scopeName is the instrumentation scope of the exported metrics
+	scopeName = "github.com/hashicorp/go-metrics"
+)
+
+// Protocol is the OTLP transport used to export the metrics
+type Protocol int
+
+const (
+	// ProtocolHTTPProtobuf posts binary protobuf messages over HTTP
+	ProtocolHTTPProtobuf Protocol = iota
+
+	// ProtocolHTTPJSON posts JSON encoded messages over HTTP
+	ProtocolHTTPJSON
+
+	// ProtocolGRPC calls the collector's MetricsService over gRPC
+	ProtocolGRPC
+)
+
+// Temporality selects how counters and samples are reported
+type Temporality int
+
+const (
+	// CumulativeTemporality reports the totals since the series was first
+	// seen, on every export. This is the default.
+	CumulativeTemporality Temporality = iota
+
+	// DeltaTemporality reports what changed since the previous export, and
+	// only the series updated since.
+	DeltaTemporality
+)
+
+var (
+	// DefaultOTLPOpts is the default set of options used when creating an
+	// OTLPSink.
+	DefaultOTLPOpts = OTLPOpts{
+		Interval:        10 * time.Second,
+		Timeout:         10 * time.Second,
+		MaxRetries:      3,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: 30 * time.Second,
+		Expiration:      10 * time.Minute,
+	}
+)
+
+// OTLPOpts is used to configure the OTLP Sink
+type OTLPOpts struct {
+	// Protocol is the transport used to export the metrics
+	Protocol Protocol
+
+	// Endpoint is the URL the metrics are posted to with the HTTP protocols,
+	// DefaultHTTPEndpoint if empty. With ProtocolGRPC, it is the host:port
+	// of the collector, DefaultGRPCEndpoint if empty.
+	Endpoint string
+
+	// Headers are added to every export request, as gRPC metadata with
+	// ProtocolGRPC
+	Headers map[string]string
+
+	// TLSConfig is used to connect to HTTPS endpoints, and to the collector
+	// with ProtocolGRPC unless Insecure is set
+	TLSConfig *tls.Config
+
+	// Insecure disables TLS with ProtocolGRPC
+	Insecure bool
+
+	// Interval is how often the metrics are exported
+	Interval time.Duration
+
+	// Timeout bounds every export attempt, and the last export on Shutdown,
+	// retries included
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a failed export is retried, if the
+	// error is transient. Retries wait for RetryBackoff, doubled after each
+	// attempt, or as long as the server asks to, up to MaxRetryBackoff.
+	MaxRetries      int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// Temporality selects how counters and samples are reported. Gauges are
+	// reported in the intervals they are set in.
+	Temporality Temporality
+
+	// Expiration is how long cumulative series are reported once they are
+	// no longer updated. If negative, they are reported for as long as the
+	// sink runs.
+	Expiration time.Duration
+
+	// Resource holds the resource attributes, see ResourceFromConfig
+	Resource map[string]string
+
+	// Buckets are the explicit bounds of the histograms samples are
+	// reported as. If empty, the histograms only have a count, sum, min
+	// and max.
+	Buckets []float64
+
+	// KeyFormatter names the metrics, metrics.OTelKeyFormatter if nil
+	KeyFormatter metrics.KeyFormatter
+}
+
+// ResourceFromConfig returns the resource attributes describing the service
+// and host of conf, to be used as OTLPOpts.Resource.
+func ResourceFromConfig(conf *metrics.Config) map[string]string {
+	resource := make(map[string]string)
+	if conf.ServiceName != "" {
+		resource["service.name"] = conf.ServiceName
+	}
+	if conf.HostName != "" {
+		resource["host.name"] = conf.HostName
+	}
+	return resource
+}
+
+// seriesKind is the kind of OTLP metric a series is reported as
+type seriesKind int
+
+const (
+	kindGauge seriesKind = iota
+	kindSum
+	kindHistogram
+)
+
+// series is the state of a metric with a given name and attributes
+type series struct {
+	kind  seriesKind
+	name  string
+	attrs []*commonpb.KeyValue
+	start time.Time
+
+	// value is the last gauge value, or the sum of a counter
+	value float64
+
+	// decreased is set once a counter was incremented by a negative value,
+	// so that it isn't reported as monotonic
+	decreased bool
+
+	// Histogram state
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+	buckets []uint64
+
+	// updatedAt is when the series was last updated
+	updatedAt time.Time
+}
+
+// merge adds the state of a series that failed to be exported to ser, the
+// same series created since
+func (ser *series) merge(failed *series) {
+	ser.start = failed.start
+	switch ser.kind {
+	case kindSum:
+		ser.value += failed.value
+		ser.decreased = ser.decreased || failed.decreased
+	case kindHistogram:
+		if failed.count > 0 {
+			if ser.count == 0 || failed.min < ser.min {
+				ser.min = failed.min
+			}
+			if ser.count == 0 || failed.max > ser.max {
+				ser.max = failed.max
+			}
+		}
+		ser.count += failed.count
+		ser.sum += failed.sum
+		for i := range ser.buckets {
+			ser.buckets[i] += failed.buckets[i]
+		}
+	}
+}
+
+// OTLPSink aggregates metrics and exports them on an interval to an
+// OpenTelemetry collector, or any other OTLP receiver
+type OTLPSink struct {
+	exporter        exporter
+	resource        *resourcepb.Resource
+	temporality     Temporality
+	expiration      time.Duration
+	buckets         []float64
+	formatter       metrics.KeyFormatter
+	timeout         time.Duration
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+
+	lock       sync.Mutex
+	series     map[string]*series
+	lastExport time.Time
+
+	// exportLock serializes the exports
+	exportLock sync.Mutex
+
+	// ctx is canceled on Shutdown, interrupting the export in progress
+	ctx      context.Context
+	cancel   context.CancelFunc
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewOTLPSink creates a new OTLPSink exporting to a local collector over
+// OTLP/HTTP, using the default options.
+func NewOTLPSink() (*OTLPSink, error) {
+	return NewOTLPSinkFrom(DefaultOTLPOpts)
+}
+
+// NewOTLPSinkFrom creates a new OTLPSink using the passed options.
+func NewOTLPSinkFrom(opts OTLPOpts) (*OTLPSink, error) {
+	if !sort.Float64sAreSorted(opts.Buckets) {
+		return nil, fmt.Errorf("histogram buckets must be sorted")
+	}
+	exp, err := newExporter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultOTLPOpts.Interval
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultOTLPOpts.Timeout
+	}
+	retryBackoff := opts.RetryBackoff
+	if retryBackoff <= 0 {
+		retryBackoff = DefaultOTLPOpts.RetryBackoff
+	}
+	maxRetryBackoff := opts.MaxRetryBackoff
+	if maxRetryBackoff <= 0 {
+		maxRetryBackoff = DefaultOTLPOpts.MaxRetryBackoff
+	}
+	expiration := opts.Expiration
+	if expiration == 0 {
+		expiration = DefaultOTLPOpts.Expiration
+	}
+	formatter := opts.KeyFormatter
+	if formatter == nil {
+		formatter = metrics.OTelKeyFormatter
+	}
+
+	resource := &resourcepb.Resource{}
+	for _, name := range sortedKeys(opts.Resource) {
+		resource.Attributes = append(resource.Attributes, stringAttr(name, opts.Resource[name]))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &OTLPSink{
+		exporter:        exp,
+		resource:        resource,
+		temporality:     opts.Temporality,
+		expiration:      expiration,
+		buckets:         opts.Buckets,
+		formatter:       formatter,
+		timeout:         timeout,
+		maxRetries:      opts.MaxRetries,
+		retryBackoff:    retryBackoff,
+		maxRetryBackoff: maxRetryBackoff,
+		series:          make(map[string]*series),
+		lastExport:      time.Now(),
+		ctx:             ctx,
+		cancel:          cancel,
+		doneCh:          make(chan struct{}),
+	}
+	go s.run(interval)
+	return s, nil
+}
+
+// SetGauge sets value for a gauge metric
+func (s *OTLPSink) SetGauge(key []string, val float32) {
+	s.SetGaugeWithLabels(key, val, nil)
+}
+
+// SetGaugeWithLabels sets value for a gauge metric with the given labels
+func (s *OTLPSink) SetGaugeWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.SetPrecisionGaugeWithLabels(key, float64(val), labels)
+}
+
+// SetPrecisionGauge sets value for a gauge metric with float64 precision
+func (s *OTLPSink) SetPrecisionGauge(key []string, val float64) {
+	s.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+// SetPrecisionGaugeWithLabels sets value for a gauge metric with the given
+// labels and float64 precision
+func (s *OTLPSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []metrics.Label) {
+	s.update(kindGauge, key, labels, func(ser *series) {
+		ser.value = val
+	})
+}
+
+// EmitKey is reported as a gauge
+func (s *OTLPSink) EmitKey(key []string, val float32) {
+	s.SetGaugeWithLabels(key, val, nil)
+}
+
+// IncrCounter increments a counter metric
+func (s *OTLPSink) IncrCounter(key []string, val float32) {
+	s.IncrCounterWithLabels(key, val, nil)
+}
+
+// IncrCounterWithLabels increments a counter metric with the given labels
+func (s *OTLPSink) IncrCounterWithLabels(key []string, val float32, labels []metrics.Label) {
+	s.update(kindSum, key, labels, func(ser *series) {
+		ser.value += float64(val)
+		ser.decreased = ser.decreased || val < 0
+	})
+}
+
+// AddSample adds a sample to a histogram metric
+func (s *OTLPSink) AddSample(key []string, val float32) {
+	s.AddSampleWithLabels(key, val, nil)
+}
+
+// AddSampleWithLabels adds a sample to a histogram metric with the given
+// labels
+func (s *OTLPSink) AddSampleWithLabels(key []string, val float32, labels []metrics.Label) {
+	v := float64(val)
+	s.update(kindHistogram, key, labels, func(ser *series) {
+		if ser.count == 0 || v < ser.min {
+			ser.min = v
+		}
+		if ser.count == 0 || v > ser.max {
+			ser.max = v
+		}
+		ser.count++
+		ser.sum += v
+		ser.buckets[sort.SearchFloat64s(s.buckets, v)]++
+	})
+}
+
+// update applies f to the series of the given kind, key and labels
+func (s *OTLPSink) update(kind seriesKind, key []string, labels []metrics.Label, f func(*series)) {
+	name := s.formatter.FormatKey(key)
+	id := seriesID(kind, name, labels)
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ser, ok := s.series[id]
+	if !ok {
+		ser = &series{
+			kind:  kind,
+			name:  name,
+			attrs: labelAttrs(labels),
+			start: now,
+		}
+		if kind == kindHistogram {
+			ser.buckets = make([]uint64, len(s.buckets)+1)
+		}
+		if s.temporality == DeltaTemporality {
+			ser.start = s.lastExport
+		}
+		s.series[id] = ser
+	}
+	f(ser)
+	ser.updatedAt = now
+}
+
+// Flush exports the metrics now
+func (s *OTLPSink) Flush() {
+	s.flush(s.ctx)
+}
+
+// flush exports the metrics, retrying until ctx is done
+func (s *OTLPSink) flush(ctx context.Context) {
+	s.exportLock.Lock()
+	defer s.exportLock.Unlock()
+
+	req, exported := s.collect(time.Now())
+	if req == nil {
+		return
+	}
+	if err := s.export(ctx, req); err != nil {
+		log.Printf("[ERR] Error exporting metrics to OTLP! Err: %s", err)
+
+		// Data the receiver rejected would be rejected again
+		if _, ok := err.(*retryableError); ok {
+			s.restore(exported)
+		}
+	}
+}
+
+// Shutdown stops the sink, and blocks while exporting the metrics one last
+// time, for up to the export timeout. An export in progress is interrupted.
+func (s *OTLPSink) Shutdown() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		<-s.doneCh
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		s.flush(ctx)
+		if err := s.exporter.close(); err != nil {
+			log.Printf("[WARN] Error closing OTLP exporter! Err: %s", err)
+		}
+	})
+}
+
+func (s *OTLPSink) run(interval time.Duration) {
+	defer close(s.doneCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// collect builds the export request for the interval ending now. Gauges and
+// delta series are removed, and returned so that they can be restored if
+// the export fails. Cumulative series that expired are removed too. It
+// returns nil if there is nothing to export.
+func (s *OTLPSink) collect(now time.Time) (*colmetricpb.ExportMetricsServiceRequest, map[string]*series) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	temporality := metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	if s.temporality == DeltaTemporality {
+		temporality = metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	}
+	timestamp := uint64(now.UnixNano())
+
+	// Series with the same name and kind are data points of the same
+	// metric. Gauges and delta series are removed once exported, so the
+	// remaining series that were not updated are cumulative and reported
+	// again until they expire.
+	byName := make(map[string]*metricpb.Metric)
+	exported := make(map[string]*series)
+	for _, id := range sortedKeys(s.series) {
+		ser := s.series[id]
+		cumulative := ser.kind != kindGauge && s.temporality == CumulativeTemporality
+		if cumulative && s.expiration > 0 && now.Sub(ser.updatedAt) > s.expiration {
+			delete(s.series, id)
+			continue
+		}
+
+		metricID := fmt.Sprintf("%s;%d", ser.name, ser.kind)
+		m, ok := byName[metricID]
+		if !ok {
+			m = &metricpb.Metric{Name: ser.name}
+			switch ser.kind {
+			case kindGauge:
+				m.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{}}
+			case kindSum:
+				m.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+					AggregationTemporality: temporality,
+					IsMonotonic:            true,
+				}}
+			case kindHistogram:
+				m.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+					AggregationTemporality: temporality,
+				}}
+			}
+			byName[metricID] = m
+		}
+
+		start := uint64(ser.start.UnixNano())
+		switch data := m.Data.(type) {
+		case *metricpb.Metric_Gauge:
+			data.Gauge.DataPoints = append(data.Gauge.DataPoints, numberPoint(ser, timestamp, timestamp))
+		case *metricpb.Metric_Sum:
+			// The sum is monotonic unless a series was decremented
+			data.Sum.IsMonotonic = data.Sum.IsMonotonic && !ser.decreased
+			data.Sum.DataPoints = append(data.Sum.DataPoints, numberPoint(ser, start, timestamp))
+		case *metricpb.Metric_Histogram:
+			sum, lo, hi := ser.sum, ser.min, ser.max
+			data.Histogram.DataPoints = append(data.Histogram.DataPoints, &metricpb.HistogramDataPoint{
+				Attributes:        ser.attrs,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      timestamp,
+				Count:             ser.count,
+				Sum:               &sum,
+				Min:               &lo,
+				Max:               &hi,
+				BucketCounts:      append([]uint64(nil), ser.buckets...),
+				ExplicitBounds:    s.buckets,
+			})
+		}
+
+		if !cumulative {
+			exported[id] = ser
+			delete(s.series, id)
+		}
+	}
+	s.lastExport = now
+
+	if len(byName) == 0 {
+		return nil, nil
+	}
+	scope := &metricpb.ScopeMetrics{
+		Scope: &commonpb.InstrumentationScope{Name: scopeName},
+	}
+	for _, metricID := range sortedKeys(byName) {
+		scope.Metrics = append(scope.Metrics, byName[metricID])
+	}
+	return &colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{{
+			Resource:     s.resource,
+			ScopeMetrics: []*metricpb.ScopeMetrics{scope},
+		}},
+	}, exported
+}
+
+// restore puts back the series removed by collect after a failed export,
+// so that they are exported with the next interval. Gauges set since keep
+// their new value.
+func (s *OTLPSink) restore(exported map[string]*series) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, failed := range exported {
+		ser, ok := s.series[id]
+		switch {
+		case !ok:
+			s.series[id] = failed
+		case ser.kind != kindGauge:
+			ser.merge(failed)
+		}
+	}
+}
+
+// export sends the request, retrying on transient errors until ctx is done
+func (s *OTLPSink) export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	backoff := s.retryBackoff
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		err := s.exporter.export(attemptCtx, req)
+		cancel()
+
+		retry, ok := err.(*retryableError)
+		if !ok || attempt >= s.maxRetries {
+			return err
+		}
+		wait := backoff
+		if retry.after > 0 {
+			wait = retry.after
+		}
+		if wait > s.maxRetryBackoff {
+			wait = s.maxRetryBackoff
+		}
+		log.Printf("[WARN] Error exporting metrics to OTLP, retrying in %s! Err: %s", wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func numberPoint(ser *series, start, timestamp uint64) *metricpb.NumberDataPoint {
+	return &metricpb.NumberDataPoint{
+		Attributes:        ser.attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      timestamp,
+		Value:             &metricpb.NumberDataPoint_AsDouble{AsDouble: ser.value},
+	}
+}
+
+// seriesID identifies a series by kind, name and labels
+func seriesID(kind seriesKind, name string, labels []metrics.Label) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d;%s", kind, name)
+	for _, label := range labels {
+		b.WriteString(";")
+		b.WriteString(label.Name)
+		b.WriteString("=")
+		b.WriteString(label.Value)
+	}
+	return b.String()
+}
+
+func labelAttrs(labels []metrics.Label) []*commonpb.KeyValue {
+	if len(labels) == 0 {
+		return nil
+	}
+	attrs := make([]*commonpb.KeyValue, 0, len(labels))
+	for _, label := range labels {
+		attrs = append(attrs, stringAttr(label.Name, label.Value))
+	}
+	return attrs
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,460 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// receiver is an in-process OTLP receiver
+type receiver struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+
+	lock     sync.Mutex
+	requests []*colmetricpb.ExportMetricsServiceRequest
+	headers  []string
+
+	// failures are the HTTP status codes returned before succeeding, with
+	// retryAfter as the Retry-After header if set
+	failures   []int
+	retryAfter string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.headers = append(r.headers, req.Header.Get("X-Test"))
+	if len(r.failures) > 0 {
+		code := r.failures[0]
+		r.failures = r.failures[1:]
+		if r.retryAfter != "" {
+			w.Header().Set("Retry-After", r.retryAfter)
+		}
+		w.WriteHeader(code)
+		return
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	exportReq := &colmetricpb.ExportMetricsServiceRequest{}
+	var err error
+	switch req.Header.Get("Content-Type") {
+	case "application/json":
+		err = protojson.Unmarshal(body, exportReq)
+	case "application/x-protobuf":
+		err = proto.Unmarshal(body, exportReq)
+	default:
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.requests = append(r.requests, exportReq)
+}
+
+func (r *receiver) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.headers = append(r.headers, md.Get("x-test")...)
+	if len(r.failures) > 0 {
+		r.failures = r.failures[1:]
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	r.requests = append(r.requests, req)
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+// metrics returns the metrics of the received requests, by name
+func (r *receiver) metrics() []map[string]*metricpb.Metric {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var out []map[string]*metricpb.Metric
+	for _, req := range r.requests {
+		byName := make(map[string]*metricpb.Metric)
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					byName[m.Name] = m
+				}
+			}
+		}
+		out = append(out, byName)
+	}
+	return out
+}
+
+func newTestSink(t *testing.T, opts OTLPOpts) *OTLPSink {
+	opts.Interval = time.Hour
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = time.Millisecond
+	}
+	s, err := NewOTLPSinkFrom(opts)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestOTLPSink_HTTP(t *testing.T) {
+	for _, protocol := range []Protocol{ProtocolHTTPProtobuf, ProtocolHTTPJSON} {
+		r := &receiver{}
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		conf := metrics.DefaultConfig("web")
+		conf.HostName = "node1"
+		s := newTestSink(t, OTLPOpts{
+			Protocol: protocol,
+			Endpoint: srv.URL + "/v1/metrics",
+			Headers:  map[string]string{"X-Test": "yes"},
+			Resource: ResourceFromConfig(conf),
+			Buckets:  []float64{1, 10},
+		})
+
+		s.IncrCounterWithLabels([]string{"http", "requests"}, 1, []metrics.Label{{Name: "method", Value: "GET"}})
+		s.IncrCounterWithLabels([]string{"http", "requests"}, 2, []metrics.Label{{Name: "method", Value: "GET"}})
+		s.SetGauge([]string{"pool", "size"}, 5)
+		s.SetPrecisionGauge([]string{"pool", "load"}, 0.125)
+		s.AddSample([]string{"http", "latency"}, 0.5)
+		s.AddSample([]string{"http", "latency"}, 20)
+		s.Flush()
+
+		got := r.metrics()
+		if len(got) != 1 {
+			t.Fatalf("bad requests: %d", len(got))
+		}
+		resource := r.requests[0].ResourceMetrics[0].Resource.Attributes
+		if len(resource) != 2 || resource[0].Key != "host.name" || resource[1].Value.GetStringValue() != "web" {
+			t.Fatalf("bad resource: %v", resource)
+		}
+		if !reflect.DeepEqual(r.headers, []string{"yes"}) {
+			t.Fatalf("bad headers: %v", r.headers)
+		}
+
+		sum := got[0]["http.requests"].GetSum()
+		if !sum.IsMonotonic || sum.AggregationTemporality != metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+			t.Fatalf("bad sum: %v", sum)
+		}
+		point := sum.DataPoints[0]
+		if point.GetAsDouble() != 3 || point.Attributes[0].Key != "method" || point.Attributes[0].Value.GetStringValue() != "GET" {
+			t.Fatalf("bad point: %v", point)
+		}
+		if v := got[0]["pool.size"].GetGauge().DataPoints[0].GetAsDouble(); v != 5 {
+			t.Fatalf("bad gauge: %v", v)
+		}
+		if v := got[0]["pool.load"].GetGauge().DataPoints[0].GetAsDouble(); v != 0.125 {
+			t.Fatalf("bad precision gauge: %v", v)
+		}
+		hist := got[0]["http.latency"].GetHistogram().DataPoints[0]
+		if hist.Count != 2 || hist.GetSum() != 20.5 || hist.GetMin() != 0.5 || hist.GetMax() != 20 {
+			t.Fatalf("bad histogram: %v", hist)
+		}
+		if !reflect.DeepEqual(hist.BucketCounts, []uint64{1, 0, 1}) {
+			t.Fatalf("bad buckets: %v", hist.BucketCounts)
+		}
+	}
+}
+
+func TestOTLPSink_Temporality(t *testing.T) {
+	for _, tc := range []struct {
+		temporality Temporality
+		second      float64
+		requests    int
+	}{
+		{CumulativeTemporality, 3, 3},
+		{DeltaTemporality, 2, 2},
+	} {
+		r := &receiver{}
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+		s := newTestSink(t, OTLPOpts{Endpoint: srv.URL, Temporality: tc.temporality})
+
+		key := []string{"requests"}
+		s.IncrCounter(key, 1)
+		s.SetGauge([]string{"gauge"}, 1)
+		s.Flush()
+		s.IncrCounter(key, 2)
+		s.Flush()
+		// Nothing changed
+		s.Flush()
+
+		got := r.metrics()
+		if len(got) != tc.requests {
+			t.Fatalf("expected %d requests, got %d", tc.requests, len(got))
+		}
+		if _, ok := got[1]["gauge"]; ok {
+			t.Fatalf("gauge was reported again")
+		}
+		first := got[0]["requests"].GetSum().DataPoints[0]
+		second := got[1]["requests"].GetSum().DataPoints[0]
+		if second.GetAsDouble() != tc.second {
+			t.Fatalf("expected %v, got %v", tc.second, second.GetAsDouble())
+		}
+		if tc.temporality == DeltaTemporality && second.StartTimeUnixNano != first.TimeUnixNano {
+			t.Fatalf("delta point doesn't start at the previous export")
+		}
+		if tc.temporality == CumulativeTemporality && second.StartTimeUnixNano != first.StartTimeUnixNano {
+			t.Fatalf("cumulative point doesn't keep its start time")
+		}
+	}
+}
+
+func TestOTLPSink_Monotonic(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	s := newTestSink(t, OTLPOpts{Endpoint: srv.URL})
+
+	s.IncrCounter([]string{"requests"}, 2)
+	s.IncrCounterWithLabels([]string{"queue"}, 2, []metrics.Label{{Name: "a", Value: "1"}})
+	s.IncrCounterWithLabels([]string{"queue"}, -1, []metrics.Label{{Name: "a", Value: "2"}})
+	s.Flush()
+
+	// A counter is only monotonic if none of its series was decremented
+	got := r.metrics()
+	if !got[0]["requests"].GetSum().IsMonotonic || got[0]["queue"].GetSum().IsMonotonic {
+		t.Fatalf("bad sums: %v", got[0])
+	}
+}
+
+func TestOTLPSink_Retries(t *testing.T) {
+	for _, tc := range []struct {
+		failures []int
+		requests int
+	}{
+		{[]int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 1},
+		{[]int{http.StatusBadRequest}, 0},
+		{[]int{503, 503, 503, 503}, 0},
+	} {
+		r := &receiver{failures: tc.failures}
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+		s := newTestSink(t, OTLPOpts{Endpoint: srv.URL, MaxRetries: 3})
+
+		s.IncrCounter([]string{"requests"}, 1)
+		s.Flush()
+		if got := len(r.metrics()); got != tc.requests {
+			t.Fatalf("%v: expected %d requests, got %d", tc.failures, tc.requests, got)
+		}
+	}
+}
+
+func TestOTLPSink_RetryAfter(t *testing.T) {
+	r := &receiver{failures: []int{http.StatusTooManyRequests}, retryAfter: "3600"}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	s := newTestSink(t, OTLPOpts{Endpoint: srv.URL, MaxRetries: 1, MaxRetryBackoff: 10 * time.Millisecond})
+
+	// The wait asked by the server is capped
+	start := time.Now()
+	s.IncrCounter([]string{"requests"}, 1)
+	s.Flush()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("waited %s", d)
+	}
+	if got := len(r.metrics()); got != 1 {
+		t.Fatalf("expected 1 request, got %d", got)
+	}
+}
+
+func TestOTLPSink_ShutdownDeadline(t *testing.T) {
+	r := &receiver{failures: []int{503, 503, 503, 503}}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	s := newTestSink(t, OTLPOpts{
+		Endpoint:        srv.URL,
+		Timeout:         100 * time.Millisecond,
+		MaxRetries:      3,
+		RetryBackoff:    time.Hour,
+		MaxRetryBackoff: time.Hour,
+	})
+	s.IncrCounter([]string{"requests"}, 1)
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		s.Flush()
+	}()
+	for {
+		r.lock.Lock()
+		failures := len(r.failures)
+		r.lock.Unlock()
+		if failures < 4 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The export in progress is interrupted, and the last export is
+	// bounded by the timeout
+	start := time.Now()
+	s.Shutdown()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("shutdown took %s", d)
+	}
+	<-flushed
+}
+
+func TestOTLPSink_FailedExport(t *testing.T) {
+	r := &receiver{failures: []int{503, 503}}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	s := newTestSink(t, OTLPOpts{Endpoint: srv.URL, Temporality: DeltaTemporality, MaxRetries: 1})
+
+	s.IncrCounter([]string{"requests"}, 1)
+	s.SetGauge([]string{"gauge"}, 1)
+	s.AddSample([]string{"latency"}, 4)
+	s.Flush()
+	if got := len(r.metrics()); got != 0 {
+		t.Fatalf("expected no request, got %d", got)
+	}
+
+	// The series that failed to be exported are exported with the next ones
+	s.IncrCounter([]string{"requests"}, 2)
+	s.AddSample([]string{"latency"}, 1)
+	s.Flush()
+	got := r.metrics()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(got))
+	}
+	if v := got[0]["requests"].GetSum().DataPoints[0].GetAsDouble(); v != 3 {
+		t.Fatalf("bad counter: %v", v)
+	}
+	if v := got[0]["gauge"].GetGauge().DataPoints[0].GetAsDouble(); v != 1 {
+		t.Fatalf("bad gauge: %v", v)
+	}
+	hist := got[0]["latency"].GetHistogram().DataPoints[0]
+	if hist.Count != 2 || hist.GetSum() != 5 || hist.GetMin() != 1 || hist.GetMax() != 4 {
+		t.Fatalf("bad histogram: %v", hist)
+	}
+}
+
+func TestOTLPSink_Expiration(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	s := newTestSink(t, OTLPOpts{Endpoint: srv.URL, Expiration: 10 * time.Millisecond})
+
+	s.IncrCounter([]string{"old"}, 1)
+	s.Flush()
+	time.Sleep(20 * time.Millisecond)
+	s.IncrCounter([]string{"new"}, 1)
+	s.Flush()
+
+	got := r.metrics()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(got))
+	}
+	if _, ok := got[1]["old"]; ok {
+		t.Fatalf("expired series was reported")
+	}
+	if _, ok := got[1]["new"]; !ok {
+		t.Fatalf("missing series")
+	}
+}
+
+func TestOTLPSink_SameNameKinds(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	s := newTestSink(t, OTLPOpts{Endpoint: srv.URL})
+
+	s.SetGauge([]string{"requests"}, 1)
+	s.IncrCounter([]string{"requests"}, 2)
+	s.AddSample([]string{"requests"}, 3)
+	s.Flush()
+
+	// Each kind is a separate metric
+	metrics := r.requests[0].ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 3 {
+		t.Fatalf("bad metrics: %v", metrics)
+	}
+	for _, m := range metrics {
+		var points int
+		switch data := m.Data.(type) {
+		case *metricpb.Metric_Gauge:
+			points = len(data.Gauge.DataPoints)
+		case *metricpb.Metric_Sum:
+			points = len(data.Sum.DataPoints)
+		case *metricpb.Metric_Histogram:
+			points = len(data.Histogram.DataPoints)
+		}
+		if points != 1 {
+			t.Fatalf("bad metric: %v", m)
+		}
+	}
+}
+
+func TestOTLPSink_GRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	r := &receiver{failures: []int{0}}
+	srv := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(srv, r)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	s, err := NewOTLPSinkFrom(OTLPOpts{
+		Protocol:     ProtocolGRPC,
+		Endpoint:     l.Addr().String(),
+		Insecure:     true,
+		Headers:      map[string]string{"X-Test": "yes"},
+		Interval:     time.Hour,
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.IncrCounter([]string{"requests"}, 4)
+
+	// Shutdown exports the remaining metrics
+	s.Shutdown()
+
+	got := r.metrics()
+	if len(got) != 1 {
+		t.Fatalf("bad requests: %d", len(got))
+	}
+	if v := got[0]["requests"].GetSum().DataPoints[0].GetAsDouble(); v != 4 {
+		t.Fatalf("bad counter: %v", v)
+	}
+	if !reflect.DeepEqual(r.headers, []string{"yes", "yes"}) {
+		t.Fatalf("bad headers: %v", r.headers)
+	}
+}
+
+func TestNewOTLPSinkFrom_Errors(t *testing.T) {
+	if _, err := NewOTLPSinkFrom(OTLPOpts{Protocol: 42}); err == nil {
+		t.Fatalf("expected error for unknown protocol")
+	}
+	if _, err := NewOTLPSinkFrom(OTLPOpts{Buckets: []float64{10, 1}}); err == nil {
+		t.Fatalf("expected error for unsorted buckets")
+	}
+}
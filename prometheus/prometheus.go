@@ -54,6 +54,10 @@ type PrometheusOpts struct {
 	SummaryDefinitions []SummaryDefinition
 	CounterDefinitions []CounterDefinition
 	Name               string
+
+	// KeyFormatter, if set, names the metrics, including the pre-declared
+	// ones. Characters not allowed by Prometheus are still replaced.
+	KeyFormatter metrics.KeyFormatter
 }
 
 type PrometheusSink struct {
@@ -61,10 +65,12 @@ type PrometheusSink struct {
 	gauges         sync.Map
 	summaries      sync.Map
 	counters       sync.Map
+	sets           sync.Map
 	expiration     time.Duration
 	lastCollection atomic.Int64
 	help           map[string]string
 	name           string
+	formatter      metrics.KeyFormatter
 }
 
 // GaugeDefinition can be provided to PrometheusOpts to declare a constant gauge that is not deleted on expiry.
@@ -107,6 +113,30 @@ type counter struct {
 	canDelete bool
 }
 
+// set is exported as a gauge holding the number of distinct values added
+// since the previous collection.
+type set struct {
+	desc      *prometheus.Desc
+	lock      sync.Mutex
+	values    map[string]struct{}
+	updatedAt time.Time
+}
+
+// constCollector collects a single metric. The registry writes the
+// collected metrics after Collect returns, so the sets are collected as a
+// snapshot taken before they are reset.
+type constCollector struct {
+	prometheus.Metric
+}
+
+func (c constCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.Desc()
+}
+
+func (c constCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- c.Metric
+}
+
 // NewPrometheusSink creates a new PrometheusSink using the default options.
 func NewPrometheusSink() (*PrometheusSink, error) {
 	return NewPrometheusSinkFrom(DefaultPrometheusOpts)
@@ -122,15 +152,17 @@ func NewPrometheusSinkFrom(opts PrometheusOpts) (*PrometheusSink, error) {
 		gauges:         sync.Map{},
 		summaries:      sync.Map{},
 		counters:       sync.Map{},
+		sets:           sync.Map{},
 		expiration:     opts.Expiration,
 		lastCollection: atomic.Int64{},
 		help:           make(map[string]string),
 		name:           name,
+		formatter:      opts.KeyFormatter,
 	}
 
-	initGauges(&sink.gauges, opts.GaugeDefinitions, sink.help)
-	initSummaries(&sink.summaries, opts.SummaryDefinitions, sink.help)
-	initCounters(&sink.counters, opts.CounterDefinitions, sink.help)
+	sink.initGauges(opts.GaugeDefinitions)
+	sink.initSummaries(opts.SummaryDefinitions)
+	sink.initCounters(opts.CounterDefinitions)
 
 	reg := opts.Registerer
 	if reg == nil {
@@ -209,6 +241,23 @@ func (p *PrometheusSink) collectAtTime(fn func(prometheus.Collector), t time.Tim
 		fn(count)
 		return true
 	})
+	p.sets.Range(func(k, v any) bool {
+		if v == nil {
+			return true
+		}
+		s := v.(*set)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if expire && s.updatedAt.Add(p.expiration).Before(t) {
+			p.sets.Delete(k)
+			return true
+		}
+		snapshot := prometheus.MustNewConstMetric(s.desc, prometheus.GaugeValue, float64(len(s.values)))
+		fn(constCollector{snapshot})
+		// Like a statsd set, the next collection only counts new values
+		s.values = make(map[string]struct{})
+		return true
+	})
 }
 
 // RunBackgroundCleanup starts a background goroutine that periodically removes
@@ -238,23 +287,23 @@ func (p *PrometheusSink) RunBackgroundCleanup(ctx context.Context) {
 	}()
 }
 
-func initGauges(m *sync.Map, gauges []GaugeDefinition, help map[string]string) {
+func (p *PrometheusSink) initGauges(gauges []GaugeDefinition) {
 	for _, g := range gauges {
-		key, hash := flattenKey(g.Name, g.ConstLabels)
-		help[fmt.Sprintf("gauge.%s", key)] = g.Help
+		key, hash := p.flattenKey(g.Name, g.ConstLabels)
+		p.help[fmt.Sprintf("gauge.%s", key)] = g.Help
 		pG := prometheus.NewGauge(prometheus.GaugeOpts{
 			Name:        key,
 			Help:        g.Help,
 			ConstLabels: prometheusLabels(g.ConstLabels),
 		})
-		m.Store(hash, &gauge{Gauge: pG})
+		p.gauges.Store(hash, &gauge{Gauge: pG})
 	}
 }
 
-func initSummaries(m *sync.Map, summaries []SummaryDefinition, help map[string]string) {
+func (p *PrometheusSink) initSummaries(summaries []SummaryDefinition) {
 	for _, s := range summaries {
-		key, hash := flattenKey(s.Name, s.ConstLabels)
-		help[fmt.Sprintf("summary.%s", key)] = s.Help
+		key, hash := p.flattenKey(s.Name, s.ConstLabels)
+		p.help[fmt.Sprintf("summary.%s", key)] = s.Help
 		pS := prometheus.NewSummary(prometheus.SummaryOpts{
 			Name:        key,
 			Help:        s.Help,
@@ -262,20 +311,20 @@ func initSummaries(m *sync.Map, summaries []SummaryDefinition, help map[string]s
 			ConstLabels: prometheusLabels(s.ConstLabels),
 			Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
 		})
-		m.Store(hash, &summary{Summary: pS})
+		p.summaries.Store(hash, &summary{Summary: pS})
 	}
 }
 
-func initCounters(m *sync.Map, counters []CounterDefinition, help map[string]string) {
+func (p *PrometheusSink) initCounters(counters []CounterDefinition) {
 	for _, c := range counters {
-		key, hash := flattenKey(c.Name, c.ConstLabels)
-		help[fmt.Sprintf("counter.%s", key)] = c.Help
+		key, hash := p.flattenKey(c.Name, c.ConstLabels)
+		p.help[fmt.Sprintf("counter.%s", key)] = c.Help
 		pC := prometheus.NewCounter(prometheus.CounterOpts{
 			Name:        key,
 			Help:        c.Help,
 			ConstLabels: prometheusLabels(c.ConstLabels),
 		})
-		m.Store(hash, &counter{Counter: pC})
+		p.counters.Store(hash, &counter{Counter: pC})
 	}
 }
 
@@ -294,6 +343,14 @@ func flattenKey(parts []string, labels []metrics.Label) (string, string) {
 	return key, hash.String()
 }
 
+// flattenKey names the metric with the sink's KeyFormatter, if any
+func (p *PrometheusSink) flattenKey(parts []string, labels []metrics.Label) (string, string) {
+	if p.formatter != nil {
+		parts = []string{p.formatter.FormatKey(parts)}
+	}
+	return flattenKey(parts, labels)
+}
+
 func prometheusLabels(labels []metrics.Label) prometheus.Labels {
 	l := make(prometheus.Labels)
 	for _, label := range labels {
@@ -315,7 +372,7 @@ func (p *PrometheusSink) SetPrecisionGauge(parts []string, val float64) {
 }
 
 func (p *PrometheusSink) SetPrecisionGaugeWithLabels(parts []string, val float64, labels []metrics.Label) {
-	key, hash := flattenKey(parts, labels)
+	key, hash := p.flattenKey(parts, labels)
 	pg, ok := p.gauges.Load(hash)
 
 	// The sync.Map underlying gauges stores pointers to our structs. If we need to make updates,
@@ -332,24 +389,74 @@ func (p *PrometheusSink) SetPrecisionGaugeWithLabels(parts []string, val float64
 
 		// The gauge does not exist, create the gauge and allow it to be deleted
 	} else {
-		help := key
-		existingHelp, ok := p.help[fmt.Sprintf("gauge.%s", key)]
-		if ok {
-			help = existingHelp
-		}
-		g := prometheus.NewGauge(prometheus.GaugeOpts{
-			Name:        key,
-			Help:        help,
-			ConstLabels: prometheusLabels(labels),
-		})
+		g := p.newGauge(key, labels)
 		g.Set(val)
-		pg = &gauge{
-			Gauge:     g,
-			updatedAt: time.Now(),
-			canDelete: true,
+		p.gauges.Store(hash, g)
+	}
+}
+
+func (p *PrometheusSink) AddGauge(parts []string, delta float32) {
+	p.AddGaugeWithLabels(parts, delta, nil)
+}
+
+func (p *PrometheusSink) AddGaugeWithLabels(parts []string, delta float32, labels []metrics.Label) {
+	key, hash := p.flattenKey(parts, labels)
+	pg, ok := p.gauges.Load(hash)
+
+	// See SetPrecisionGaugeWithLabels, the stored gauge is copied rather than modified
+	if ok {
+		localGauge := *pg.(*gauge)
+		localGauge.Add(float64(delta))
+		localGauge.updatedAt = time.Now()
+		p.gauges.Store(hash, &localGauge)
+	} else {
+		// Concurrent first deltas must all be added to the same gauge
+		g, _ := p.gauges.LoadOrStore(hash, p.newGauge(key, labels))
+		g.(*gauge).Add(float64(delta))
+	}
+}
+
+// newGauge creates a gauge that can be deleted on expiry
+func (p *PrometheusSink) newGauge(key string, labels []metrics.Label) *gauge {
+	help := key
+	existingHelp, ok := p.help[fmt.Sprintf("gauge.%s", key)]
+	if ok {
+		help = existingHelp
+	}
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        key,
+		Help:        help,
+		ConstLabels: prometheusLabels(labels),
+	})
+	return &gauge{
+		Gauge:     g,
+		updatedAt: time.Now(),
+		canDelete: true,
+	}
+}
+
+func (p *PrometheusSink) AddToSet(parts []string, val string) {
+	p.AddToSetWithLabels(parts, val, nil)
+}
+
+// AddToSetWithLabels exports the number of distinct values added since the
+// previous collection as a gauge.
+func (p *PrometheusSink) AddToSetWithLabels(parts []string, val string, labels []metrics.Label) {
+	key, hash := p.flattenKey(parts, labels)
+	ps, ok := p.sets.Load(hash)
+	if !ok {
+		s := &set{
+			desc:   prometheus.NewDesc(key, key, nil, prometheusLabels(labels)),
+			values: make(map[string]struct{}),
 		}
-		p.gauges.Store(hash, pg)
+		ps, _ = p.sets.LoadOrStore(hash, s)
 	}
+
+	s := ps.(*set)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[val] = struct{}{}
+	s.updatedAt = time.Now()
 }
 
 func (p *PrometheusSink) AddSample(parts []string, val float32) {
@@ -357,7 +464,7 @@ func (p *PrometheusSink) AddSample(parts []string, val float32) {
 }
 
 func (p *PrometheusSink) AddSampleWithLabels(parts []string, val float32, labels []metrics.Label) {
-	key, hash := flattenKey(parts, labels)
+	key, hash := p.flattenKey(parts, labels)
 	ps, ok := p.summaries.Load(hash)
 
 	// Does the summary already exist for this sample type?
@@ -402,7 +509,7 @@ func (p *PrometheusSink) IncrCounter(parts []string, val float32) {
 }
 
 func (p *PrometheusSink) IncrCounterWithLabels(parts []string, val float32, labels []metrics.Label) {
-	key, hash := flattenKey(parts, labels)
+	key, hash := p.flattenKey(parts, labels)
 	pc, ok := p.counters.Load(hash)
 
 	// Prometheus Counter.Add() panics if val < 0. We don't want this to
@@ -457,6 +564,7 @@ func NewPrometheusPushSink(address string, pushInterval time.Duration, name stri
 		gauges:     sync.Map{},
 		summaries:  sync.Map{},
 		counters:   sync.Map{},
+		sets:       sync.Map{},
 		expiration: 60 * time.Second,
 		name:       "default_prometheus_sink",
 	}
@@ -11,7 +11,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -380,6 +382,126 @@ func TestSetPrecisionGauge(t *testing.T) {
 	}
 }
 
+func TestAddGaugeAndSet(t *testing.T) {
+	sink, err := NewPrometheusSinkFrom(PrometheusOpts{Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	sink.SetGauge([]string{"queue", "depth"}, 10)
+	sink.AddGauge([]string{"queue", "depth"}, -3)
+	sink.AddGaugeWithLabels([]string{"queue", "depth"}, 2, []metrics.Label{{Name: "a", Value: "b"}})
+	sink.AddToSet([]string{"users"}, "alice")
+	sink.AddToSet([]string{"users"}, "bob")
+	sink.AddToSet([]string{"users"}, "alice")
+
+	// collect returns the gauge values keyed by name and labels
+	collect := func() map[string]float64 {
+		values := make(map[string]float64)
+		sink.collectAtTime(func(c prometheus.Collector) {
+			ch := make(chan prometheus.Metric, 1)
+			c.Collect(ch)
+			metric := <-ch
+			m := &dto.Metric{}
+			if err := metric.Write(m); err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			desc := metric.Desc().String()
+			name := strings.SplitN(strings.SplitN(desc, `fqName: "`, 2)[1], `"`, 2)[0]
+			for _, l := range m.GetLabel() {
+				name += ";" + l.GetName() + "=" + l.GetValue()
+			}
+			values[name] = m.GetGauge().GetValue()
+		}, time.Now())
+		return values
+	}
+
+	values := collect()
+	expect := map[string]float64{
+		"queue_depth":     7,
+		"queue_depth;a=b": 2,
+		"users":           2,
+	}
+	if !reflect.DeepEqual(values, expect) {
+		t.Fatalf("expected %v, got %v", expect, values)
+	}
+
+	// Sets only count the values added since the previous collection
+	sink.AddToSet([]string{"users"}, "carol")
+	if got := collect()["users"]; got != 1 {
+		t.Fatalf("expected 1 distinct value, got %v", got)
+	}
+}
+
+func TestAddToSet_Gather(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	sink, err := NewPrometheusSinkFrom(PrometheusOpts{Registerer: reg})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	// gather returns the value of the set through the registry, which
+	// writes the metrics after they have been collected
+	gather := func() float64 {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "users" {
+				return mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		t.Fatalf("set not gathered: %v", mfs)
+		return 0
+	}
+
+	sink.AddToSet([]string{"users"}, "alice")
+	sink.AddToSet([]string{"users"}, "bob")
+	sink.AddToSet([]string{"users"}, "alice")
+	if got := gather(); got != 2 {
+		t.Fatalf("expected 2 distinct values, got %v", got)
+	}
+	if got := gather(); got != 0 {
+		t.Fatalf("expected 0 distinct values, got %v", got)
+	}
+	sink.AddToSet([]string{"users"}, "carol")
+	if got := gather(); got != 1 {
+		t.Fatalf("expected 1 distinct value, got %v", got)
+	}
+}
+
+func TestAddGauge_Concurrent(t *testing.T) {
+	sink, err := NewPrometheusSinkFrom(PrometheusOpts{Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	// The first deltas of a series must not be lost
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sink.AddGauge([]string{"queue", "depth"}, 1)
+		}()
+	}
+	wg.Wait()
+
+	_, hash := sink.flattenKey([]string{"queue", "depth"}, nil)
+	g, ok := sink.gauges.Load(hash)
+	if !ok {
+		t.Fatalf("missing gauge")
+	}
+	m := &dto.Metric{}
+	if err := g.(*gauge).Write(m); err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	if got := m.GetGauge().GetValue(); got != 50 {
+		t.Fatalf("expected 50, got %v", got)
+	}
+}
+
 func TestDefinitionsWithLabels(t *testing.T) {
 	gaugeDef := GaugeDefinition{
 		Name: []string{"my", "test", "gauge"},
@@ -452,6 +574,8 @@ func TestDefinitionsWithLabels(t *testing.T) {
 func TestMetricSinkInterface(t *testing.T) {
 	var ps *PrometheusSink
 	_ = metrics.MetricSink(ps)
+	_ = metrics.GaugeDeltaMetricSink(ps)
+	_ = metrics.SetMetricSink(ps)
 	var pps *PrometheusPushSink
 	_ = metrics.MetricSink(pps)
 }
@@ -538,3 +662,35 @@ func Test_flattenKey(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyFormatter(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	sink, err := NewPrometheusSinkFrom(PrometheusOpts{
+		Registerer:   reg,
+		KeyFormatter: metrics.SnakeCaseKeys(metrics.OTelKeyFormatter),
+		CounterDefinitions: []CounterDefinition{
+			{Name: []string{"raft", "commitTime"}, Help: "commit time"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+
+	sink.IncrCounter([]string{"raft", "applyTime"}, 1)
+	sink.IncrCounter([]string{"raft", "commitTime"}, 1)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	var names []string
+	for _, family := range families {
+		names = append(names, family.GetName())
+		if family.GetName() == "raft_commit_time" && family.GetHelp() != "commit time" {
+			t.Fatalf("pre-declared counter lost its help: %q", family.GetHelp())
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"raft_apply_time", "raft_commit_time"}) {
+		t.Fatalf("bad names: %v", names)
+	}
+}
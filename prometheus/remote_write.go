@@ -0,0 +1,470 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+//go:build go1.9
+
+package prometheus
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// shutdownTimeout bounds the last write of the series on Shutdown
+const shutdownTimeout = 5 * time.Second
+
+var (
+	// DefaultPrometheusRemoteWriteOpts is the default set of options used
+	// when creating a PrometheusRemoteWriteSink.
+	DefaultPrometheusRemoteWriteOpts = PrometheusRemoteWriteOpts{
+		PrometheusOpts:    DefaultPrometheusOpts,
+		Interval:          15 * time.Second,
+		Timeout:           30 * time.Second,
+		Shards:            1,
+		MaxSamplesPerSend: 2000,
+		MaxRetries:        5,
+		MinBackoff:        30 * time.Millisecond,
+		MaxBackoff:        5 * time.Second,
+	}
+)
+
+// PrometheusRemoteWriteOpts is used to configure the
+// PrometheusRemoteWriteSink
+type PrometheusRemoteWriteOpts struct {
+	// PrometheusOpts configures the PrometheusSink holding the state of the
+	// series. Its Registerer is ignored, as the series are only gathered
+	// to be written.
+	PrometheusOpts
+
+	// URL is the remote write endpoint, such as
+	// http://mimir:8080/api/v1/push
+	URL string
+
+	// Interval is how often all the series are written
+	Interval time.Duration
+
+	// Timeout bounds every write request
+	Timeout time.Duration
+
+	// Shards is the number of concurrent writers. Each series always goes
+	// to the same shard, so that its samples are written in order.
+	Shards int
+
+	// MaxSamplesPerSend is the maximum number of samples in a write request
+	MaxSamplesPerSend int
+
+	// MaxRetries is the number of times a failed write request is retried,
+	// if the error is recoverable: a network error, a 5xx or a 429 status.
+	// Retries wait for MinBackoff, doubled after each attempt up to
+	// MaxBackoff, or as long as the server asks to, up to MaxBackoff.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// BasicAuthUsername and BasicAuthPassword set basic authentication, and
+	// BearerToken sets bearer token authentication. They are exclusive.
+	BasicAuthUsername string
+	BasicAuthPassword string
+	BearerToken       string
+
+	// Headers are added to every write request, such as X-Scope-OrgID for
+	// the tenant of Mimir or Cortex
+	Headers map[string]string
+
+	// TLSConfig is used to connect to HTTPS endpoints
+	TLSConfig *tls.Config
+
+	// ExternalLabels are added to every series that doesn't have a label
+	// with the same name, such as the job and instance
+	ExternalLabels []metrics.Label
+}
+
+// PrometheusRemoteWriteSink wraps a PrometheusSink, and writes all its
+// series to a Prometheus remote write endpoint on an interval, such as the
+// one of Prometheus, Mimir, Cortex, Thanos or VictoriaMetrics. It suits
+// processes that can't be scraped, being short-lived or firewalled.
+//
+// The series are written with the version 1 of the protocol, as a
+// snappy compressed prompb.WriteRequest. Samples are written as summaries,
+// the quantiles, sum and count being separate series.
+type PrometheusRemoteWriteSink struct {
+	*PrometheusSink
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	opts     PrometheusRemoteWriteOpts
+
+	// flushLock serializes the flushes
+	flushLock sync.Mutex
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// remoteSeries is a series and its value, to be written. The labels are
+// sorted by name and include __name__.
+type remoteSeries struct {
+	labels []metrics.Label
+	value  float64
+}
+
+// recoverableError is a write error worth retrying
+type recoverableError struct {
+	err error
+
+	// after is how long the server asked to wait before retrying, if set
+	after time.Duration
+}
+
+func (e *recoverableError) Error() string {
+	return e.err.Error()
+}
+
+// NewPrometheusRemoteWriteSink creates a new PrometheusRemoteWriteSink
+// writing to url, using the default options.
+func NewPrometheusRemoteWriteSink(url string) (*PrometheusRemoteWriteSink, error) {
+	opts := DefaultPrometheusRemoteWriteOpts
+	opts.URL = url
+	return NewPrometheusRemoteWriteSinkFrom(opts)
+}
+
+// NewPrometheusRemoteWriteSinkFrom creates a new PrometheusRemoteWriteSink
+// using the passed options.
+func NewPrometheusRemoteWriteSinkFrom(opts PrometheusRemoteWriteOpts) (*PrometheusRemoteWriteSink, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("bad remote write URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("bad remote write URL: unsupported scheme: %q", u.Scheme)
+	}
+	if opts.BearerToken != "" && opts.BasicAuthUsername != "" {
+		return nil, fmt.Errorf("basic auth and bearer token are exclusive")
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultPrometheusRemoteWriteOpts.Interval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultPrometheusRemoteWriteOpts.Timeout
+	}
+	if opts.Shards <= 0 {
+		opts.Shards = DefaultPrometheusRemoteWriteOpts.Shards
+	}
+	if opts.MaxSamplesPerSend <= 0 {
+		opts.MaxSamplesPerSend = DefaultPrometheusRemoteWriteOpts.MaxSamplesPerSend
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultPrometheusRemoteWriteOpts.MinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultPrometheusRemoteWriteOpts.MaxBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = opts.MinBackoff
+	}
+
+	registry := prometheus.NewRegistry()
+	opts.Registerer = registry
+	promSink, err := NewPrometheusSinkFrom(opts.PrometheusOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = opts.TLSConfig
+	s := &PrometheusRemoteWriteSink{
+		PrometheusSink: promSink,
+		gatherer:       registry,
+		client:         &http.Client{Transport: transport, Timeout: opts.Timeout},
+		opts:           opts,
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Flush writes all the series now
+func (s *PrometheusRemoteWriteSink) Flush() {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+
+	now := time.Now()
+	families, err := s.gatherer.Gather()
+	if err != nil {
+		// The metrics gathered despite the error are still written
+		log.Printf("[WARN] Error gathering metrics for Prometheus remote write! Err: %s", err)
+	}
+
+	shards := make([][]remoteSeries, s.opts.Shards)
+	for _, ser := range s.remoteSeries(families) {
+		shard := shardOf(ser.labels, len(shards))
+		shards[shard] = append(shards[shard], ser)
+	}
+
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(shard []remoteSeries) {
+			defer wg.Done()
+			for start := 0; start < len(shard); start += s.opts.MaxSamplesPerSend {
+				end := start + s.opts.MaxSamplesPerSend
+				if end > len(shard) {
+					end = len(shard)
+				}
+				if err := s.send(encodeWriteRequest(shard[start:end], now.UnixMilli())); err != nil {
+					log.Printf("[ERR] Error writing to Prometheus remote write! Err: %s", err)
+				}
+			}
+		}(shard)
+	}
+	wg.Wait()
+}
+
+// Shutdown stops the sink, and blocks while writing the series one last
+// time, or until shutdownTimeout has elapsed. Failed writes are no longer
+// retried once the sink is stopped.
+func (s *PrometheusRemoteWriteSink) Shutdown() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		<-s.doneCh
+
+		flushed := make(chan struct{})
+		go func() {
+			defer close(flushed)
+			s.Flush()
+		}()
+		timer := time.NewTimer(shutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-flushed:
+		case <-timer.C:
+			log.Printf("[WARN] Timed out writing metrics to Prometheus remote write during shutdown")
+		}
+		s.client.CloseIdleConnections()
+	})
+}
+
+func (s *PrometheusRemoteWriteSink) run() {
+	defer close(s.doneCh)
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// remoteSeries flattens the gathered metric families into series, the way
+// they would be scraped
+func (s *PrometheusRemoteWriteSink) remoteSeries(families []*dto.MetricFamily) []remoteSeries {
+	var out []remoteSeries
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			labels := make([]metrics.Label, 0, len(m.GetLabel())+len(s.opts.ExternalLabels)+1)
+			for _, pair := range m.GetLabel() {
+				labels = append(labels, metrics.Label{Name: pair.GetName(), Value: pair.GetValue()})
+			}
+			for _, label := range s.opts.ExternalLabels {
+				if !slices.ContainsFunc(labels, func(l metrics.Label) bool { return l.Name == label.Name }) {
+					labels = append(labels, label)
+				}
+			}
+			add := func(name string, value float64, extra ...metrics.Label) {
+				ser := remoteSeries{
+					labels: append([]metrics.Label{{Name: "__name__", Value: name}}, labels...),
+					value:  value,
+				}
+				ser.labels = append(ser.labels, extra...)
+				sort.Slice(ser.labels, func(i, j int) bool {
+					return ser.labels[i].Name < ser.labels[j].Name
+				})
+				out = append(out, ser)
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, q := range summary.GetQuantile() {
+					add(name, q.GetValue(), metrics.Label{Name: "quantile", Value: formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", summary.GetSampleSum())
+				add(name+"_count", float64(summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				histogram := m.GetHistogram()
+				for _, b := range histogram.GetBucket() {
+					add(name+"_bucket", float64(b.GetCumulativeCount()), metrics.Label{Name: "le", Value: formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(histogram.GetSampleCount()), metrics.Label{Name: "le", Value: "+Inf"})
+				add(name+"_sum", histogram.GetSampleSum())
+				add(name+"_count", float64(histogram.GetSampleCount()))
+			}
+		}
+	}
+	return out
+}
+
+// send posts a write request, retrying on recoverable errors until the sink
+// is stopped
+func (s *PrometheusRemoteWriteSink) send(req []byte) error {
+	body := snappy.Encode(nil, req)
+	backoff := s.opts.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.post(body)
+		retry, ok := err.(*recoverableError)
+		if !ok || attempt >= s.opts.MaxRetries {
+			return err
+		}
+		wait := backoff
+		if retry.after > 0 {
+			wait = retry.after
+		}
+		if wait > s.opts.MaxBackoff {
+			wait = s.opts.MaxBackoff
+		}
+		log.Printf("[WARN] Error writing to Prometheus remote write, retrying in %s! Err: %s", wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.stopCh:
+			timer.Stop()
+			return err
+		}
+		if backoff *= 2; backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+	}
+}
+
+// post posts a snappy compressed write request
+func (s *PrometheusRemoteWriteSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range s.opts.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.opts.BasicAuthUsername != "" {
+		req.SetBasicAuth(s.opts.BasicAuthUsername, s.opts.BasicAuthPassword)
+	}
+	if s.opts.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.opts.BearerToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &recoverableError{err: err}
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode/100 == 5, resp.StatusCode == http.StatusTooManyRequests:
+		retry := &recoverableError{err: fmt.Errorf("remote write endpoint returned %s: %s", resp.Status, bytes.TrimSpace(respBody))}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retry.after = time.Duration(seconds) * time.Second
+		}
+		return retry
+	default:
+		return fmt.Errorf("remote write endpoint returned %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+}
+
+// shardOf returns the shard a series is written by
+func shardOf(labels []metrics.Label, shards int) int {
+	h := fnv.New64a()
+	for _, label := range labels {
+		_, _ = io.WriteString(h, label.Name)
+		_, _ = h.Write([]byte{0})
+		_, _ = io.WriteString(h, label.Value)
+		_, _ = h.Write([]byte{0})
+	}
+	return int(h.Sum64() % uint64(shards))
+}
+
+// formatFloat formats the quantiles and bucket bounds like the exposition
+// format does
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// encodeWriteRequest encodes the series as a prompb.WriteRequest, each
+// series having a single sample:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteSeries, timestamp int64) []byte {
+	var buf, ts, field []byte
+	for _, ser := range series {
+		ts = ts[:0]
+		for _, label := range ser.labels {
+			field = field[:0]
+			field = protowire.AppendTag(field, 1, protowire.BytesType)
+			field = protowire.AppendString(field, label.Name)
+			field = protowire.AppendTag(field, 2, protowire.BytesType)
+			field = protowire.AppendString(field, label.Value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, field)
+		}
+		field = field[:0]
+		field = protowire.AppendTag(field, 1, protowire.Fixed64Type)
+		field = protowire.AppendFixed64(field, math.Float64bits(ser.value))
+		field = protowire.AppendTag(field, 2, protowire.VarintType)
+		field = protowire.AppendVarint(field, uint64(timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, field)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+	return buf
+}
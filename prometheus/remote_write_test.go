@@ -0,0 +1,363 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package prometheus
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-metrics"
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// writeReceiver is an in-process remote write endpoint
+type writeReceiver struct {
+	t *testing.T
+
+	lock     sync.Mutex
+	requests []map[string]float64
+	headers  []http.Header
+
+	// failures are the status codes returned before succeeding
+	failures []int
+
+	// retryAfter is the Retry-After header of the failures
+	retryAfter string
+}
+
+func (r *writeReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.headers = append(r.headers, req.Header)
+	if len(r.failures) > 0 {
+		code := r.failures[0]
+		r.failures = r.failures[1:]
+		if r.retryAfter != "" {
+			w.Header().Set("Retry-After", r.retryAfter)
+		}
+		w.WriteHeader(code)
+		return
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		r.t.Errorf("err: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.requests = append(r.requests, decodeWriteRequest(r.t, data))
+}
+
+// writeSample and writeSeries mirror the prompb Sample and TimeSeries
+// messages
+type writeSample struct {
+	value     float64
+	timestamp int64
+}
+
+type writeSeries struct {
+	labels  []metrics.Label
+	samples []writeSample
+}
+
+// consumeMessage calls f with every field of a protobuf message, and fails
+// the test if the message is malformed. f returns the length of the field
+// value, or -1 if the field has an unexpected type.
+func consumeMessage(t *testing.T, b []byte, f func(num protowire.Number, typ protowire.Type, b []byte) int) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		n = f(num, typ, b)
+		if n < 0 {
+			t.Fatalf("bad field %d of type %d", num, typ)
+		}
+		b = b[n:]
+	}
+}
+
+// decodeWriteRequest decodes a prompb.WriteRequest as the values of the
+// series, by their labels formatted as name{label="value",...}
+func decodeWriteRequest(t *testing.T, data []byte) map[string]float64 {
+	t.Helper()
+	var req []writeSeries
+	consumeMessage(t, data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num != 1 || typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b)
+		}
+		msg, n := protowire.ConsumeBytes(b)
+		var ts writeSeries
+		consumeMessage(t, msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+			if typ != protowire.BytesType {
+				return -1
+			}
+			msg, n := protowire.ConsumeBytes(b)
+			switch num {
+			case 1:
+				var label metrics.Label
+				consumeMessage(t, msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					s, n := protowire.ConsumeString(b)
+					switch {
+					case typ != protowire.BytesType:
+						return -1
+					case num == 1:
+						label.Name = s
+					case num == 2:
+						label.Value = s
+					}
+					return n
+				})
+				ts.labels = append(ts.labels, label)
+			case 2:
+				var sample writeSample
+				consumeMessage(t, msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					switch {
+					case num == 1 && typ == protowire.Fixed64Type:
+						v, n := protowire.ConsumeFixed64(b)
+						sample.value = math.Float64frombits(v)
+						return n
+					case num == 2 && typ == protowire.VarintType:
+						v, n := protowire.ConsumeVarint(b)
+						sample.timestamp = int64(v)
+						return n
+					}
+					return -1
+				})
+				ts.samples = append(ts.samples, sample)
+			}
+			return n
+		})
+		req = append(req, ts)
+		return n
+	})
+
+	out := make(map[string]float64)
+	for _, ts := range req {
+		if len(ts.samples) != 1 {
+			t.Errorf("expected 1 sample, got %d", len(ts.samples))
+			continue
+		}
+		sample := ts.samples[0]
+		if d := time.Since(time.UnixMilli(sample.timestamp)); d < 0 || d > time.Minute {
+			t.Errorf("bad timestamp: %d", sample.timestamp)
+		}
+
+		var name string
+		var labels []string
+		for _, label := range ts.labels {
+			if label.Name == "__name__" {
+				name = label.Value
+			} else {
+				labels = append(labels, label.Name+"=\""+label.Value+"\"")
+			}
+		}
+		if !sort.StringsAreSorted(labels) {
+			t.Errorf("labels are not sorted: %v", labels)
+		}
+		if len(labels) > 0 {
+			name += "{" + strings.Join(labels, ",") + "}"
+		}
+		out[name] = sample.value
+	}
+	return out
+}
+
+func newTestRemoteWriteSink(t *testing.T, r *writeReceiver, opts PrometheusRemoteWriteOpts) *PrometheusRemoteWriteSink {
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	opts.URL = srv.URL + "/api/v1/push"
+	opts.Interval = time.Hour
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = time.Millisecond
+	}
+	s, err := NewPrometheusRemoteWriteSinkFrom(opts)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestPrometheusRemoteWriteSink(t *testing.T) {
+	r := &writeReceiver{t: t}
+	s := newTestRemoteWriteSink(t, r, PrometheusRemoteWriteOpts{
+		BearerToken:    "secret",
+		Headers:        map[string]string{"X-Scope-OrgID": "tenant"},
+		ExternalLabels: []metrics.Label{{Name: "job", Value: "worker"}, {Name: "method", Value: "none"}},
+	})
+
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1, []metrics.Label{{Name: "method", Value: "GET"}})
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 2, []metrics.Label{{Name: "method", Value: "GET"}})
+	s.SetGauge([]string{"pool", "size"}, 5)
+	s.AddSample([]string{"http", "latency"}, 2)
+	s.Flush()
+	// Series are cumulative
+	s.IncrCounterWithLabels([]string{"http", "requests"}, 1, []metrics.Label{{Name: "method", Value: "GET"}})
+	s.Flush()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.requests) != 2 {
+		t.Fatalf("bad requests: %d", len(r.requests))
+	}
+	// The labels of the series take precedence over the external labels
+	expect := map[string]float64{
+		`http_requests{job="worker",method="GET"}`:                 3,
+		`pool_size{job="worker",method="none"}`:                    5,
+		`http_latency{job="worker",method="none",quantile="0.5"}`:  2,
+		`http_latency{job="worker",method="none",quantile="0.9"}`:  2,
+		`http_latency{job="worker",method="none",quantile="0.99"}`: 2,
+		`http_latency_sum{job="worker",method="none"}`:             2,
+		`http_latency_count{job="worker",method="none"}`:           1,
+	}
+	if !reflect.DeepEqual(r.requests[0], expect) {
+		t.Fatalf("bad series: %v", r.requests[0])
+	}
+	if got := r.requests[1][`http_requests{job="worker",method="GET"}`]; got != 4 {
+		t.Fatalf("bad cumulative counter: %v", got)
+	}
+
+	h := r.headers[0]
+	for name, value := range map[string]string{
+		"Authorization":                     "Bearer secret",
+		"X-Scope-Orgid":                     "tenant",
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if got := h.Get(name); got != value {
+			t.Fatalf("bad %s header: %q", name, got)
+		}
+	}
+}
+
+func TestPrometheusRemoteWriteSink_Batches(t *testing.T) {
+	r := &writeReceiver{t: t}
+	s := newTestRemoteWriteSink(t, r, PrometheusRemoteWriteOpts{
+		Shards:            3,
+		MaxSamplesPerSend: 2,
+		BasicAuthUsername: "user",
+		BasicAuthPassword: "pass",
+	})
+	for i := 0; i < 20; i++ {
+		s.SetGauge([]string{"gauge", string(rune('a' + i))}, float32(i))
+	}
+	s.Flush()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	total := 0
+	for _, req := range r.requests {
+		if len(req) > 2 {
+			t.Fatalf("too many samples: %d", len(req))
+		}
+		total += len(req)
+	}
+	if total != 20 || len(r.requests) < 10 {
+		t.Fatalf("bad batches: %d samples in %d requests", total, len(r.requests))
+	}
+	if user, pass, ok := (&http.Request{Header: r.headers[0]}).BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Fatalf("bad basic auth: %v %q %q", ok, user, pass)
+	}
+}
+
+func TestPrometheusRemoteWriteSink_Retries(t *testing.T) {
+	for _, tc := range []struct {
+		failures []int
+		requests int
+	}{
+		{[]int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 1},
+		{[]int{http.StatusBadRequest}, 0},
+		{[]int{500, 500, 500}, 0},
+	} {
+		r := &writeReceiver{t: t, failures: tc.failures}
+		s := newTestRemoteWriteSink(t, r, PrometheusRemoteWriteOpts{MaxRetries: 2})
+		s.IncrCounter([]string{"requests"}, 1)
+		s.Flush()
+
+		r.lock.Lock()
+		if len(r.requests) != tc.requests {
+			t.Fatalf("%v: expected %d requests, got %d", tc.failures, tc.requests, len(r.requests))
+		}
+		r.lock.Unlock()
+	}
+}
+
+func TestPrometheusRemoteWriteSink_RetryAfter(t *testing.T) {
+	r := &writeReceiver{t: t, failures: []int{http.StatusTooManyRequests}, retryAfter: "3600"}
+	s := newTestRemoteWriteSink(t, r, PrometheusRemoteWriteOpts{MaxRetries: 1, MaxBackoff: 10 * time.Millisecond})
+	s.IncrCounter([]string{"requests"}, 1)
+
+	// The wait the server asks for is capped at MaxBackoff
+	start := time.Now()
+	s.Flush()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("bad retry wait: %s", elapsed)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(r.requests))
+	}
+}
+
+func TestPrometheusRemoteWriteSink_ShutdownDuringBackoff(t *testing.T) {
+	r := &writeReceiver{t: t, failures: []int{500, 500, 500}}
+	s := newTestRemoteWriteSink(t, r, PrometheusRemoteWriteOpts{
+		MaxRetries: 2,
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+	})
+	s.IncrCounter([]string{"requests"}, 1)
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		s.Flush()
+	}()
+	for {
+		r.lock.Lock()
+		failures := len(r.failures)
+		r.lock.Unlock()
+		if failures < 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The backoff is interrupted, and the last write isn't retried
+	start := time.Now()
+	s.Shutdown()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("shutdown was not interrupted: %s", elapsed)
+	}
+	<-flushed
+}
+
+func TestNewPrometheusRemoteWriteSinkFrom_Errors(t *testing.T) {
+	for _, opts := range []PrometheusRemoteWriteOpts{
+		{URL: "localhost:9090/api/v1/write"},
+		{URL: "http://localhost:9090/api/v1/write", BasicAuthUsername: "u", BearerToken: "t"},
+	} {
+		if _, err := NewPrometheusRemoteWriteSinkFrom(opts); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// RelabelNameLabel is the label name relabel rules use to read and write
+// the metric key. The key is joined with '.', and split on '.' when written.
+const RelabelNameLabel = "__name__"
+
+// RelabelAction is the action a RelabelRule performs
+type RelabelAction string
+
+const (
+	// RelabelReplace sets TargetLabel to Replacement if Regex matches the
+	// source value. Capture groups can be used in both.
+	RelabelReplace RelabelAction = "replace"
+
+	// RelabelKeep drops metrics whose source value does not match Regex.
+	RelabelKeep RelabelAction = "keep"
+
+	// RelabelDrop drops metrics whose source value matches Regex.
+	RelabelDrop RelabelAction = "drop"
+
+	// RelabelLabelDrop removes the labels whose name matches Regex.
+	RelabelLabelDrop RelabelAction = "labeldrop"
+
+	// RelabelLabelKeep removes the labels whose name does not match Regex.
+	RelabelLabelKeep RelabelAction = "labelkeep"
+
+	// RelabelLabelMap copies the labels whose name matches Regex to the
+	// label named by Replacement.
+	RelabelLabelMap RelabelAction = "labelmap"
+
+	// RelabelHashMod sets TargetLabel to the hash of the source value
+	// modulo Modulus.
+	RelabelHashMod RelabelAction = "hashmod"
+)
+
+// RelabelRule is a Prometheus style relabeling rule. The source value is the
+// value of SourceLabels joined by Separator, RelabelNameLabel refers to the
+// metric key. Regex is anchored at both ends.
+type RelabelRule struct {
+	SourceLabels []string      `json:"source_labels,omitempty" yaml:"source_labels,omitempty"`
+	Separator    string        `json:"separator,omitempty" yaml:"separator,omitempty"`       // Defaults to ";"
+	Regex        string        `json:"regex,omitempty" yaml:"regex,omitempty"`               // Defaults to "(.*)"
+	Modulus      uint64        `json:"modulus,omitempty" yaml:"modulus,omitempty"`           // Required by hashmod
+	TargetLabel  string        `json:"target_label,omitempty" yaml:"target_label,omitempty"` // Required by replace and hashmod
+	Replacement  *string       `json:"replacement,omitempty" yaml:"replacement,omitempty"`   // Defaults to "$1", "" removes TargetLabel
+	Action       RelabelAction `json:"action,omitempty" yaml:"action,omitempty"`             // Defaults to replace
+}
+
+// LoadRelabelRules parses a YAML or JSON list of relabel rules
+func LoadRelabelRules(data []byte) ([]RelabelRule, error) {
+	var rules []RelabelRule
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse relabel rules: %w", err)
+	}
+	return rules, nil
+}
+
+// RelabelSink wraps a MetricSink and rewrites the key and labels of every
+// metric with a list of relabel rules before forwarding it.
+type RelabelSink struct {
+	sink  MetricSink
+	rules []relabelRule
+}
+
+// relabelRule is a RelabelRule with defaults applied and regex compiled
+type relabelRule struct {
+	RelabelRule
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// NewRelabelSink creates a RelabelSink forwarding to sink. It returns an
+// error if a rule is invalid.
+func NewRelabelSink(sink MetricSink, rules []RelabelRule) (*RelabelSink, error) {
+	r := &RelabelSink{sink: sink}
+	for i, rule := range rules {
+		compiled, err := compileRelabelRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: %w", i, err)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func compileRelabelRule(rule RelabelRule) (relabelRule, error) {
+	if rule.Separator == "" {
+		rule.Separator = ";"
+	}
+	if rule.Regex == "" {
+		rule.Regex = "(.*)"
+	}
+	replacement := "$1"
+	if rule.Replacement != nil {
+		replacement = *rule.Replacement
+	}
+	if rule.Action == "" {
+		rule.Action = RelabelReplace
+	}
+
+	regex, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+	if err != nil {
+		return relabelRule{}, fmt.Errorf("bad regex %q: %w", rule.Regex, err)
+	}
+
+	switch rule.Action {
+	case RelabelReplace:
+		if rule.TargetLabel == "" {
+			return relabelRule{}, fmt.Errorf("%s requires a target_label", rule.Action)
+		}
+	case RelabelHashMod:
+		if rule.TargetLabel == "" || rule.Modulus == 0 {
+			return relabelRule{}, fmt.Errorf("%s requires a target_label and a modulus", rule.Action)
+		}
+	case RelabelKeep, RelabelDrop, RelabelLabelDrop, RelabelLabelKeep, RelabelLabelMap:
+	default:
+		return relabelRule{}, fmt.Errorf("unknown action %q", rule.Action)
+	}
+	return relabelRule{RelabelRule: rule, regex: regex, replacement: replacement}, nil
+}
+
+func (r *RelabelSink) SetGauge(key []string, val float32) {
+	r.SetGaugeWithLabels(key, val, nil)
+}
+
+func (r *RelabelSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	if key, labels, ok := r.relabel(key, labels); ok {
+		r.sink.SetGaugeWithLabels(key, val, labels)
+	}
+}
+
+func (r *RelabelSink) SetPrecisionGauge(key []string, val float64) {
+	r.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+func (r *RelabelSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	if s, ok := r.sink.(PrecisionGaugeMetricSink); ok {
+		if key, labels, ok := r.relabel(key, labels); ok {
+			s.SetPrecisionGaugeWithLabels(key, val, labels)
+		}
+	}
+}
+
+func (r *RelabelSink) AddGauge(key []string, delta float32) {
+	r.AddGaugeWithLabels(key, delta, nil)
+}
+
+func (r *RelabelSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	if s, ok := r.sink.(GaugeDeltaMetricSink); ok {
+		if key, labels, ok := r.relabel(key, labels); ok {
+			s.AddGaugeWithLabels(key, delta, labels)
+		}
+	}
+}
+
+// EmitKey has no labels, any label set by the rules is discarded.
+func (r *RelabelSink) EmitKey(key []string, val float32) {
+	if key, _, ok := r.relabel(key, nil); ok {
+		r.sink.EmitKey(key, val)
+	}
+}
+
+func (r *RelabelSink) IncrCounter(key []string, val float32) {
+	r.IncrCounterWithLabels(key, val, nil)
+}
+
+func (r *RelabelSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	if key, labels, ok := r.relabel(key, labels); ok {
+		r.sink.IncrCounterWithLabels(key, val, labels)
+	}
+}
+
+func (r *RelabelSink) AddSample(key []string, val float32) {
+	r.AddSampleWithLabels(key, val, nil)
+}
+
+func (r *RelabelSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	if key, labels, ok := r.relabel(key, labels); ok {
+		r.sink.AddSampleWithLabels(key, val, labels)
+	}
+}
+
+func (r *RelabelSink) AddToSet(key []string, val string) {
+	r.AddToSetWithLabels(key, val, nil)
+}
+
+func (r *RelabelSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	if s, ok := r.sink.(SetMetricSink); ok {
+		if key, labels, ok := r.relabel(key, labels); ok {
+			s.AddToSetWithLabels(key, val, labels)
+		}
+	}
+}
+
+// Shutdown shuts down the wrapped sink
+func (r *RelabelSink) Shutdown() {
+	if ss, ok := r.sink.(ShutdownSink); ok {
+		ss.Shutdown()
+	}
+}
+
+// relabel applies the rules in order. It returns false if the metric was
+// dropped. The given key and labels are never modified.
+func (r *RelabelSink) relabel(key []string, labels []Label) ([]string, []Label, bool) {
+	if len(r.rules) == 0 {
+		return key, labels, true
+	}
+
+	t := relabelTarget{
+		name:   strings.Join(key, "."),
+		labels: slices.Clone(labels),
+	}
+	for _, rule := range r.rules {
+		if !rule.apply(&t) {
+			return nil, nil, false
+		}
+	}
+
+	if t.nameChanged {
+		if t.name == "" {
+			return nil, nil, false
+		}
+		key = strings.Split(t.name, ".")
+	}
+	return key, t.labels, true
+}
+
+// relabelTarget is the key and labels of a metric being relabeled
+type relabelTarget struct {
+	name        string
+	nameChanged bool
+	labels      []Label
+}
+
+func (t *relabelTarget) get(name string) string {
+	if name == RelabelNameLabel {
+		return t.name
+	}
+	for _, label := range t.labels {
+		if label.Name == name {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+// set updates or adds a label, an empty value removes it
+func (t *relabelTarget) set(name, value string) {
+	if name == RelabelNameLabel {
+		t.name = value
+		t.nameChanged = true
+		return
+	}
+	for i, label := range t.labels {
+		if label.Name == name {
+			if value == "" {
+				t.labels = slices.Delete(t.labels, i, i+1)
+			} else {
+				t.labels[i].Value = value
+			}
+			return
+		}
+	}
+	if value != "" {
+		t.labels = append(t.labels, Label{Name: name, Value: value})
+	}
+}
+
+// apply runs the rule on t, it returns false if the metric must be dropped
+func (rule *relabelRule) apply(t *relabelTarget) bool {
+	values := make([]string, len(rule.SourceLabels))
+	for i, name := range rule.SourceLabels {
+		values[i] = t.get(name)
+	}
+	val := strings.Join(values, rule.Separator)
+
+	switch rule.Action {
+	case RelabelKeep:
+		return rule.regex.MatchString(val)
+	case RelabelDrop:
+		return !rule.regex.MatchString(val)
+	case RelabelReplace:
+		match := rule.regex.FindStringSubmatchIndex(val)
+		if match == nil {
+			return true
+		}
+		target := string(rule.regex.ExpandString(nil, rule.TargetLabel, val, match))
+		res := string(rule.regex.ExpandString(nil, rule.replacement, val, match))
+		t.set(target, res)
+	case RelabelHashMod:
+		sum := md5.Sum([]byte(val))
+		mod := binary.BigEndian.Uint64(sum[8:]) % rule.Modulus
+		t.set(rule.TargetLabel, strconv.FormatUint(mod, 10))
+	case RelabelLabelMap:
+		for _, label := range slices.Clone(t.labels) {
+			if match := rule.regex.FindStringSubmatchIndex(label.Name); match != nil {
+				name := string(rule.regex.ExpandString(nil, rule.replacement, label.Name, match))
+				t.set(name, label.Value)
+			}
+		}
+	case RelabelLabelDrop:
+		t.labels = slices.DeleteFunc(t.labels, func(label Label) bool {
+			return rule.regex.MatchString(label.Name)
+		})
+	case RelabelLabelKeep:
+		t.labels = slices.DeleteFunc(t.labels, func(label Label) bool {
+			return !rule.regex.MatchString(label.Name)
+		})
+	}
+	return true
+}
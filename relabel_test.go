@@ -0,0 +1,188 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func relabelReplacement(s string) *string {
+	return &s
+}
+
+func TestRelabelSink(t *testing.T) {
+	type metric struct {
+		key    []string
+		labels []Label
+	}
+	tests := []struct {
+		name   string
+		rules  []RelabelRule
+		in     metric
+		expect *metric
+	}{
+		{
+			name: "key segment to label",
+			rules: []RelabelRule{
+				{SourceLabels: []string{"__name__"}, Regex: `consul\.raft\.(\w+)\.(.*)`, TargetLabel: "op"},
+				{SourceLabels: []string{"__name__"}, Regex: `consul\.raft\.(\w+)\.(.*)`, TargetLabel: "__name__", Replacement: relabelReplacement("consul.raft.$2")},
+			},
+			in:     metric{[]string{"consul", "raft", "apply", "time"}, nil},
+			expect: &metric{[]string{"consul", "raft", "time"}, []Label{{"op", "apply"}}},
+		},
+		{
+			name: "replace with several sources",
+			rules: []RelabelRule{
+				{SourceLabels: []string{"dc", "node"}, Separator: "/", Regex: "(.+)/(.+)", TargetLabel: "instance", Replacement: relabelReplacement("$2.$1")},
+			},
+			in:     metric{[]string{"a"}, []Label{{"dc", "us"}, {"node", "n1"}}},
+			expect: &metric{[]string{"a"}, []Label{{"dc", "us"}, {"node", "n1"}, {"instance", "n1.us"}}},
+		},
+		{
+			name: "replace without match",
+			rules: []RelabelRule{
+				{SourceLabels: []string{"dc"}, Regex: "eu", TargetLabel: "region", Replacement: relabelReplacement("europe")},
+			},
+			in:     metric{[]string{"a"}, []Label{{"dc", "us"}}},
+			expect: &metric{[]string{"a"}, []Label{{"dc", "us"}}},
+		},
+		{
+			name: "replace with empty value removes",
+			rules: []RelabelRule{
+				{SourceLabels: []string{"missing"}, TargetLabel: "dc"},
+			},
+			in:     metric{[]string{"a"}, []Label{{"dc", "us"}}},
+			expect: &metric{[]string{"a"}, []Label{}},
+		},
+		{
+			name: "replace with empty replacement removes",
+			rules: []RelabelRule{
+				{SourceLabels: []string{"env"}, Regex: "test", TargetLabel: "env", Replacement: relabelReplacement("")},
+			},
+			in:     metric{[]string{"a"}, []Label{{"env", "test"}, {"dc", "us"}}},
+			expect: &metric{[]string{"a"}, []Label{{"dc", "us"}}},
+		},
+		{
+			name:   "keep",
+			rules:  []RelabelRule{{SourceLabels: []string{"__name__"}, Regex: `raft\..*`, Action: RelabelKeep}},
+			in:     metric{[]string{"serf", "x"}, nil},
+			expect: nil,
+		},
+		{
+			name:   "drop",
+			rules:  []RelabelRule{{SourceLabels: []string{"env"}, Regex: "test", Action: RelabelDrop}},
+			in:     metric{[]string{"a"}, []Label{{"env", "test"}}},
+			expect: nil,
+		},
+		{
+			name:   "labeldrop",
+			rules:  []RelabelRule{{Regex: "tmp_.*", Action: RelabelLabelDrop}},
+			in:     metric{[]string{"a"}, []Label{{"tmp_a", "1"}, {"b", "2"}, {"tmp_c", "3"}}},
+			expect: &metric{[]string{"a"}, []Label{{"b", "2"}}},
+		},
+		{
+			name:   "labelkeep",
+			rules:  []RelabelRule{{Regex: "a|c", Action: RelabelLabelKeep}},
+			in:     metric{[]string{"a"}, []Label{{"a", "1"}, {"b", "2"}, {"c", "3"}}},
+			expect: &metric{[]string{"a"}, []Label{{"a", "1"}, {"c", "3"}}},
+		},
+		{
+			name:   "labelmap",
+			rules:  []RelabelRule{{Regex: "meta_(.+)", Action: RelabelLabelMap}},
+			in:     metric{[]string{"a"}, []Label{{"meta_zone", "z1"}}},
+			expect: &metric{[]string{"a"}, []Label{{"meta_zone", "z1"}, {"zone", "z1"}}},
+		},
+		{
+			name:   "hashmod",
+			rules:  []RelabelRule{{SourceLabels: []string{"node"}, Modulus: 8, TargetLabel: "shard", Action: RelabelHashMod}},
+			in:     metric{[]string{"a"}, []Label{{"node", "n1"}}},
+			expect: &metric{[]string{"a"}, []Label{{"node", "n1"}, {"shard", "6"}}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &MockSink{}
+			r, err := NewRelabelSink(m, tc.rules)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			in := metric{append([]string{}, tc.in.key...), append([]Label{}, tc.in.labels...)}
+			r.IncrCounterWithLabels(in.key, 1, in.labels)
+
+			if tc.expect == nil {
+				if len(m.keys) != 0 {
+					t.Fatalf("expected metric to be dropped, got %v %v", m.keys, m.labels)
+				}
+				return
+			}
+			if len(m.keys) != 1 {
+				t.Fatalf("expected one metric, got %v", m.keys)
+			}
+			if !reflect.DeepEqual(m.keys[0], tc.expect.key) {
+				t.Fatalf("bad key: %v", m.keys[0])
+			}
+			if !reflect.DeepEqual(m.labels[0], tc.expect.labels) {
+				t.Fatalf("bad labels: %v", m.labels[0])
+			}
+			if !reflect.DeepEqual(in.key, tc.in.key) || !reflect.DeepEqual(in.labels, append([]Label{}, tc.in.labels...)) {
+				t.Fatalf("input was modified: %v", in)
+			}
+		})
+	}
+}
+
+func TestRelabelSink_BadRules(t *testing.T) {
+	for _, rule := range []RelabelRule{
+		{Regex: "("},
+		{Action: "unknown"},
+		{Action: RelabelReplace},
+		{Action: RelabelHashMod, TargetLabel: "shard"},
+	} {
+		if _, err := NewRelabelSink(&MockSink{}, []RelabelRule{rule}); err == nil {
+			t.Fatalf("expected error for %+v", rule)
+		}
+	}
+}
+
+func TestLoadRelabelRules(t *testing.T) {
+	expect := []RelabelRule{
+		{SourceLabels: []string{"__name__"}, Regex: `raft\..*`, Action: RelabelKeep},
+		{SourceLabels: []string{"node"}, Modulus: 4, TargetLabel: "shard", Action: RelabelHashMod},
+		{SourceLabels: []string{"env"}, TargetLabel: "env", Replacement: relabelReplacement("")},
+	}
+
+	yamlRules := `
+- source_labels: [__name__]
+  regex: 'raft\..*'
+  action: keep
+- source_labels: [node]
+  modulus: 4
+  target_label: shard
+  action: hashmod
+- source_labels: [env]
+  target_label: env
+  replacement: ""
+`
+	jsonRules := `[
+  {"source_labels": ["__name__"], "regex": "raft\\..*", "action": "keep"},
+  {"source_labels": ["node"], "modulus": 4, "target_label": "shard", "action": "hashmod"},
+  {"source_labels": ["env"], "target_label": "env", "replacement": ""}
+]`
+
+	for _, data := range []string{yamlRules, jsonRules} {
+		rules, err := LoadRelabelRules([]byte(data))
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !reflect.DeepEqual(rules, expect) {
+			t.Fatalf("bad rules: %+v", rules)
+		}
+	}
+
+	if _, err := LoadRelabelRules([]byte(`[{"target": "x"}]`)); err == nil {
+		t.Fatalf("expected error for unknown field")
+	}
+}
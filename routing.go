@@ -0,0 +1,254 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// Route configures one branch of a RoutingSink. The zero value of every
+// field except Sink routes all metrics unchanged.
+type Route struct {
+	// Sink receives the metrics matching this route
+	Sink MetricSink
+
+	// AllowedPrefixes and BlockedPrefixes filter metrics by key prefix,
+	// with '.' as the separator. The longest matching prefix wins. If
+	// AllowedPrefixes is not empty, metrics that match no prefix are
+	// blocked, otherwise they are allowed.
+	AllowedPrefixes []string
+	BlockedPrefixes []string
+
+	// MatchLabels restricts the route to metrics carrying all of these
+	// labels, with the same values.
+	MatchLabels []Label
+
+	// AllowedLabels and BlockedLabels filter the labels sent to Sink, the
+	// same way as Config.AllowedLabels and Config.BlockedLabels.
+	AllowedLabels []string
+	BlockedLabels []string
+
+	// Rename, if set, returns the key sent to Sink. It is called after the
+	// filters and must not modify its argument.
+	Rename func(key []string) []string
+
+	// SampleRate, if between 0 and 1, is the fraction of counters, samples
+	// and key/value pairs sent to Sink. Counter increments are divided by
+	// the rate, so that sums are kept. Gauges and sets are not sampled.
+	SampleRate float64
+}
+
+// RoutingSink sends each metric to the routes whose filters it matches,
+// optionally renamed and sampled. Unlike FanoutSink, every route can
+// receive a different stream.
+type RoutingSink struct {
+	routes []*route
+}
+
+// route is a compiled Route
+type route struct {
+	Route
+	filter        *iradix.Tree
+	filterDefault bool
+	allowedLabels map[string]bool
+	blockedLabels map[string]bool
+}
+
+// NewRoutingSink creates a RoutingSink from the given routes
+func NewRoutingSink(routes ...Route) *RoutingSink {
+	r := &RoutingSink{}
+	for _, conf := range routes {
+		rt := &route{
+			Route:         conf,
+			filter:        iradix.New(),
+			filterDefault: len(conf.AllowedPrefixes) == 0,
+		}
+		for _, prefix := range conf.AllowedPrefixes {
+			rt.filter, _, _ = rt.filter.Insert([]byte(prefix), true)
+		}
+		for _, prefix := range conf.BlockedPrefixes {
+			rt.filter, _, _ = rt.filter.Insert([]byte(prefix), false)
+		}
+		if conf.AllowedLabels != nil {
+			rt.allowedLabels = make(map[string]bool)
+			for _, name := range conf.AllowedLabels {
+				rt.allowedLabels[name] = true
+			}
+		}
+		rt.blockedLabels = make(map[string]bool)
+		for _, name := range conf.BlockedLabels {
+			rt.blockedLabels[name] = true
+		}
+		r.routes = append(r.routes, rt)
+	}
+	return r
+}
+
+func (r *RoutingSink) SetGauge(key []string, val float32) {
+	r.SetGaugeWithLabels(key, val, nil)
+}
+
+func (r *RoutingSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
+	for _, rt := range r.routes {
+		if k, l, ok := rt.match(key, labels, false); ok {
+			rt.Sink.SetGaugeWithLabels(k, val, l)
+		}
+	}
+}
+
+func (r *RoutingSink) SetPrecisionGauge(key []string, val float64) {
+	r.SetPrecisionGaugeWithLabels(key, val, nil)
+}
+
+func (r *RoutingSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
+	for _, rt := range r.routes {
+		// The Sink needs to implement PrecisionGaugeMetricSink, in case it doesn't, the metric is ignored
+		s, ok := rt.Sink.(PrecisionGaugeMetricSink)
+		if !ok {
+			continue
+		}
+		if k, l, ok := rt.match(key, labels, false); ok {
+			s.SetPrecisionGaugeWithLabels(k, val, l)
+		}
+	}
+}
+
+func (r *RoutingSink) AddGauge(key []string, delta float32) {
+	r.AddGaugeWithLabels(key, delta, nil)
+}
+
+func (r *RoutingSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	for _, rt := range r.routes {
+		s, ok := rt.Sink.(GaugeDeltaMetricSink)
+		if !ok {
+			continue
+		}
+		if k, l, ok := rt.match(key, labels, false); ok {
+			s.AddGaugeWithLabels(k, delta, l)
+		}
+	}
+}
+
+func (r *RoutingSink) EmitKey(key []string, val float32) {
+	for _, rt := range r.routes {
+		if k, _, ok := rt.match(key, nil, true); ok {
+			rt.Sink.EmitKey(k, val)
+		}
+	}
+}
+
+func (r *RoutingSink) IncrCounter(key []string, val float32) {
+	r.IncrCounterWithLabels(key, val, nil)
+}
+
+func (r *RoutingSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
+	for _, rt := range r.routes {
+		if k, l, ok := rt.match(key, labels, true); ok {
+			if rt.sampled() {
+				rt.Sink.IncrCounterWithLabels(k, val/float32(rt.SampleRate), l)
+			} else {
+				rt.Sink.IncrCounterWithLabels(k, val, l)
+			}
+		}
+	}
+}
+
+func (r *RoutingSink) AddSample(key []string, val float32) {
+	r.AddSampleWithLabels(key, val, nil)
+}
+
+func (r *RoutingSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
+	for _, rt := range r.routes {
+		if k, l, ok := rt.match(key, labels, true); ok {
+			rt.Sink.AddSampleWithLabels(k, val, l)
+		}
+	}
+}
+
+func (r *RoutingSink) AddToSet(key []string, val string) {
+	r.AddToSetWithLabels(key, val, nil)
+}
+
+func (r *RoutingSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	for _, rt := range r.routes {
+		s, ok := rt.Sink.(SetMetricSink)
+		if !ok {
+			continue
+		}
+		if k, l, ok := rt.match(key, labels, false); ok {
+			s.AddToSetWithLabels(k, val, l)
+		}
+	}
+}
+
+// Shutdown shuts down the sink of every route
+func (r *RoutingSink) Shutdown() {
+	for _, rt := range r.routes {
+		if ss, ok := rt.Sink.(ShutdownSink); ok {
+			ss.Shutdown()
+		}
+	}
+}
+
+// match returns the key and labels to send to the route's sink, or false if
+// the metric is filtered out or, when sample is set, not sampled.
+func (rt *route) match(key []string, labels []Label, sample bool) ([]string, []Label, bool) {
+	if !rt.allowKey(key) || !rt.hasMatchLabels(labels) {
+		return nil, nil, false
+	}
+	if sample && rt.sampled() && rand.Float64() >= rt.SampleRate {
+		return nil, nil, false
+	}
+	if rt.Rename != nil {
+		key = rt.Rename(key)
+	}
+	return key, rt.filterLabels(labels), true
+}
+
+func (rt *route) allowKey(key []string) bool {
+	if rt.filter.Len() == 0 {
+		return rt.filterDefault
+	}
+	_, allowed, ok := rt.filter.Root().LongestPrefix([]byte(strings.Join(key, ".")))
+	if !ok {
+		return rt.filterDefault
+	}
+	return allowed.(bool)
+}
+
+func (rt *route) hasMatchLabels(labels []Label) bool {
+	for _, want := range rt.MatchLabels {
+		if !slices.Contains(labels, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterLabels returns the labels allowed by the route, without modifying
+// the given slice which is shared with the other routes
+func (rt *route) filterLabels(labels []Label) []Label {
+	if rt.allowedLabels == nil && len(rt.blockedLabels) == 0 {
+		return labels
+	}
+	filtered := make([]Label, 0, len(labels))
+	for _, label := range labels {
+		if rt.blockedLabels[label.Name] {
+			continue
+		}
+		if rt.allowedLabels != nil && !rt.allowedLabels[label.Name] {
+			continue
+		}
+		filtered = append(filtered, label)
+	}
+	return filtered
+}
+
+func (rt *route) sampled() bool {
+	return rt.SampleRate > 0 && rt.SampleRate < 1
+}
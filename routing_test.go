@@ -0,0 +1,92 @@
+// Copyright IBM Corp. 2013, 2026
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoutingSink(t *testing.T) {
+	raft := &MockSink{}
+	all := &MockSink{}
+	slo := &MockSink{}
+	r := NewRoutingSink(
+		Route{Sink: raft, AllowedPrefixes: []string{"raft."}, BlockedPrefixes: []string{"raft.internal"}},
+		Route{Sink: all},
+		Route{Sink: slo, MatchLabels: []Label{{"slo", "true"}}, BlockedLabels: []string{"slo"}},
+	)
+
+	sloLabels := []Label{{"slo", "true"}, {"method", "GET"}}
+	r.IncrCounter([]string{"raft", "apply"}, 1)
+	r.IncrCounter([]string{"raft", "internal", "x"}, 2)
+	r.SetGaugeWithLabels([]string{"http", "latency"}, 3, sloLabels)
+	r.AddSample([]string{"other"}, 4)
+
+	if !reflect.DeepEqual(raft.keys, [][]string{{"raft", "apply"}}) {
+		t.Fatalf("bad raft keys: %v", raft.keys)
+	}
+	if len(all.keys) != 4 || !reflect.DeepEqual(all.vals, []float32{1, 2, 3, 4}) {
+		t.Fatalf("bad keys: %v %v", all.keys, all.vals)
+	}
+	if !reflect.DeepEqual(slo.keys, [][]string{{"http", "latency"}}) {
+		t.Fatalf("bad slo keys: %v", slo.keys)
+	}
+	if !reflect.DeepEqual(slo.labels[0], []Label{{"method", "GET"}}) {
+		t.Fatalf("bad slo labels: %v", slo.labels[0])
+	}
+	if !reflect.DeepEqual(all.labels[2], sloLabels) {
+		t.Fatalf("labels of other routes were modified: %v", all.labels[2])
+	}
+
+	r.Shutdown()
+	if !raft.shutdown || !all.shutdown || !slo.shutdown {
+		t.Fatalf("sinks were not shut down")
+	}
+}
+
+func TestRoutingSink_Rename(t *testing.T) {
+	m := &MockSink{}
+	r := NewRoutingSink(Route{
+		Sink: m,
+		Rename: func(key []string) []string {
+			return append([]string{"legacy"}, key...)
+		},
+	})
+
+	key := []string{"a", "b"}
+	r.EmitKey(key, 1)
+	r.AddToSet(key, "x")
+	r.AddGauge(key, 2)
+	if !reflect.DeepEqual(m.keys, [][]string{{"legacy", "a", "b"}, {"legacy", "a", "b"}, {"legacy", "a", "b"}}) {
+		t.Fatalf("bad keys: %v", m.keys)
+	}
+	if !reflect.DeepEqual(key, []string{"a", "b"}) {
+		t.Fatalf("key was modified: %v", key)
+	}
+}
+
+func TestRoutingSink_Sampling(t *testing.T) {
+	m := &MockSink{}
+	r := NewRoutingSink(Route{Sink: m, SampleRate: 0.25})
+
+	for range 4000 {
+		r.IncrCounter([]string{"counter"}, 1)
+	}
+	r.SetGauge([]string{"gauge"}, 1)
+
+	var sum float32
+	for i, key := range m.keys {
+		if key[0] == "counter" {
+			sum += m.vals[i]
+		}
+	}
+	// Each sampled increment is scaled by 4, so the sum stays close to 4000
+	if sum < 3000 || sum > 5000 {
+		t.Fatalf("bad counter sum: %v", sum)
+	}
+	if last := m.keys[len(m.keys)-1]; last[0] != "gauge" {
+		t.Fatalf("gauge was sampled")
+	}
+}
@@ -33,6 +33,20 @@ type PrecisionGaugeMetricSink interface {
 	SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label)
 }
 
+// GaugeDeltaMetricSink interface is used to support relative gauge updates
+// for Sinks, if needed. The delta is added to the current value of the gauge.
+type GaugeDeltaMetricSink interface {
+	AddGauge(key []string, delta float32)
+	AddGaugeWithLabels(key []string, delta float32, labels []Label)
+}
+
+// SetMetricSink interface is used to support sets for Sinks, if needed. A set
+// counts the number of distinct values added to a key.
+type SetMetricSink interface {
+	AddToSet(key []string, val string)
+	AddToSetWithLabels(key []string, val string, labels []Label)
+}
+
 type ShutdownSink interface {
 	MetricSink
 
@@ -54,6 +68,10 @@ func (*BlackholeSink) IncrCounter(key []string, val float32)
 func (*BlackholeSink) IncrCounterWithLabels(key []string, val float32, labels []Label)       {}
 func (*BlackholeSink) AddSample(key []string, val float32)                                   {}
 func (*BlackholeSink) AddSampleWithLabels(key []string, val float32, labels []Label)         {}
+func (*BlackholeSink) AddGauge(key []string, delta float32)                                  {}
+func (*BlackholeSink) AddGaugeWithLabels(key []string, delta float32, labels []Label)        {}
+func (*BlackholeSink) AddToSet(key []string, val string)                                     {}
+func (*BlackholeSink) AddToSetWithLabels(key []string, val string, labels []Label)           {}
 
 // FanoutSink is used to sink to fanout values to multiple sinks
 type FanoutSink []MetricSink
@@ -107,6 +125,32 @@ func (fh FanoutSink) AddSampleWithLabels(key []string, val float32, labels []Lab
 	}
 }
 
+func (fh FanoutSink) AddGauge(key []string, delta float32) {
+	fh.AddGaugeWithLabels(key, delta, nil)
+}
+
+func (fh FanoutSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	for _, s := range fh {
+		// Sinks that don't implement GaugeDeltaMetricSink ignore the update
+		if sd, ok := s.(GaugeDeltaMetricSink); ok {
+			sd.AddGaugeWithLabels(key, delta, labels)
+		}
+	}
+}
+
+func (fh FanoutSink) AddToSet(key []string, val string) {
+	fh.AddToSetWithLabels(key, val, nil)
+}
+
+func (fh FanoutSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	for _, s := range fh {
+		// Sinks that don't implement SetMetricSink ignore the value
+		if ss, ok := s.(SetMetricSink); ok {
+			ss.AddToSetWithLabels(key, val, labels)
+		}
+	}
+}
+
 func (fh FanoutSink) Shutdown() {
 	for _, s := range fh {
 		if ss, ok := s.(ShutdownSink); ok {
@@ -125,6 +169,10 @@ var sinkRegistry = map[string]sinkURLFactoryFunc{
 	"statsd":   NewStatsdSinkFromURL,
 	"statsite": NewStatsiteSinkFromURL,
 	"inmem":    NewInmemSinkFromURL,
+	"influx":   NewInfluxSinkFromURL,
+	"graphite": NewGraphiteSinkFromURL,
+	"opentsdb": NewOpenTSDBSinkFromURL,
+	"file":     NewFileSinkFromURL,
 }
 
 // NewMetricSinkFromURL allows a generic URL input to configure any of the
@@ -132,14 +180,48 @@ var sinkRegistry = map[string]sinkURLFactoryFunc{
 // and query parameters are used to set options.
 //
 // "statsd://" - Initializes a StatsdSink. The host and port are passed through
-// as the "addr" of the sink
+// as the "addr" of the sink. The optional "label_style" query parameter sets
+// the LabelStyle, see ParseLabelStyle for the accepted names. The optional
+// "key_format" query parameter sets the KeyFormatter, see ParseKeyFormatter.
 //
 // "statsite://" - Initializes a StatsiteSink. The host and port become the
-// "addr" of the sink
+// "addr" of the sink. It accepts the same "label_style" and "key_format"
+// query parameters.
 //
 // "inmem://" - Initializes an InmemSink. The host and port are ignored. The
 // "interval" and "duration" query parameters must be specified with valid
-// durations, see NewInmemSink for details.
+// durations, see NewInmemSink for details. It accepts the optional
+// "key_format" query parameter.
+//
+// "influx://" - Initializes an InfluxSink. The host and port are the
+// address of the InfluxDB server. The "transport" query parameter is one of
+// "http" (the default), "https" or "udp", and "version" selects the HTTP
+// API, 1 or 2 (the default). The version 1 API uses the "db" and "rp"
+// parameters and the user info of the URL, the version 2 API the "org",
+// "bucket" and "token" parameters. The optional "precision" (ns, us, ms or
+// s), "flush_interval" and "key_format" parameters are also accepted.
+//
+// "graphite://" - Initializes a GraphiteSink. The host and port are the
+// address of the Carbon receiver. The "protocol" query parameter is
+// "plaintext" (the default) or "pickle", and "tagged" sends the labels as
+// Graphite tags. The optional "flush_interval" and "key_format" parameters
+// are also accepted.
+//
+// "opentsdb://" - Initializes an OpenTSDBSink. The host and port are the
+// address of the OpenTSDB server. The "transport" query parameter is one of
+// "http" (the default), "https" or "telnet". The "tag" parameter, given
+// once per tag as "name:value", sets the tags added to every datapoint. The
+// optional "batch_size", "flush_interval" and "key_format" parameters are
+// also accepted.
+//
+// "file://" - Initializes a FileSink. The path of the URL is the file the
+// metrics are appended to, such as "file:///var/log/metrics.jsonl". The
+// "interval" query parameter aggregates the metrics, which are otherwise
+// written as they are emitted. The file is rotated by "max_size" in bytes
+// or by "rotate_every" duration, and "max_backups" and "compress" control
+// the rotated files. The "sync" parameter is "never" (the default),
+// "always" or "periodic", with the period set by "sync_interval". It also
+// accepts the optional "key_format" parameter.
 func NewMetricSinkFromURL(urlStr string) (MetricSink, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
@@ -4,6 +4,7 @@
 package metrics
 
 import (
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -17,6 +18,7 @@ type MockSink struct {
 	keys          [][]string
 	vals          []float32
 	precisionVals []float64
+	setVals       []string
 	labels        [][]Label
 }
 
@@ -79,6 +81,28 @@ func (m *MockSink) AddSampleWithLabels(key []string, val float32, labels []Label
 	m.vals = append(m.vals, val)
 	m.labels = append(m.labels, labels)
 }
+func (m *MockSink) AddGauge(key []string, delta float32) {
+	m.AddGaugeWithLabels(key, delta, nil)
+}
+func (m *MockSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.keys = append(m.keys, key)
+	m.vals = append(m.vals, delta)
+	m.labels = append(m.labels, labels)
+}
+func (m *MockSink) AddToSet(key []string, val string) {
+	m.AddToSetWithLabels(key, val, nil)
+}
+func (m *MockSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.keys = append(m.keys, key)
+	m.setVals = append(m.setVals, val)
+	m.labels = append(m.labels, labels)
+}
 func (m *MockSink) Shutdown() {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -139,6 +163,47 @@ func TestFanoutSink_Gauge_Labels(t *testing.T) {
 	}
 }
 
+func TestFanoutSink_AddGauge(t *testing.T) {
+	m1 := &MockSink{}
+	m2 := &MockSink{}
+	fh := &FanoutSink{m1, m2, &BlackholeSink{}}
+
+	k := []string{"test"}
+	v := float32(-2.0)
+	l := []Label{{"a", "b"}}
+	fh.AddGaugeWithLabels(k, v, l)
+
+	for _, m := range []*MockSink{m1, m2} {
+		if !reflect.DeepEqual(m.keys[0], k) {
+			t.Fatalf("key not equal")
+		}
+		if !reflect.DeepEqual(m.vals[0], v) {
+			t.Fatalf("val not equal")
+		}
+		if !reflect.DeepEqual(m.labels[0], l) {
+			t.Fatalf("labels not equal")
+		}
+	}
+}
+
+func TestFanoutSink_AddToSet(t *testing.T) {
+	m1 := &MockSink{}
+	m2 := &MockSink{}
+	fh := &FanoutSink{m1, m2, &BlackholeSink{}}
+
+	k := []string{"test"}
+	fh.AddToSet(k, "user1")
+
+	for _, m := range []*MockSink{m1, m2} {
+		if !reflect.DeepEqual(m.keys[0], k) {
+			t.Fatalf("key not equal")
+		}
+		if m.setVals[0] != "user1" {
+			t.Fatalf("val not equal")
+		}
+	}
+}
+
 func TestFanoutSink_Key(t *testing.T) {
 	m1 := &MockSink{}
 	m2 := &MockSink{}
@@ -269,6 +334,7 @@ func TestFanoutSink_Sample_Labels(t *testing.T) {
 }
 
 func TestNewMetricSinkFromURL(t *testing.T) {
+	dir := t.TempDir()
 	for _, tc := range []struct {
 		desc      string
 		input     string
@@ -290,6 +356,26 @@ func TestNewMetricSinkFromURL(t *testing.T) {
 			input:  "inmem://?interval=30s&retain=30s",
 			expect: reflect.TypeFor[*InmemSink](),
 		},
+		{
+			desc:   "influx scheme yields an InfluxSink",
+			input:  "influx://someserver:8086?bucket=metrics",
+			expect: reflect.TypeFor[*InfluxSink](),
+		},
+		{
+			desc:   "graphite scheme yields a GraphiteSink",
+			input:  "graphite://someserver:2003?tagged=true",
+			expect: reflect.TypeFor[*GraphiteSink](),
+		},
+		{
+			desc:   "opentsdb scheme yields an OpenTSDBSink",
+			input:  "opentsdb://someserver:4242?tag=host:web1",
+			expect: reflect.TypeFor[*OpenTSDBSink](),
+		},
+		{
+			desc:   "file scheme yields a FileSink",
+			input:  "file://" + filepath.ToSlash(dir) + "/metrics.jsonl?max_size=1048576&compress=true",
+			expect: reflect.TypeFor[*FileSink](),
+		},
 		{
 			desc:      "unknown scheme yields an error",
 			input:     "notasink://whatever",
@@ -306,6 +392,11 @@ func TestNewMetricSinkFromURL(t *testing.T) {
 				if err != nil {
 					t.Fatalf("unexpected err: %s", err)
 				}
+				// Stop the flushers of the graphite, influx, opentsdb and
+				// file sinks
+				if closer, ok := ms.(ShutdownSink); ok {
+					t.Cleanup(closer.Shutdown)
+				}
 				got := reflect.TypeOf(ms)
 				if got != tc.expect {
 					t.Fatalf("expected return type to be %v, got: %v", tc.expect, got)
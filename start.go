@@ -29,6 +29,13 @@ type Config struct {
 	AllowedLabels   []string // A list of metric labels to allow, with '.' as the separator
 	BlockedLabels   []string // A list of metric labels to block, with '.' as the separator
 	FilterDefault   bool     // Whether to allow metrics by default
+	CountFilterHits bool     // Count the metrics decided by each filter rule, see FilterHits
+
+	CanonicalLabels bool          // Sort labels by name, keep one label per name and drop invalid names, see CanonicalizeLabels
+	LabelConflict   LabelConflict // Which label is kept when CanonicalLabels is set and names are duplicated
+
+	LabelNormalizers map[string]LabelNormalizer // Rewrites the values of the labels with the given names
+	LabelFilters     []LabelFilter              // Allows or blocks metrics based on label values
 }
 
 // Metrics represents an instance of a metrics sink that can
@@ -40,6 +47,11 @@ type Metrics struct {
 	filter        *iradix.Tree
 	allowedLabels map[string]bool
 	blockedLabels map[string]bool
+	labelFilter   *iradix.Tree
+	labelFilters  []*labelFilter
+	defaultHits   atomic.Uint64
+	dryRun        atomic.Pointer[filterDryRun]
+	filterVersion uint64       // Incremented by every filter config update
 	filterLock    sync.RWMutex // Lock filters and allowedLabels/blockedLabels access
 }
 
@@ -81,6 +93,7 @@ func New(conf *Config, sink MetricSink) (*Metrics, error) {
 	met.Config = *conf
 	met.sink = sink
 	met.UpdateFilterAndLabels(conf.AllowedPrefixes, conf.BlockedPrefixes, conf.AllowedLabels, conf.BlockedLabels)
+	met.UpdateLabelFilters(conf.LabelFilters)
 
 	// Start the runtime collector
 	if conf.EnableRuntimeMetrics {
@@ -123,6 +136,30 @@ func SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
 	globalMetrics.Load().(*Metrics).SetPrecisionGaugeWithLabels(key, val, labels)
 }
 
+// Add delta to the current value of a gauge
+// The Sink needs to implement GaugeDeltaMetricSink, in case it doesn't, the update is ignored
+func AddGauge(key []string, delta float32) {
+	globalMetrics.Load().(*Metrics).AddGauge(key, delta)
+}
+
+// Add delta to the current value of a gauge with labels
+// The Sink needs to implement GaugeDeltaMetricSink, in case it doesn't, the update is ignored
+func AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	globalMetrics.Load().(*Metrics).AddGaugeWithLabels(key, delta, labels)
+}
+
+// Add a value to the set of distinct values seen for key
+// The Sink needs to implement SetMetricSink, in case it doesn't, the value is ignored
+func AddToSet(key []string, val string) {
+	globalMetrics.Load().(*Metrics).AddToSet(key, val)
+}
+
+// Add a value to the set of distinct values seen for key with labels
+// The Sink needs to implement SetMetricSink, in case it doesn't, the value is ignored
+func AddToSetWithLabels(key []string, val string, labels []Label) {
+	globalMetrics.Load().(*Metrics).AddToSetWithLabels(key, val, labels)
+}
+
 func EmitKey(key []string, val float32) {
 	globalMetrics.Load().(*Metrics).EmitKey(key, val)
 }
@@ -163,6 +200,37 @@ func UpdateFilterAndLabels(allow, block, allowedLabels, blockedLabels []string)
 	globalMetrics.Load().(*Metrics).UpdateFilterAndLabels(allow, block, allowedLabels, blockedLabels)
 }
 
+// ExplainFilter returns how the filters of the global metrics handle a metric
+func ExplainFilter(key []string, labels []Label) FilterExplanation {
+	return globalMetrics.Load().(*Metrics).ExplainFilter(key, labels)
+}
+
+// FilterHits returns the filter rule hit counters of the global metrics
+func FilterHits() []FilterRuleHits {
+	return globalMetrics.Load().(*Metrics).FilterHits()
+}
+
+// StartFilterDryRun starts a filter dry run on the global metrics
+func StartFilterDryRun(allow, block, allowedLabels, blockedLabels []string) {
+	globalMetrics.Load().(*Metrics).StartFilterDryRun(allow, block, allowedLabels, blockedLabels)
+}
+
+// StopFilterDryRun stops the filter dry run of the global metrics and
+// returns its report
+func StopFilterDryRun() (FilterDryRunReport, bool) {
+	return globalMetrics.Load().(*Metrics).StopFilterDryRun()
+}
+
+// UpdateLabelFilters sets the label value filters of the global metrics
+func UpdateLabelFilters(filters []LabelFilter) {
+	globalMetrics.Load().(*Metrics).UpdateLabelFilters(filters)
+}
+
+// UpdateLabelNormalizers sets the label normalizers of the global metrics
+func UpdateLabelNormalizers(normalizers map[string]LabelNormalizer) {
+	globalMetrics.Load().(*Metrics).UpdateLabelNormalizers(normalizers)
+}
+
 // Shutdown disables metric collection, then blocks while attempting to flush metrics to storage.
 // WARNING: Not all MetricSink backends support this functionality, and calling this will cause them to leak resources.
 // This is intended for use immediately prior to application exit.
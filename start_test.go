@@ -307,3 +307,19 @@ func Benchmark_GlobalMetrics_Direct(b *testing.B) {
 	// do something with m so that the compiler does not optimize this away
 	b.Logf("%d", m.lastNumGC)
 }
+
+func Benchmark_LabelFilters(b *testing.B) {
+	s := &BlackholeSink{}
+	m, _ := New(&Config{
+		FilterDefault: true,
+		LabelFilters: []LabelFilter{
+			{Name: "env", Values: []string{"test"}},
+			{Prefix: "rpc", Name: "method", Values: []string{"Get", "Put"}, Allow: true},
+		},
+	}, s)
+	k := []string{"rpc", "calls"}
+	labels := []Label{{"method", "Get"}, {"env", "prod"}}
+	for i := 0; i < b.N; i++ {
+		m.IncrCounterWithLabels(k, 1, labels)
+	}
+}
@@ -16,7 +16,7 @@ import (
 
 func TestStatsd_Flatten(t *testing.T) {
 	s := &StatsdSink{}
-	flat := s.flattenKey([]string{"a", "b", "c", "d"})
+	flat, _ := s.flattenKey([]string{"a", "b", "c", "d"})
 	if flat != "a.b.c.d" {
 		t.Fatalf("Bad flat")
 	}
@@ -175,12 +175,90 @@ func TestStatsd_Conn(t *testing.T) {
 	}
 }
 
+func TestStatsd_ExtendedTypes(t *testing.T) {
+	s := &StatsdSink{metricQueue: make(chan string, 1)}
+	for _, tc := range []struct {
+		emit   func()
+		expect string
+	}{
+		{func() { s.AddGauge([]string{"gauge", "val"}, 2) }, "gauge.val:+2.000000|g\n"},
+		{func() { s.AddGaugeWithLabels([]string{"gauge", "val"}, -3, []Label{{"a", "label"}}) }, "gauge.val.label:-3.000000|g\n"},
+		{func() { s.AddToSet([]string{"set", "users"}, "user 1") }, "set.users:user_1|s\n"},
+		{func() { s.AddToSetWithLabels([]string{"set", "users"}, "a|b", []Label{{"a", "label"}}) }, "set.users.label:a_b|s\n"},
+		{func() { s.SetSampleType(SampleHistogram); s.AddSample([]string{"sample"}, 1) }, "sample:1.000000|h\n"},
+		{func() { s.SetSampleType(SampleDistribution); s.AddSample([]string{"sample"}, 1) }, "sample:1.000000|d\n"},
+	} {
+		tc.emit()
+		if line := <-s.metricQueue; line != tc.expect {
+			t.Fatalf("expected %q, got %q", tc.expect, line)
+		}
+	}
+}
+
+func TestStatsd_ShutdownDrains(t *testing.T) {
+	list, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer func() { _ = list.Close() }()
+
+	s, err := NewStatsdSink(list.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("bad error")
+	}
+	s.IncrCounter([]string{"counter", "me"}, float32(1))
+	s.Shutdown()
+
+	// Pushing after shutdown must not panic
+	s.IncrCounter([]string{"counter", "me"}, float32(2))
+	s.Shutdown()
+
+	_ = list.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := list.Read(buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got := string(buf[:n]); got != "counter.me:1.000000|c\n" {
+		t.Fatalf("bad packet %q", got)
+	}
+}
+
+func FuzzStatsd_SingleLine(f *testing.F) {
+	f.Add("counter", "me", "a", "label")
+	f.Add("slow thingy", "a:b", "c|d", "e\nf")
+	f.Add("a@b", "#", ",", "\r\x00\xff")
+	f.Fuzz(func(t *testing.T, k1, k2, name, value string) {
+		for _, policy := range []EscapePolicy{EscapeReplace, EscapeDrop} {
+			s := &StatsdSink{metricQueue: make(chan string, 1)}
+			s.SetEncoder(NewLineEncoder(StatsdFormat, policy, nil))
+			s.IncrCounterWithLabels([]string{k1, k2}, 1, []Label{{name, value}})
+
+			select {
+			case line := <-s.metricQueue:
+				if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+					t.Fatalf("more than one line: %q", line)
+				}
+				if strings.Count(line, ":") != 1 || strings.Count(line, "|") != 1 {
+					t.Fatalf("corrupt line: %q", line)
+				}
+			default:
+				if policy == EscapeReplace {
+					t.Fatalf("metric was dropped")
+				}
+			}
+		}
+	})
+}
+
 func TestNewStatsdSinkFromURL(t *testing.T) {
 	for _, tc := range []struct {
-		desc       string
-		input      string
-		expectErr  string
-		expectAddr string
+		desc        string
+		input       string
+		expectErr   string
+		expectAddr  string
+		expectStyle LabelStyle
+		expectKey   string
 	}{
 		{
 			desc:       "address is populated",
@@ -192,6 +270,28 @@ func TestNewStatsdSinkFromURL(t *testing.T) {
 			input:      "statsd://statsd.service.consul:1234",
 			expectAddr: "statsd.service.consul:1234",
 		},
+		{
+			desc:        "label style is parsed",
+			input:       "statsd://statsd.service.consul:1234?label_style=influx",
+			expectAddr:  "statsd.service.consul:1234",
+			expectStyle: LabelStyleInflux,
+		},
+		{
+			desc:      "unknown label style",
+			input:     "statsd://statsd.service.consul:1234?label_style=bogus",
+			expectErr: "bad 'label_style' param",
+		},
+		{
+			desc:       "key format is parsed",
+			input:      "statsd://statsd.service.consul:1234?key_format=prometheus%2Bsnake",
+			expectAddr: "statsd.service.consul:1234",
+			expectKey:  "raft_apply_time",
+		},
+		{
+			desc:      "unknown key format",
+			input:     "statsd://statsd.service.consul:1234?key_format=bogus",
+			expectErr: "bad 'key_format' param",
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			u, err := url.Parse(tc.input)
@@ -211,6 +311,14 @@ func TestNewStatsdSinkFromURL(t *testing.T) {
 				if is.addr != tc.expectAddr {
 					t.Fatalf("expected addr %s, got: %s", tc.expectAddr, is.addr)
 				}
+				if is.labelStyle != tc.expectStyle {
+					t.Fatalf("expected label style %d, got: %d", tc.expectStyle, is.labelStyle)
+				}
+				if tc.expectKey != "" {
+					if key, _ := is.flattenKey([]string{"raft", "applyTime"}); key != tc.expectKey {
+						t.Fatalf("expected key %s, got: %s", tc.expectKey, key)
+					}
+				}
 			}
 		})
 	}
@@ -9,7 +9,7 @@ import (
 	"log"
 	"net"
 	"net/url"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,12 +18,37 @@ const (
 	// inactivity. Prevents stats from getting stuck in a buffer
 	// forever.
 	flushInterval = 100 * time.Millisecond
+
+	// shutdownTimeout bounds how long Shutdown blocks while the
+	// statsd and statsite sinks drain their queues.
+	shutdownTimeout = 5 * time.Second
 )
 
 // NewStatsiteSinkFromURL creates an StatsiteSink from a URL. It is used
 // (and tested) from NewMetricSinkFromURL.
 func NewStatsiteSinkFromURL(u *url.URL) (MetricSink, error) {
-	return NewStatsiteSink(u.Host)
+	style := LabelStyleValues
+	if name := u.Query().Get("label_style"); name != "" {
+		var err error
+		if style, err = ParseLabelStyle(name); err != nil {
+			return nil, fmt.Errorf("bad 'label_style' param: %s", err)
+		}
+	}
+	var formatter KeyFormatter
+	if name := u.Query().Get("key_format"); name != "" {
+		var err error
+		if formatter, err = ParseKeyFormatter(name); err != nil {
+			return nil, fmt.Errorf("bad 'key_format' param: %s", err)
+		}
+	}
+
+	s, err := NewStatsiteSink(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	s.SetLabelStyle(style)
+	s.SetKeyFormatter(formatter)
+	return s, nil
 }
 
 // StatsiteSink provides a MetricSink that can be used with a
@@ -31,6 +56,17 @@ func NewStatsiteSinkFromURL(u *url.URL) (MetricSink, error) {
 type StatsiteSink struct {
 	addr        string
 	metricQueue chan string
+	encoder     *LineEncoder
+	formatter   KeyFormatter
+	labelStyle  LabelStyle
+	sampleType  SampleType
+
+	// shutdownLock guards metricQueue so that no metric is pushed once
+	// Shutdown has closed it. doneCh is closed by the flusher once the
+	// queue has been drained and the connection torn down.
+	shutdownLock sync.RWMutex
+	shutdown     bool
+	doneCh       chan struct{}
 }
 
 // NewStatsiteSink is used to create a new StatsiteSink
@@ -38,86 +74,169 @@ func NewStatsiteSink(addr string) (*StatsiteSink, error) {
 	s := &StatsiteSink{
 		addr:        addr,
 		metricQueue: make(chan string, 4096),
+		doneCh:      make(chan struct{}),
 	}
 	go s.flushMetrics()
 	return s, nil
 }
 
-// Close is used to stop flushing to statsite
+// Shutdown stops accepting new metrics, then blocks until the queued metrics
+// have been written to statsite and the connection is closed, or until
+// shutdownTimeout has elapsed.
 func (s *StatsiteSink) Shutdown() {
+	s.shutdownLock.Lock()
+	if s.shutdown {
+		s.shutdownLock.Unlock()
+		return
+	}
+	s.shutdown = true
 	close(s.metricQueue)
+	s.shutdownLock.Unlock()
+
+	select {
+	case <-s.doneCh:
+	case <-time.After(shutdownTimeout):
+		log.Printf("[WARN] Timed out flushing metrics to statsite during shutdown")
+	}
 }
 
 func (s *StatsiteSink) SetGauge(key []string, val float32) {
-	flatKey := s.flattenKey(key)
-	s.pushMetric(fmt.Sprintf("%s:%f|g\n", flatKey, val))
+	if flatKey, ok := s.flattenKey(key); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|g\n", flatKey, val))
+	}
 }
 
 func (s *StatsiteSink) SetGaugeWithLabels(key []string, val float32, labels []Label) {
-	flatKey := s.flattenKeyLabels(key, labels)
-	s.pushMetric(fmt.Sprintf("%s:%f|g\n", flatKey, val))
+	if flatKey, tags, ok := s.flattenKeyLabels(key, labels); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|g%s\n", flatKey, val, tags))
+	}
 }
 
 func (s *StatsiteSink) SetPrecisionGauge(key []string, val float64) {
-	flatKey := s.flattenKey(key)
-	s.pushMetric(fmt.Sprintf("%s:%f|g\n", flatKey, val))
+	if flatKey, ok := s.flattenKey(key); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|g\n", flatKey, val))
+	}
 }
 
 func (s *StatsiteSink) SetPrecisionGaugeWithLabels(key []string, val float64, labels []Label) {
-	flatKey := s.flattenKeyLabels(key, labels)
-	s.pushMetric(fmt.Sprintf("%s:%f|g\n", flatKey, val))
+	if flatKey, tags, ok := s.flattenKeyLabels(key, labels); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|g%s\n", flatKey, val, tags))
+	}
 }
 
 func (s *StatsiteSink) EmitKey(key []string, val float32) {
-	flatKey := s.flattenKey(key)
-	s.pushMetric(fmt.Sprintf("%s:%f|kv\n", flatKey, val))
+	if flatKey, ok := s.flattenKey(key); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|kv\n", flatKey, val))
+	}
 }
 
 func (s *StatsiteSink) IncrCounter(key []string, val float32) {
-	flatKey := s.flattenKey(key)
-	s.pushMetric(fmt.Sprintf("%s:%f|c\n", flatKey, val))
+	if flatKey, ok := s.flattenKey(key); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|c\n", flatKey, val))
+	}
 }
 
 func (s *StatsiteSink) IncrCounterWithLabels(key []string, val float32, labels []Label) {
-	flatKey := s.flattenKeyLabels(key, labels)
-	s.pushMetric(fmt.Sprintf("%s:%f|c\n", flatKey, val))
+	if flatKey, tags, ok := s.flattenKeyLabels(key, labels); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|c%s\n", flatKey, val, tags))
+	}
 }
 
 func (s *StatsiteSink) AddSample(key []string, val float32) {
-	flatKey := s.flattenKey(key)
-	s.pushMetric(fmt.Sprintf("%s:%f|ms\n", flatKey, val))
+	if flatKey, ok := s.flattenKey(key); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|%s\n", flatKey, val, s.sampleType.orDefault()))
+	}
 }
 
 func (s *StatsiteSink) AddSampleWithLabels(key []string, val float32, labels []Label) {
-	flatKey := s.flattenKeyLabels(key, labels)
-	s.pushMetric(fmt.Sprintf("%s:%f|ms\n", flatKey, val))
-}
-
-// Flattens the key for formatting, removes spaces
-func (s *StatsiteSink) flattenKey(parts []string) string {
-	joined := strings.Join(parts, ".")
-	return strings.Map(func(r rune) rune {
-		switch r {
-		case ':':
-			fallthrough
-		case ' ':
-			return '_'
-		default:
-			return r
-		}
-	}, joined)
+	if flatKey, tags, ok := s.flattenKeyLabels(key, labels); ok {
+		s.pushMetric(fmt.Sprintf("%s:%f|%s%s\n", flatKey, val, s.sampleType.orDefault(), tags))
+	}
+}
+
+func (s *StatsiteSink) AddGauge(key []string, delta float32) {
+	if flatKey, ok := s.flattenKey(key); ok {
+		s.pushMetric(fmt.Sprintf("%s:%+f|g\n", flatKey, delta))
+	}
+}
+
+func (s *StatsiteSink) AddGaugeWithLabels(key []string, delta float32, labels []Label) {
+	if flatKey, tags, ok := s.flattenKeyLabels(key, labels); ok {
+		s.pushMetric(fmt.Sprintf("%s:%+f|g%s\n", flatKey, delta, tags))
+	}
+}
+
+func (s *StatsiteSink) AddToSet(key []string, val string) {
+	s.AddToSetWithLabels(key, val, nil)
+}
+
+func (s *StatsiteSink) AddToSetWithLabels(key []string, val string, labels []Label) {
+	flatKey, tags, ok := s.flattenKeyLabels(key, labels)
+	if !ok {
+		return
+	}
+	if val, ok = s.lineEncoder().EncodeLabelValue(val); ok {
+		s.pushMetric(fmt.Sprintf("%s:%s|s%s\n", flatKey, val, tags))
+	}
+}
+
+// SetSampleType sets the metric type used for samples, by default samples
+// are sent as timers. It must be called before the sink is used.
+func (s *StatsiteSink) SetSampleType(sampleType SampleType) {
+	s.sampleType = sampleType
+}
+
+// SetEncoder overrides how keys and labels are escaped, by default unsafe
+// characters are replaced. The encoder must use the wire format of the
+// label style. It must be called before the sink is used.
+func (s *StatsiteSink) SetEncoder(encoder *LineEncoder) {
+	s.encoder = encoder
+}
+
+// SetKeyFormatter sets how keys are turned into metric names, by default
+// the parts are joined with '.'. It must be called before the sink is used.
+func (s *StatsiteSink) SetKeyFormatter(formatter KeyFormatter) {
+	s.formatter = formatter
 }
 
-// Flattens the key along with labels for formatting, removes spaces
-func (s *StatsiteSink) flattenKeyLabels(parts []string, labels []Label) string {
-	for _, label := range labels {
-		parts = append(parts, label.Value)
+// SetLabelStyle sets how labels are encoded, by default label values are
+// appended to the key. It must be called before the sink is used.
+func (s *StatsiteSink) SetLabelStyle(style LabelStyle) {
+	s.labelStyle = style
+}
+
+func (s *StatsiteSink) lineEncoder() *LineEncoder {
+	if s.encoder == nil {
+		return s.labelStyle.defaultEncoder()
+	}
+	return s.encoder
+}
+
+// Flattens the key for formatting, escapes characters reserved by the
+// wire format. Returns false if the metric must be dropped.
+func (s *StatsiteSink) flattenKey(parts []string) (string, bool) {
+	return s.lineEncoder().EncodeKey(formatKey(s.formatter, parts))
+}
+
+// Flattens the key along with labels for formatting in the configured
+// label style. Returns the key, the tags to write after the metric type,
+// and false if the metric must be dropped.
+func (s *StatsiteSink) flattenKeyLabels(parts []string, labels []Label) (string, string, bool) {
+	key, ok := s.flattenKey(parts)
+	if !ok {
+		return "", "", false
 	}
-	return s.flattenKey(parts)
+	return s.labelStyle.formatLabels(s.lineEncoder(), key, labels)
 }
 
-// Does a non-blocking push to the metrics queue
+// Does a non-blocking push to the metrics queue, metrics are
+// dropped once the sink has been shut down
 func (s *StatsiteSink) pushMetric(m string) {
+	s.shutdownLock.RLock()
+	defer s.shutdownLock.RUnlock()
+	if s.shutdown {
+		return
+	}
 	select {
 	case s.metricQueue <- m:
 	default:
@@ -149,7 +268,7 @@ CONNECT:
 		case metric, ok := <-s.metricQueue:
 			// Get a metric from the queue
 			if !ok {
-				goto QUIT
+				goto FLUSH
 			}
 
 			// Try to send to statsite
@@ -166,7 +285,21 @@ CONNECT:
 		}
 	}
 
+FLUSH:
+	// The queue has been closed and drained, flush the buffered writer
+	_ = sock.SetWriteDeadline(time.Now().Add(shutdownTimeout))
+	if err := buffered.Flush(); err != nil {
+		log.Printf("[ERR] Error flushing to statsite! Err: %s", err)
+	}
+	goto QUIT
+
 WAIT:
+	// Drop the broken connection, a new one is made on reconnect
+	if sock != nil {
+		_ = sock.Close()
+		sock = nil
+	}
+
 	// Wait for a while
 	wait = time.After(time.Duration(5) * time.Second)
 	for {
@@ -181,5 +314,8 @@ WAIT:
 		}
 	}
 QUIT:
-	s.metricQueue = nil
+	if sock != nil {
+		_ = sock.Close()
+	}
+	close(s.doneCh)
 }
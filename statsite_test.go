@@ -6,6 +6,7 @@ package metrics
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
 	"strings"
@@ -15,7 +16,7 @@ import (
 
 func TestStatsite_Flatten(t *testing.T) {
 	s := &StatsiteSink{}
-	flat := s.flattenKey([]string{"a", "b", "c", "d"})
+	flat, _ := s.flattenKey([]string{"a", "b", "c", "d"})
 	if flat != "a.b.c.d" {
 		t.Fatalf("Bad flat")
 	}
@@ -174,12 +175,78 @@ func TestStatsite_Conn(t *testing.T) {
 	}
 }
 
+func TestStatsite_ShutdownDrains(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	s, err := NewStatsiteSink(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("bad error")
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	s.IncrCounter([]string{"counter", "me"}, float32(1))
+	s.AddSample([]string{"sample", "me"}, float32(2))
+	s.Shutdown()
+
+	// Pushing after shutdown must not panic
+	s.IncrCounter([]string{"counter", "me"}, float32(3))
+	s.Shutdown()
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	out, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expect := "counter.me:1.000000|c\nsample.me:2.000000|ms\n"
+	if string(out) != expect {
+		t.Fatalf("bad output %q", out)
+	}
+}
+
+func FuzzStatsite_SingleLine(f *testing.F) {
+	f.Add("counter", "me", "a", "label")
+	f.Add("slow thingy", "a:b", "c|d", "e\nf")
+	f.Add("a@b", "#", ",", "\r\x00\xff")
+	f.Fuzz(func(t *testing.T, k1, k2, name, value string) {
+		for _, policy := range []EscapePolicy{EscapeReplace, EscapeDrop} {
+			s := &StatsiteSink{metricQueue: make(chan string, 1)}
+			s.SetEncoder(NewLineEncoder(StatsdFormat, policy, nil))
+			s.IncrCounterWithLabels([]string{k1, k2}, 1, []Label{{name, value}})
+
+			select {
+			case line := <-s.metricQueue:
+				if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+					t.Fatalf("more than one line: %q", line)
+				}
+				if strings.Count(line, ":") != 1 || strings.Count(line, "|") != 1 {
+					t.Fatalf("corrupt line: %q", line)
+				}
+			default:
+				if policy == EscapeReplace {
+					t.Fatalf("metric was dropped")
+				}
+			}
+		}
+	})
+}
+
 func TestNewStatsiteSinkFromURL(t *testing.T) {
 	for _, tc := range []struct {
-		desc       string
-		input      string
-		expectErr  string
-		expectAddr string
+		desc        string
+		input       string
+		expectErr   string
+		expectAddr  string
+		expectStyle LabelStyle
+		expectKey   string
 	}{
 		{
 			desc:       "address is populated",
@@ -191,6 +258,28 @@ func TestNewStatsiteSinkFromURL(t *testing.T) {
 			input:      "statsd://statsd.service.consul:1234",
 			expectAddr: "statsd.service.consul:1234",
 		},
+		{
+			desc:        "label style is parsed",
+			input:       "statsite://statsd.service.consul:1234?label_style=influx",
+			expectAddr:  "statsd.service.consul:1234",
+			expectStyle: LabelStyleInflux,
+		},
+		{
+			desc:      "unknown label style",
+			input:     "statsite://statsd.service.consul:1234?label_style=bogus",
+			expectErr: "bad 'label_style' param",
+		},
+		{
+			desc:       "key format is parsed",
+			input:      "statsite://statsd.service.consul:1234?key_format=prometheus%2Bsnake",
+			expectAddr: "statsd.service.consul:1234",
+			expectKey:  "raft_apply_time",
+		},
+		{
+			desc:      "unknown key format",
+			input:     "statsite://statsd.service.consul:1234?key_format=bogus",
+			expectErr: "bad 'key_format' param",
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			u, err := url.Parse(tc.input)
@@ -210,6 +299,14 @@ func TestNewStatsiteSinkFromURL(t *testing.T) {
 				if is.addr != tc.expectAddr {
 					t.Fatalf("expected addr %s, got: %s", tc.expectAddr, is.addr)
 				}
+				if is.labelStyle != tc.expectStyle {
+					t.Fatalf("expected label style %d, got: %d", tc.expectStyle, is.labelStyle)
+				}
+				if tc.expectKey != "" {
+					if key, _ := is.flattenKey([]string{"raft", "applyTime"}); key != tc.expectKey {
+						t.Fatalf("expected key %s, got: %s", tc.expectKey, key)
+					}
+				}
 			}
 		})
 	}